@@ -15,15 +15,140 @@
 package go_tailer
 
 import (
+	ctx "context"
+	"fmt"
+	configuration "github.com/jdrews/go-tailer/config"
 	"github.com/jdrews/go-tailer/fswatcher"
 	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// OverflowPolicy defines what the buffered tailer does when BufferOptions.MaxLinesInBuffer is reached.
+type OverflowPolicy int
+
+const (
+	// Drop all lines in the buffer.
+	ClearBuffer OverflowPolicy = iota
+	// Stop reading lines from the original tailer until the consumer made space in the buffer.
+	// No lines are dropped, but the original tailer falls behind.
+	BlockProducer
+	// Drop the oldest line in the buffer to make space for the new line.
+	DropOldest
+	// Drop the new line.
+	DropNewest
+	// Keep one of SampleRate new lines by dropping the oldest line in the buffer, and drop the other new lines.
+	SampleLines
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case ClearBuffer:
+		return "clear"
+	case BlockProducer:
+		return "block"
+	case DropOldest:
+		return "drop_oldest"
+	case DropNewest:
+		return "drop_newest"
+	case SampleLines:
+		return "sample"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// ParseOverflowPolicy parses the String() representation of an OverflowPolicy.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{ClearBuffer, BlockProducer, DropOldest, DropNewest, SampleLines} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return ClearBuffer, fmt.Errorf("%q: invalid overflow policy, expected one of \"clear\", \"block\", \"drop_oldest\", \"drop_newest\", or \"sample\"", s)
+}
+
+// DefaultSampleRate is used by SampleLines if BufferOptions.SampleRate is zero.
+const DefaultSampleRate = 10
+
+// Dropped lines are summed up and reported at most once per dropWarningInterval. Variable, so that tests can change it.
+var dropWarningInterval = time.Second
+
+// BufferOptions configures a buffered tailer started with BufferedTailerWithOptions().
+type BufferOptions struct {
+	// MaxLinesInBuffer limits the number of buffered lines. Zero means unlimited.
+	MaxLinesInBuffer int
+	// OverflowPolicy defines what happens when MaxLinesInBuffer is reached. The default is ClearBuffer.
+	OverflowPolicy OverflowPolicy
+	// SampleRate is used by SampleLines. Zero means DefaultSampleRate.
+	SampleRate int
+	// Metric defaults to a no-op metric. If it implements DroppedLinesMetric, dropped lines are counted.
+	Metric BufferLoadMetric
+	// Log defaults to a new logrus logger.
+	Log logrus.FieldLogger
+	// Buffer defaults to an in-memory buffer. Use NewDiskBuffer() to spill lines to disk.
+	// The buffered tailer closes the buffer when the original tailer is closed. Lines that were not consumed yet
+	// remain in the buffer, so a disk buffer replays them after restart.
+	Buffer lineBuffer
+}
+
+// BufferedTailerOptions maps the buffer settings of the input config onto BufferOptions.
+func BufferedTailerOptions(cfg *configuration.InputConfig, metric BufferLoadMetric, log logrus.FieldLogger) (BufferOptions, error) {
+	var (
+		opts = BufferOptions{
+			MaxLinesInBuffer: cfg.MaxLinesInBuffer,
+			SampleRate:       cfg.BufferSampleRate,
+			Metric:           metric,
+			Log:              log,
+		}
+		err error
+	)
+	if len(cfg.BufferOverflowPolicy) > 0 {
+		opts.OverflowPolicy, err = ParseOverflowPolicy(cfg.BufferOverflowPolicy)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.BufferDirectory) > 0 {
+		opts.Buffer, err = NewDiskBuffer(cfg.BufferDirectory, cfg.BufferMaxLinesInMemory, log)
+		if err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// LinesDroppedError is reported on the Errors() channel of the buffered tailer when lines were dropped,
+// because the buffer was full. These errors are warnings, the tailer keeps running.
+type LinesDroppedError struct {
+	Count            int64 // number of lines dropped since the last LinesDroppedError
+	MaxLinesInBuffer int
+	Policy           OverflowPolicy
+}
+
+func (e *LinesDroppedError) Cause() error {
+	return nil
+}
+
+func (e *LinesDroppedError) Type() fswatcher.ErrorType {
+	return fswatcher.LinesDropped
+}
+
+func (e *LinesDroppedError) Error() string {
+	return fmt.Sprintf("line buffer reached limit of %v lines: dropped %v lines, policy %v", e.MaxLinesInBuffer, e.Count, e.Policy)
+}
+
 // implements fswatcher.FileTailer
 type bufferedTailer struct {
-	out  chan *fswatcher.Line
-	orig fswatcher.FileTailer
-	done chan struct{}
+	out       chan *fswatcher.Line
+	errors    chan fswatcher.Error
+	orig      fswatcher.FileTailer
+	buffer    lineBuffer
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{} // closed when the producer and the consumer goroutines have terminated
+	closeErr  error         // error from closing the buffer, valid after stopped is closed
 }
 
 func (b *bufferedTailer) Lines() chan *fswatcher.Line {
@@ -31,16 +156,33 @@ func (b *bufferedTailer) Lines() chan *fswatcher.Line {
 }
 
 func (b *bufferedTailer) Errors() chan fswatcher.Error {
-	return b.orig.Errors()
+	return b.errors
 }
 
 func (b *bufferedTailer) Close() {
-	b.orig.Close()
-	close(b.done)
+	b.closeOnce.Do(func() {
+		b.orig.Close()
+		close(b.done)
+		b.buffer.Interrupt() // stop the consumer, so that the remaining lines stay in the buffer
+	})
+}
+
+func (b *bufferedTailer) Shutdown(shutdownCtx ctx.Context) error {
+	b.Close()
+	err := b.orig.Shutdown(shutdownCtx)
+	select {
+	case <-b.stopped:
+		if err == nil {
+			err = b.closeErr
+		}
+		return err
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
 }
 
 func BufferedTailer(orig fswatcher.FileTailer) fswatcher.FileTailer {
-	return BufferedTailerWithMetrics(orig, &noopMetric{}, logrus.New(), 0)
+	return BufferedTailerWithOptions(orig, BufferOptions{})
 }
 
 // Wrapper around a tailer that consumes the lines channel quickly.
@@ -103,52 +245,194 @@ func BufferedTailer(orig fswatcher.FileTailer) fswatcher.FileTailer {
 // To minimize the risk, use the buffered tailer to make sure file system events are handled
 // as quickly as possible without waiting for the grok patterns to be processed.
 func BufferedTailerWithMetrics(orig fswatcher.FileTailer, bufferLoadMetric BufferLoadMetric, log logrus.FieldLogger, maxLinesInBuffer int) fswatcher.FileTailer {
-	buffer := NewLineBuffer()
-	out := make(chan *fswatcher.Line)
-	done := make(chan struct{})
+	return BufferedTailerWithOptions(orig, BufferOptions{
+		MaxLinesInBuffer: maxLinesInBuffer,
+		Metric:           bufferLoadMetric,
+		Log:              log,
+	})
+}
+
+// BufferedTailerWithOptions is like BufferedTailerWithMetrics, but with a selectable OverflowPolicy.
+// The errors of the original tailer are forwarded to the buffered tailer's Errors() channel,
+// and dropped lines are reported there as LinesDroppedError. Shutdown() returns the error from closing the buffer.
+func BufferedTailerWithOptions(orig fswatcher.FileTailer, opts BufferOptions) fswatcher.FileTailer {
+	var (
+		buffer           = opts.Buffer
+		out              = make(chan *fswatcher.Line)
+		errors           = make(chan fswatcher.Error)
+		done             = make(chan struct{})
+		stopped          = make(chan struct{})
+		producerStopped  = make(chan struct{})
+		consumerStopped  = make(chan struct{})
+		dropped          atomic.Int64 // lines dropped since the last LinesDroppedError
+		bufferLoadMetric = opts.Metric
+		log              = opts.Log
+		sampleRate       = opts.SampleRate
+		wg               sync.WaitGroup
+	)
+	if buffer == nil {
+		buffer = NewLineBuffer()
+	}
+	if bufferLoadMetric == nil {
+		bufferLoadMetric = &noopMetric{}
+	}
+	if log == nil {
+		log = logrus.New()
+	}
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	b := &bufferedTailer{
+		out:     out,
+		errors:  errors,
+		orig:    orig,
+		buffer:  buffer,
+		done:    done,
+		stopped: stopped,
+	}
+	droppedLinesMetric, _ := bufferLoadMetric.(DroppedLinesMetric)
+	drop := func(count int) {
+		if count > 0 {
+			dropped.Add(int64(count))
+			if droppedLinesMetric != nil {
+				droppedLinesMetric.Drop(int64(count))
+			}
+		}
+	}
+	wg.Add(3)
 
 	// producer
 	go func() {
+		defer wg.Done()
+		defer close(producerStopped)
 		bufferLoadMetric.Start()
+		if n := buffer.Len(); n > 0 {
+			bufferLoadMetric.Set(int64(n)) // lines replayed from disk
+		}
+		nOverflowLines := 0 // number of new lines since the buffer is full, used by SampleLines
 		for {
 			line, ok := <-orig.Lines()
-			if ok {
-				if maxLinesInBuffer > 0 && buffer.Len() > maxLinesInBuffer-1 {
-					log.Warnf("Line buffer reached limit of %v lines. Dropping lines in buffer.", maxLinesInBuffer)
-					buffer.Clear()
-					bufferLoadMetric.Set(0)
+			if !ok {
+				// The consumer puts back the line it is holding when it stops, so the buffer is closed after the consumer.
+				buffer.Interrupt()
+				<-consumerStopped
+				b.closeErr = buffer.Close()
+				if b.closeErr != nil {
+					log.Error(b.closeErr.Error())
 				}
-				buffer.Push(line)
-				bufferLoadMetric.Inc()
-			} else {
-				buffer.Close()
 				bufferLoadMetric.Stop()
 				return
 			}
+			if opts.MaxLinesInBuffer <= 0 || buffer.Len() < opts.MaxLinesInBuffer {
+				nOverflowLines = 0
+			} else {
+				switch opts.OverflowPolicy {
+				case BlockProducer:
+					buffer.WaitForSpace(opts.MaxLinesInBuffer) // Interrupted by Close(), so this doesn't block forever.
+				case DropOldest:
+					if buffer.RemoveOldest() != nil {
+						bufferLoadMetric.Dec()
+						drop(1)
+					}
+				case DropNewest:
+					drop(1)
+					continue
+				case SampleLines:
+					nOverflowLines++
+					if nOverflowLines%sampleRate != 0 {
+						drop(1)
+						continue
+					}
+					if buffer.RemoveOldest() != nil {
+						bufferLoadMetric.Dec()
+						drop(1)
+					}
+				default:
+					drop(buffer.Clear())
+					bufferLoadMetric.Set(0)
+				}
+			}
+			buffer.Push(line)
+			bufferLoadMetric.Inc()
 		}
 	}()
 
 	// consumer
 	go func() {
+		defer wg.Done()
+		defer func() {
+			close(consumerStopped)
+			<-producerStopped // out is closed when the buffer is closed
+			close(out)
+		}()
 		for {
 			line := buffer.BlockingPop()
 			if line == nil {
-				// buffer closed
-				close(out)
+				// buffer interrupted or closed
 				return
 			}
 			bufferLoadMetric.Dec()
 			select {
 			case out <- line:
 			case <-done:
+				buffer.PushFront(line)
+				bufferLoadMetric.Inc()
+				return
 			}
 		}
 	}()
-	return &bufferedTailer{
-		out:  out,
-		orig: orig,
-		done: done,
-	}
+
+	// errors: forwards the errors of the original tailer, and reports dropped lines
+	go func() {
+		defer wg.Done()
+		defer close(errors)
+		ticker := time.NewTicker(dropWarningInterval)
+		defer ticker.Stop()
+		send := func(err fswatcher.Error) bool {
+			select {
+			case errors <- err:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		reportDroppedLines := func() bool {
+			count := dropped.Swap(0)
+			if count == 0 {
+				return true
+			}
+			err := &LinesDroppedError{Count: count, MaxLinesInBuffer: opts.MaxLinesInBuffer, Policy: opts.OverflowPolicy}
+			log.Warn(err.Error())
+			return send(err)
+		}
+		origErrors := orig.Errors()  // nil when closed
+		origLines := producerStopped // nil when closed
+		for origErrors != nil || origLines != nil {
+			select {
+			case err, open := <-origErrors:
+				if !open {
+					origErrors = nil
+				} else if !send(err) {
+					return
+				}
+			case <-origLines:
+				origLines = nil
+			case <-ticker.C:
+				if !reportDroppedLines() {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+		reportDroppedLines()
+	}()
+
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	return b
 }
 
 type BufferLoadMetric interface {
@@ -159,6 +443,13 @@ type BufferLoadMetric interface {
 	Stop()
 }
 
+// DroppedLinesMetric extends BufferLoadMetric. If the metric passed to the buffered tailer implements
+// DroppedLinesMetric, Drop() is called when lines are dropped because the buffer is full.
+type DroppedLinesMetric interface {
+	BufferLoadMetric
+	Drop(count int64)
+}
+
 type noopMetric struct{}
 
 func (m *noopMetric) Start()          {}
@@ -15,11 +15,15 @@
 package go_tailer
 
 import (
+	ctx "context"
 	"fmt"
+	configuration "github.com/jdrews/go-tailer/config"
 	"github.com/jdrews/go-tailer/fswatcher"
 	"github.com/sirupsen/logrus"
 	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -29,7 +33,8 @@ const nTestLines = 10000
 var log = logrus.New()
 
 type sourceTailer struct {
-	lines chan *fswatcher.Line
+	lines     chan *fswatcher.Line
+	closeOnce sync.Once
 }
 
 func (tail *sourceTailer) Lines() chan *fswatcher.Line {
@@ -41,7 +46,14 @@ func (tail *sourceTailer) Errors() chan fswatcher.Error {
 }
 
 func (tail *sourceTailer) Close() {
-	close(tail.lines)
+	tail.closeOnce.Do(func() {
+		close(tail.lines)
+	})
+}
+
+func (tail *sourceTailer) Shutdown(_ ctx.Context) error {
+	tail.Close()
+	return nil
 }
 
 // TODO: As we separated lineBuffer and the metrics, this test is now partially copy-and-paste from lineBuffer_test
@@ -133,6 +145,171 @@ func TestLineBufferParallel_withMetrics(t *testing.T) {
 	fmt.Printf("peak load (should be an order of magnitude less than %v): %v\n", nTestLines, metric.peakLoad)
 }
 
+func TestBufferedTailerShutdown(t *testing.T) {
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	metric := &peakLoadMetric{}
+	buffered := BufferedTailerWithMetrics(src, metric, log, 0)
+	for i := 1; i <= 10; i++ {
+		src.lines <- &fswatcher.Line{Line: fmt.Sprintf("This is line number %v.", i)}
+	}
+	shutdownCtx, cancel := ctx.WithTimeout(ctx.Background(), 2*time.Second)
+	defer cancel()
+	err := buffered.Shutdown(shutdownCtx)
+	if err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	// After Shutdown() returned, the goroutines must have terminated without waiting for the remaining lines to be consumed.
+	if !metric.stopCalled {
+		t.Error("metric.Stop() not called.")
+	}
+	_, stillOpen := <-buffered.Lines()
+	if stillOpen {
+		t.Error("Buffered tailer was not closed.")
+	}
+	// calling Close() after Shutdown() must not panic
+	buffered.Close()
+}
+
+// Line 1 is held by the consumer, lines 2-4 fill the buffer, and lines 5-10 overflow.
+func TestBufferOverflowPolicies(t *testing.T) {
+	defer func(interval time.Duration) { dropWarningInterval = interval }(dropWarningInterval)
+	dropWarningInterval = 10 * time.Millisecond
+	for _, test := range []struct {
+		policy        OverflowPolicy
+		expectedLines []int
+	}{
+		{ClearBuffer, []int{1, 8, 9, 10}},
+		{DropOldest, []int{1, 8, 9, 10}},
+		{DropNewest, []int{1, 2, 3, 4}},
+		{SampleLines, []int{1, 6, 8, 10}},
+	} {
+		src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+		metric := &dropMetric{}
+		buffered := BufferedTailerWithOptions(src, BufferOptions{
+			MaxLinesInBuffer: 3,
+			OverflowPolicy:   test.policy,
+			SampleRate:       2,
+			Metric:           metric,
+			Log:              log,
+		})
+		src.lines <- &fswatcher.Line{Line: "1"}
+		for metric.load.Load() > 0 { // wait until the consumer took line 1
+			time.Sleep(time.Millisecond)
+		}
+		for i := 2; i <= 10; i++ {
+			src.lines <- &fswatcher.Line{Line: fmt.Sprintf("%v", i)}
+		}
+		for metric.dropped.Load() < 6 || metric.load.Load() < 3 { // wait until the producer processed all lines
+			time.Sleep(time.Millisecond)
+		}
+		var lines []int
+		for range test.expectedLines {
+			line := <-buffered.Lines()
+			n, _ := strconv.Atoi(line.Line)
+			lines = append(lines, n)
+		}
+		if fmt.Sprint(lines) != fmt.Sprint(test.expectedLines) {
+			t.Errorf("%v: expected lines %v, but got %v", test.policy, test.expectedLines, lines)
+		}
+		var reported int64
+		for reported < 6 {
+			select {
+			case err := <-buffered.Errors():
+				droppedErr, ok := err.(*LinesDroppedError)
+				if !ok || err.Type() != fswatcher.LinesDropped || droppedErr.Policy != test.policy {
+					t.Fatalf("%v: unexpected error: %v", test.policy, err)
+				}
+				reported += droppedErr.Count
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%v: timeout while waiting for LinesDroppedError", test.policy)
+			}
+		}
+		if reported != 6 || metric.dropped.Load() != 6 {
+			t.Errorf("%v: expected 6 dropped lines, but got %v reported and %v in the metric", test.policy, reported, metric.dropped.Load())
+		}
+		buffered.Close()
+	}
+}
+
+func TestBufferOverflowBlockProducer(t *testing.T) {
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	metric := &dropMetric{}
+	buffered := BufferedTailerWithOptions(src, BufferOptions{
+		MaxLinesInBuffer: 3,
+		OverflowPolicy:   BlockProducer,
+		Metric:           metric,
+		Log:              log,
+	})
+	go func() {
+		for i := 1; i <= 100; i++ {
+			src.lines <- &fswatcher.Line{Line: fmt.Sprintf("%v", i)}
+		}
+	}()
+	for i := 1; i <= 100; i++ {
+		line := <-buffered.Lines()
+		if line == nil || line.Line != fmt.Sprintf("%v", i) {
+			t.Fatalf("expected line %v, but got %v", i, line)
+		}
+		if load := metric.load.Load(); load > 3 {
+			t.Fatalf("expected at most 3 lines in buffer, but got %v", load)
+		}
+		if i%10 == 0 {
+			time.Sleep(10 * time.Millisecond) // let the producer run into the limit
+		}
+	}
+	buffered.Close()
+	for err := range buffered.Errors() {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if metric.dropped.Load() != 0 {
+		t.Errorf("expected no dropped lines, but got %v", metric.dropped.Load())
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, policy := range []OverflowPolicy{ClearBuffer, BlockProducer, DropOldest, DropNewest, SampleLines} {
+		parsed, err := ParseOverflowPolicy(policy.String())
+		if err != nil || parsed != policy {
+			t.Errorf("%v: parsed as %v: %v", policy, parsed, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("drop"); err == nil {
+		t.Error("expected error for invalid overflow policy")
+	}
+	opts, err := BufferedTailerOptions(&configuration.InputConfig{MaxLinesInBuffer: 100, BufferOverflowPolicy: "drop_oldest"}, nil, log)
+	if err != nil || opts.MaxLinesInBuffer != 100 || opts.OverflowPolicy != DropOldest {
+		t.Errorf("unexpected buffer options %#v: %v", opts, err)
+	}
+}
+
+// thread safe metric implementing DroppedLinesMetric
+type dropMetric struct {
+	load, dropped atomic.Int64
+	stopped       atomic.Bool
+}
+
+func (m *dropMetric) Start() {}
+
+func (m *dropMetric) Inc() {
+	m.load.Add(1)
+}
+
+func (m *dropMetric) Dec() {
+	m.load.Add(-1)
+}
+
+func (m *dropMetric) Set(value int64) {
+	m.load.Store(value)
+}
+
+func (m *dropMetric) Stop() {
+	m.stopped.Store(true)
+}
+
+func (m *dropMetric) Drop(count int64) {
+	m.dropped.Add(count)
+}
+
 type peakLoadMetric struct {
 	startCalled, stopCalled bool
 	peakLoad                int64
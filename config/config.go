@@ -25,8 +25,28 @@ type InputConfig struct {
 	FailOnMissingLogfileString string        `yaml:"fail_on_missing_logfile,omitempty"` // cannot use bool directly, because yaml.v2 doesn't support true as default value.
 	FailOnMissingLogfile       bool          `yaml:"-"`
 	Readall                    bool          `yaml:",omitempty"`
+	WaitForDirectories         bool          `yaml:"wait_for_directories,omitempty"`
 	PollInterval               time.Duration `yaml:"poll_interval,omitempty"` // implicitly parsed with time.ParseDuration()
+	Backend                    string        `yaml:"backend,omitempty"`       // fsevent, polling, or hybrid. Empty means polling if poll_interval is set, fsevent otherwise.
+	CheckpointFile             string        `yaml:"checkpoint_file,omitempty"`
+	CheckpointInterval         time.Duration `yaml:"checkpoint_interval,omitempty"`
+	RotationGracePeriod        time.Duration `yaml:"rotation_grace_period,omitempty"`
+	FingerprintSize            int           `yaml:"fingerprint_size,omitempty"` // negative disables fingerprints
+	MaxLineLength              int           `yaml:"max_line_length,omitempty"`
+	LongLinePolicy             string        `yaml:"long_line_policy,omitempty"` // truncate, split, or skip. Empty means truncate.
+	Framing                    string        `yaml:"framing,omitempty"`          // newline, nul, rfc7464, delimiter, or length_prefix. Empty means newline.
+	FramingDelimiter           string        `yaml:"framing_delimiter,omitempty"`
+	FramingPrefixSize          int           `yaml:"framing_prefix_size,omitempty"` // 1, 2, 4, or 8 bytes. Zero means 4.
+	Encoding                   string        `yaml:"encoding,omitempty"`            // utf-8, utf-16le, utf-16be, latin1, or windows-1252. Empty means utf-8.
+	InvalidEncoding            string        `yaml:"invalid_encoding,omitempty"`    // pass, replace, or skip. Empty means pass.
+	Header                     string        `yaml:"header,omitempty"`              // none, csv, tsv, or w3c. Empty means none.
+	MaxBatchSize               int           `yaml:"max_batch_size,omitempty"`      // zero disables batching
+	MaxBatchLatency            time.Duration `yaml:"max_batch_latency,omitempty"`
 	MaxLinesInBuffer           int           `yaml:"max_lines_in_buffer,omitempty"`
+	BufferOverflowPolicy       string        `yaml:"buffer_overflow_policy,omitempty"` // clear, block, drop_oldest, drop_newest, or sample. Empty means clear.
+	BufferSampleRate           int           `yaml:"buffer_sample_rate,omitempty"`
+	BufferDirectory            string        `yaml:"buffer_directory,omitempty"` // spill lines to disk. Empty means memory only.
+	BufferMaxLinesInMemory     int           `yaml:"buffer_max_lines_in_memory,omitempty"`
 	WebhookPath                string        `yaml:"webhook_path,omitempty"`
 	WebhookFormat              string        `yaml:"webhook_format,omitempty"`
 	WebhookJsonSelector        string        `yaml:"webhook_json_selector,omitempty"`
@@ -37,10 +57,32 @@ type InputConfig struct {
 	KafkaPartitionAssignor     string        `yaml:"kafka_partition_assignor,omitempty"`
 	KafkaConsumerGroupName     string        `yaml:"kafka_consumer_group_name,omitempty"`
 	KafkaConsumeFromOldest     bool          `yaml:"kafka_consume_from_oldest,omitempty"`
+
+	// Format and Formats select the parsers of well-known log formats, see go_tailer.FormatPipeline().
+	Format  string            `yaml:"format,omitempty"`  // nginx_combined, apache_combined, apache_common, syslog_rfc3164, syslog_rfc5424, go_log, or java_log. Empty means lines are not parsed.
+	Formats map[string]string `yaml:"formats,omitempty"` // file name pattern or glob -> format, overrides format for matching files
+
+	// Encodings and Framings override encoding and framing for the files of specific paths.
+	// The keys must be elements of path or paths. framing_delimiter and framing_prefix_size apply to all framings.
+	Encodings map[string]string `yaml:"encodings,omitempty"` // path or glob -> encoding
+	Framings  map[string]string `yaml:"framings,omitempty"`  // path or glob -> framing
+
+	// Grok and Groks extract fields with grok expressions, see go_tailer.GrokPipeline().
+	Grok  *GrokConfig           `yaml:"grok,omitempty"`
+	Groks map[string]GrokConfig `yaml:"groks,omitempty"` // file name pattern or glob -> grok config, overrides grok for matching files
+}
+
+type GrokConfig struct {
+	Expressions    []string          `yaml:"expressions"`
+	Patterns       map[string]string `yaml:"patterns,omitempty"`
+	Unmatched      string            `yaml:"unmatched,omitempty"` // pass, drop, or tag. Empty means pass.
+	UnmatchedField string            `yaml:"unmatched_field,omitempty"`
 }
 
 type PathsAndGlobs struct {
-	Path  string      `yaml:",omitempty"`
-	Paths []string    `yaml:",omitempty"`
-	Globs []glob.Glob `yaml:"-"`
+	Path      string      `yaml:",omitempty"`
+	Paths     []string    `yaml:",omitempty"`
+	Globs     []glob.Glob `yaml:"-"`
+	Exclude   []string    `yaml:"exclude,omitempty"`    // file name patterns like *-debug.log, or globs if they contain a path separator
+	PathRegex string      `yaml:"path_regex,omitempty"` // if set, files must match the globs and the regular expression
 }
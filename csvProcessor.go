@@ -0,0 +1,221 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"container/list"
+	"encoding/csv"
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"strings"
+	"sync"
+)
+
+// CSVConfig defines the format of CSV lines for DecodeCSV(). The zero value is comma separated values with a header.
+type CSVConfig struct {
+	// Comma separates the values. Zero means ','. Use '\t' for TSV.
+	Comma rune
+	// Columns are the column names for files without header, see fswatcher.Options.Headers.
+	// If a file has a header, the column names are taken from the last header line.
+	Columns []string
+	// If DropRawLine is true, Line.Line is set to the empty string, so that only the fields remain.
+	DropRawLine bool
+}
+
+// DecodeCSV creates a Processor that adds the values of each CSV line to Line.Extra, using the column names
+// from the file's header, see SetField(). The header is read by the file tailer if fswatcher.Options.Header is set,
+// so column names are known even if the tailer starts at the end of the file.
+// Lines that cannot be parsed, or that don't have one value per column, are reported as ProcessorError and passed on unchanged.
+func DecodeCSV(cfg CSVConfig) (Processor, error) {
+	if cfg.Comma == 0 {
+		cfg.Comma = ','
+	}
+	if cfg.Comma == '"' || cfg.Comma == '\r' || cfg.Comma == '\n' {
+		return nil, fmt.Errorf("invalid csv config: %q cannot be used as separator", cfg.Comma)
+	}
+	schemas := newSchemaCache()
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		columns, err := schemas.columns(line, func() ([]string, error) {
+			if len(line.Header) == 0 {
+				return cfg.Columns, nil
+			}
+			return parseCSV(cfg.Comma, line.Header[len(line.Header)-1])
+		})
+		if err != nil {
+			return line, fmt.Errorf("invalid csv header: %v", err)
+		}
+		if len(columns) == 0 {
+			return line, fmt.Errorf("cannot decode csv line, because the file has no header and no columns are configured")
+		}
+		values, err := parseCSV(cfg.Comma, line.Line)
+		if err != nil {
+			return line, err
+		}
+		return setColumns(line, columns, values, cfg.DropRawLine)
+	}), nil
+}
+
+// DecodeW3C creates a Processor for W3C extended log files, like the logs written by IIS.
+// The column names are taken from the #Fields: directive. Directives in the file's header are read
+// by the file tailer if fswatcher.Options.Header is set to fswatcher.CommentHeader("#"). Directives in the middle of
+// the file, like the ones IIS writes when it restarts, are dropped, and a #Fields: directive changes the
+// column names for the following lines of the file. Values are separated by whitespace.
+// Values that are "-" are not available and are not added to Line.Extra.
+func DecodeW3C() Processor {
+	schemas := newSchemaCache()
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		if strings.HasPrefix(line.Line, "#") {
+			if fields, ok := w3cFields(line.Line); ok {
+				schemas.update(line, fields)
+			}
+			return nil, nil
+		}
+		columns, _ := schemas.columns(line, func() ([]string, error) {
+			var columns []string
+			for _, header := range line.Header {
+				if fields, ok := w3cFields(header); ok {
+					columns = fields
+				}
+			}
+			return columns, nil
+		})
+		if len(columns) == 0 {
+			return line, fmt.Errorf("cannot decode w3c line, because the file has no #Fields: directive")
+		}
+		values := strings.Fields(line.Line)
+		if len(values) != len(columns) {
+			return line, fmt.Errorf("expected %v values, but found %v", len(columns), len(values))
+		}
+		fields, err := extraFields(line)
+		if err != nil {
+			return line, err
+		}
+		for i, column := range columns {
+			if values[i] != "-" {
+				fields[column] = values[i]
+			}
+		}
+		return line, nil
+	})
+}
+
+func w3cFields(directive string) ([]string, bool) {
+	const prefix = "#Fields:"
+	if !strings.HasPrefix(directive, prefix) {
+		return nil, false
+	}
+	return strings.Fields(directive[len(prefix):]), true
+}
+
+func parseCSV(comma rune, s string) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(s))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	values, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func setColumns(line *fswatcher.Line, columns []string, values []string, dropRawLine bool) (*fswatcher.Line, error) {
+	if len(values) != len(columns) {
+		return line, fmt.Errorf("expected %v values, but found %v", len(columns), len(values))
+	}
+	fields, err := extraFields(line)
+	if err != nil {
+		return line, err
+	}
+	for i, column := range columns {
+		fields[column] = values[i]
+	}
+	if dropRawLine {
+		line.Line = ""
+	}
+	return line, nil
+}
+
+// The maximum number of files in a schemaCache. Variable, so that tests can change it.
+var maxCachedSchemas = 1000
+
+// schemaCache remembers the column names per file, so that the header is parsed only once per file.
+// A new generation of the file, i.e. after rotation or truncation, has a new schema, and only the latest generation
+// of each file is kept. If more than maxCachedSchemas files are seen, the least recently used file is evicted.
+type schemaCache struct {
+	lock    sync.Mutex
+	schemas map[string]*list.Element // file -> element of lru with the *schema
+	lru     *list.List               // most recently used first
+}
+
+type schema struct {
+	file       string
+	generation int
+	headerSize int
+	columns    []string
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{
+		schemas: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Returns the column names for line, parse is called if they are not known yet.
+func (c *schemaCache) columns(line *fswatcher.Line, parse func() ([]string, error)) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, exists := c.schemas[line.File]; exists {
+		s := e.Value.(*schema)
+		if s.generation == line.Generation && s.headerSize == len(line.Header) {
+			c.lru.MoveToFront(e)
+			return s.columns, nil
+		}
+	}
+	columns, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	c.put(line, columns)
+	return columns, nil
+}
+
+// Replaces the column names for the following lines of the file.
+func (c *schemaCache) update(line *fswatcher.Line, columns []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.put(line, columns)
+}
+
+// Lines of an older generation, like the remaining lines of a rotated file, don't replace the schema of the
+// current generation. The caller must hold the lock.
+func (c *schemaCache) put(line *fswatcher.Line, columns []string) {
+	if e, exists := c.schemas[line.File]; exists {
+		if line.Generation < e.Value.(*schema).generation {
+			return
+		}
+		c.lru.Remove(e)
+	}
+	c.schemas[line.File] = c.lru.PushFront(&schema{
+		file:       line.File,
+		generation: line.Generation,
+		headerSize: len(line.Header),
+		columns:    columns,
+	})
+	if c.lru.Len() > maxCachedSchemas {
+		oldest := c.lru.Remove(c.lru.Back()).(*schema)
+		delete(c.schemas, oldest.file)
+	}
+}
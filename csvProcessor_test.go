@@ -0,0 +1,144 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"github.com/jdrews/go-tailer/fswatcher"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCSV(t *testing.T) {
+	processor, err := DecodeCSV(CSVConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []string{"time,msg"}
+	for _, test := range []struct {
+		line     *fswatcher.Line
+		expected map[string]interface{}
+	}{
+		{
+			line:     &fswatcher.Line{File: "a.csv", Line: `10:00,"started, ok"`, Header: header},
+			expected: map[string]interface{}{"time": "10:00", "msg": "started, ok"},
+		},
+		{
+			// truncated and rewritten with a new header
+			line:     &fswatcher.Line{File: "a.csv", Line: "1,2", Generation: 1, Header: []string{"x,y"}},
+			expected: map[string]interface{}{"x": "1", "y": "2"},
+		},
+		{
+			line:     &fswatcher.Line{File: "b.csv", Line: "3,4", Header: []string{"c,d"}},
+			expected: map[string]interface{}{"c": "3", "d": "4"},
+		},
+	} {
+		line, err := processor.Process(test.line)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.line.Line, err)
+		}
+		if !reflect.DeepEqual(line.Extra, test.expected) {
+			t.Fatalf("%q: expected %v, but got %v", test.line.Line, test.expected, line.Extra)
+		}
+	}
+	line, err := processor.Process(&fswatcher.Line{File: "a.csv", Line: "1,2,3", Generation: 1, Header: []string{"x,y"}})
+	if err == nil || line == nil || line.Extra != nil {
+		t.Fatalf("expected an error and the unchanged line for too many values, but got %v and error %v.", line, err)
+	}
+	line, err = processor.Process(&fswatcher.Line{File: "c.csv", Line: "1,2"})
+	if err == nil || line == nil {
+		t.Fatalf("expected an error for a file without header, but got %v and error %v.", line, err)
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	orig := maxCachedSchemas
+	maxCachedSchemas = 2
+	defer func() {
+		maxCachedSchemas = orig
+	}()
+	cache := newSchemaCache()
+	parsed := 0
+	columns := func(file string, generation int) []string {
+		result, err := cache.columns(&fswatcher.Line{File: file, Generation: generation}, func() ([]string, error) {
+			parsed++
+			return []string{file}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	columns("a.csv", 1)
+	columns("b.csv", 0)
+	columns("a.csv", 1) // cached, a.csv is now more recently used than b.csv
+	columns("c.csv", 0) // evicts b.csv
+	if parsed != 3 || len(cache.schemas) != 2 || cache.schemas["b.csv"] != nil {
+		t.Fatalf("expected b.csv to be evicted after parsing 3 headers, but parsed %v headers and cached %v", parsed, cache.schemas)
+	}
+	columns("a.csv", 0) // the rotated file must not replace the current generation
+	columns("a.csv", 1)
+	if parsed != 4 || cache.schemas["a.csv"].Value.(*schema).generation != 1 {
+		t.Fatalf("expected the current generation of a.csv to be kept, but parsed %v headers", parsed)
+	}
+}
+
+func TestDecodeTSVWithColumns(t *testing.T) {
+	processor, err := DecodeCSV(CSVConfig{Comma: '\t', Columns: []string{"level", "msg"}, DropRawLine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := processor.Process(&fswatcher.Line{File: "a.tsv", Line: "info\tstarted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Line != "" || !reflect.DeepEqual(line.Extra, map[string]interface{}{"level": "info", "msg": "started"}) {
+		t.Fatalf("Unexpected result: line %q, extra %v.", line.Line, line.Extra)
+	}
+	if _, err := DecodeCSV(CSVConfig{Comma: '"'}); err == nil {
+		t.Fatal("expected an invalid config error.")
+	}
+}
+
+func TestDecodeW3C(t *testing.T) {
+	processor := DecodeW3C()
+	header := []string{"#Software: Microsoft Internet Information Services 10.0", "#Fields: date time cs-method cs-uri-stem cs-uri-query"}
+	line, err := processor.Process(&fswatcher.Line{File: "u_ex.log", Line: "2026-01-02 10:00:00 GET /index.html -", Header: header})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"date": "2026-01-02", "time": "10:00:00", "cs-method": "GET", "cs-uri-stem": "/index.html"}
+	if !reflect.DeepEqual(line.Extra, expected) {
+		t.Fatalf("expected %v, but got %v", expected, line.Extra)
+	}
+
+	// IIS writes new directives when it restarts
+	line, err = processor.Process(&fswatcher.Line{File: "u_ex.log", Line: "#Fields: date time sc-status", Header: header})
+	if err != nil || line != nil {
+		t.Fatalf("expected the directive to be dropped, but got %v and error %v.", line, err)
+	}
+	line, err = processor.Process(&fswatcher.Line{File: "u_ex.log", Line: "2026-01-02 10:01:00 200", Header: header})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{"date": "2026-01-02", "time": "10:01:00", "sc-status": "200"}
+	if !reflect.DeepEqual(line.Extra, expected) {
+		t.Fatalf("expected %v, but got %v", expected, line.Extra)
+	}
+
+	line, err = processor.Process(&fswatcher.Line{File: "other.log", Line: "2026-01-02 10:00:00"})
+	if err == nil || line == nil {
+		t.Fatalf("expected an error for a file without #Fields: directive, but got %v and error %v.", line, err)
+	}
+}
@@ -0,0 +1,617 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxLinesInMemory is used by NewDiskBuffer() if maxLinesInMemory is zero.
+const DefaultMaxLinesInMemory = 1000
+
+// A new segment file is started when the current segment has reached diskBufferSegmentSize bytes.
+// Variable, so that tests can change it.
+var diskBufferSegmentSize int64 = 16 << 20
+
+// After writing to disk failed, new lines are kept in memory, and writing is retried after diskBufferRetryInterval.
+// Variable, so that tests can change it.
+var diskBufferRetryInterval = 10 * time.Second
+
+const (
+	segmentFilePrefix = "segment-"
+	segmentFileSuffix = ".jsonl"
+	positionFileName  = "position"
+)
+
+// diskBuffer is a lineBuffer that keeps up to maxLinesInMemory lines in memory, and spills the other lines
+// to segment files. See NewDiskBuffer().
+type diskBuffer struct {
+	dir              string
+	maxLinesInMemory int
+	log              logrus.FieldLogger
+	lock             *sync.Cond
+	closed           bool
+	interrupted      bool
+	head             *list.List // lines in memory, older than the lines on disk
+	segments         []*segment // oldest first, new lines are written to the last segment
+	linesOnDisk      int
+	writeFile        *os.File // nil if the last segment is not open for writing
+	writer           *bufio.Writer
+	readFile         *os.File // nil if the first segment is not open for reading
+	reader           *bufio.Reader
+	tail             *list.List // lines in memory, newer than the lines on disk. Only used after writing to disk failed.
+	diskErr          error      // last error writing to disk, nil if the last write succeeded
+	diskErrTime      time.Time
+	nextSeq          int // sequence number of the next segment, never reused so that a stale position file cannot match a new segment
+}
+
+type segment struct {
+	seq        int
+	lines      int   // number of unread lines
+	size       int64 // number of bytes written
+	readOffset int64
+}
+
+// NewDiskBuffer creates a lineBuffer that keeps up to maxLinesInMemory lines in memory, and spills the other lines to
+// segment files in dir. Segments are deleted when all of their lines are consumed. Lines that are still on disk when
+// the buffer is closed are replayed when a new disk buffer is created for the same directory.
+// Close() writes the lines in memory to disk, too. If the process crashes, lines in memory are lost, and lines that
+// were consumed since the last Close() are replayed.
+// Lines are stored as JSON, so Line.Extra is restored as generic JSON values like map[string]interface{}.
+// Use the buffer with BufferOptions.Buffer.
+func NewDiskBuffer(dir string, maxLinesInMemory int, log logrus.FieldLogger) (lineBuffer, error) {
+	if maxLinesInMemory <= 0 {
+		maxLinesInMemory = DefaultMaxLinesInMemory
+	}
+	if log == nil {
+		log = logrus.New()
+	}
+	b := &diskBuffer{
+		dir:              dir,
+		maxLinesInMemory: maxLinesInMemory,
+		log:              log.WithField("buffer_directory", dir),
+		lock:             sync.NewCond(&sync.Mutex{}),
+		head:             list.New(),
+		tail:             list.New(),
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("%v: failed to create buffer directory: %v", dir, err)
+	}
+	err = b.loadSegments()
+	if err != nil {
+		return nil, err
+	}
+	if b.linesOnDisk > 0 {
+		b.log.Infof("replaying %v buffered lines from disk", b.linesOnDisk)
+	}
+	return b, nil
+}
+
+func (b *diskBuffer) Push(line *fswatcher.Line) {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	if b.closed {
+		return
+	}
+	switch {
+	case b.linesOnDisk == 0 && b.tail.Len() == 0 && b.head.Len() < b.maxLinesInMemory:
+		b.head.PushBack(line)
+	default:
+		b.tail.PushBack(line)
+		if b.diskErr == nil || time.Since(b.diskErrTime) >= diskBufferRetryInterval {
+			b.spill()
+		}
+	}
+	b.lock.Broadcast()
+}
+
+// Writes the lines in b.tail to disk. If writing fails, the remaining lines are kept in memory until the next retry.
+// The caller must hold the lock.
+func (b *diskBuffer) spill() {
+	err := b.writeTail()
+	switch {
+	case err != nil && b.diskErr == nil:
+		b.log.Errorf("failed to write to the line buffer on disk, keeping new lines in memory: %v", err)
+	case err != nil:
+		b.log.Debugf("retrying to write to the line buffer on disk failed: %v", err)
+	case b.diskErr != nil:
+		b.log.Infof("writing to the line buffer on disk succeeded again")
+	}
+	b.diskErr = err
+	if err != nil {
+		b.diskErrTime = time.Now()
+	}
+}
+
+func (b *diskBuffer) writeTail() error {
+	for b.tail.Len() > 0 {
+		err := b.write(b.tail.Front().Value.(*fswatcher.Line))
+		if err != nil {
+			// The writer may be broken, so the next write starts a new segment.
+			if b.writeFile != nil {
+				b.writeFile.Close()
+				b.writeFile, b.writer = nil, nil
+			}
+			return err
+		}
+		b.tail.Remove(b.tail.Front())
+	}
+	return nil
+}
+
+// The line was the oldest line, so it is older than the lines on disk, too.
+func (b *diskBuffer) PushFront(line *fswatcher.Line) {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	if b.closed {
+		return
+	}
+	b.head.PushFront(line)
+	b.lock.Broadcast()
+}
+
+// Interrupted by Close() and Interrupt(), returns nil when one of them is called.
+func (b *diskBuffer) BlockingPop() *fswatcher.Line {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	for b.len() == 0 && !b.closed && !b.interrupted {
+		b.lock.Wait()
+	}
+	if b.closed || b.interrupted {
+		return nil
+	}
+	return b.pop()
+}
+
+func (b *diskBuffer) RemoveOldest() *fswatcher.Line {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	return b.pop()
+}
+
+// Interrupted by Close() and Interrupt(), returns false when one of them is called.
+func (b *diskBuffer) WaitForSpace(maxLen int) bool {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	for b.len() >= maxLen && !b.closed && !b.interrupted {
+		b.lock.Wait()
+	}
+	return !b.closed && !b.interrupted
+}
+
+func (b *diskBuffer) Interrupt() {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	b.interrupted = true
+	b.lock.Broadcast()
+}
+
+func (b *diskBuffer) Len() int {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	return b.len()
+}
+
+func (b *diskBuffer) len() int {
+	return b.head.Len() + b.linesOnDisk + b.tail.Len()
+}
+
+func (b *diskBuffer) Clear() int {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	removed := b.len()
+	b.head = list.New()
+	b.tail = list.New()
+	for len(b.segments) > 0 {
+		b.removeFirstSegment()
+	}
+	b.lock.Broadcast()
+	return removed
+}
+
+// Close writes the lines in memory to disk and saves the read position, so that the remaining lines are replayed by
+// the next disk buffer for the same directory.
+func (b *diskBuffer) Close() error {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.lock.Broadcast()
+	if b.readFile != nil {
+		b.readFile.Close()
+		b.readFile, b.reader = nil, nil
+	}
+	err := b.writeHead()
+	if err == nil {
+		err = b.writeTail()
+	}
+	closeErr := b.closeWriter()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = b.savePosition()
+	}
+	if err != nil {
+		return fmt.Errorf("%v: failed to close line buffer: %v", b.dir, err)
+	}
+	return nil
+}
+
+// Returns the oldest line, or nil if the buffer is empty. The caller must hold the lock.
+func (b *diskBuffer) pop() *fswatcher.Line {
+	var result *fswatcher.Line
+	switch {
+	case b.head.Len() > 0:
+		result = b.head.Remove(b.head.Front()).(*fswatcher.Line)
+	case b.linesOnDisk > 0:
+		result = b.read()
+	}
+	if result == nil && b.tail.Len() > 0 {
+		result = b.tail.Remove(b.tail.Front()).(*fswatcher.Line)
+	}
+	if result != nil {
+		b.lock.Broadcast() // wake up WaitForSpace()
+	}
+	return result
+}
+
+// Appends line to the last segment. The caller must hold the lock.
+func (b *diskBuffer) write(line *fswatcher.Line) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if b.writer == nil || b.segments[len(b.segments)-1].size >= diskBufferSegmentSize {
+		err = b.startSegment()
+		if err != nil {
+			return err
+		}
+	}
+	data = append(data, '\n')
+	_, err = b.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	last := b.segments[len(b.segments)-1]
+	last.size += int64(len(data))
+	last.lines++
+	b.linesOnDisk++
+	return nil
+}
+
+// Writes the lines in b.head to disk. As these lines are older than the lines on disk, they are written in front of
+// the unread lines of the first segment. The caller must hold the lock.
+func (b *diskBuffer) writeHead() error {
+	if b.head.Len() == 0 {
+		return nil
+	}
+	if len(b.segments) == 0 {
+		for b.head.Len() > 0 {
+			err := b.write(b.head.Front().Value.(*fswatcher.Line))
+			if err != nil {
+				return err
+			}
+			b.head.Remove(b.head.Front())
+		}
+		return nil
+	}
+	if len(b.segments) == 1 {
+		err := b.closeWriter()
+		if err != nil {
+			return err
+		}
+	}
+	first := b.segments[0]
+	path := b.segmentPath(first.seq)
+	tmpPath := path + ".tmp"
+	size, err := b.prependLines(tmpPath, path, first.readOffset)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+	b.linesOnDisk += b.head.Len()
+	first.lines += b.head.Len()
+	first.size, first.readOffset = size, 0
+	b.head = list.New()
+	return nil
+}
+
+// Writes the lines in b.head followed by the content of path after offset to tmpPath, and returns the size of tmpPath.
+func (b *diskBuffer) prependLines(tmpPath, path string, offset int64) (int64, error) {
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer tmpFile.Close()
+	writer := bufio.NewWriter(tmpFile)
+	var size int64
+	for e := b.head.Front(); e != nil; e = e.Next() {
+		data, err := json.Marshal(e.Value.(*fswatcher.Line))
+		if err != nil {
+			return 0, err
+		}
+		n, err := writer.Write(append(data, '\n'))
+		if err != nil {
+			return 0, err
+		}
+		size += int64(n)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(writer, file)
+	if err != nil {
+		return 0, err
+	}
+	err = writer.Flush()
+	if err != nil {
+		return 0, err
+	}
+	return size + n, tmpFile.Close()
+}
+
+func (b *diskBuffer) startSegment() error {
+	err := b.closeWriter()
+	if err != nil {
+		return err
+	}
+	seq := b.nextSeq
+	file, err := os.OpenFile(b.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	b.nextSeq++
+	b.segments = append(b.segments, &segment{seq: seq})
+	b.writeFile, b.writer = file, bufio.NewWriter(file)
+	return nil
+}
+
+func (b *diskBuffer) closeWriter() error {
+	if b.writeFile == nil {
+		return nil
+	}
+	err := b.writer.Flush()
+	closeErr := b.writeFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	b.writeFile, b.writer = nil, nil
+	return err
+}
+
+// Reads the next line from the first segment, and deletes segments that were consumed.
+// Segments that cannot be read are dropped. The caller must hold the lock.
+func (b *diskBuffer) read() *fswatcher.Line {
+	for b.linesOnDisk > 0 {
+		first := b.segments[0]
+		if first.lines == 0 {
+			b.removeFirstSegment()
+			continue
+		}
+		data, err := b.readLine(first)
+		if err != nil {
+			b.log.Errorf("%v: failed to read from the line buffer on disk, dropping %v lines: %v", b.segmentPath(first.seq), first.lines, err)
+			b.removeFirstSegment()
+			continue
+		}
+		first.readOffset += int64(len(data))
+		first.lines--
+		b.linesOnDisk--
+		if first.lines == 0 {
+			b.removeFirstSegment()
+		}
+		line := &fswatcher.Line{}
+		err = json.Unmarshal(data, line)
+		if err != nil {
+			b.log.Errorf("%v: dropping invalid line from the line buffer on disk: %v", b.segmentPath(first.seq), err)
+			continue
+		}
+		return line
+	}
+	return nil
+}
+
+func (b *diskBuffer) readLine(first *segment) ([]byte, error) {
+	if len(b.segments) == 1 && b.writer != nil {
+		// We are reading the segment that is currently written.
+		err := b.writer.Flush()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b.readFile == nil {
+		file, err := os.Open(b.segmentPath(first.seq))
+		if err != nil {
+			return nil, err
+		}
+		_, err = file.Seek(first.readOffset, io.SeekStart)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		b.readFile, b.reader = file, bufio.NewReader(file)
+	}
+	return b.reader.ReadBytes('\n')
+}
+
+// Deletes the first segment, including its unread lines.
+func (b *diskBuffer) removeFirstSegment() {
+	first := b.segments[0]
+	if b.readFile != nil {
+		b.readFile.Close()
+		b.readFile, b.reader = nil, nil
+	}
+	if len(b.segments) == 1 {
+		err := b.closeWriter()
+		if err != nil {
+			b.log.Debugf("%v: %v", b.segmentPath(first.seq), err)
+		}
+	}
+	err := os.Remove(b.segmentPath(first.seq))
+	if err != nil && !os.IsNotExist(err) {
+		b.log.Warnf("failed to remove consumed segment: %v", err)
+	}
+	b.linesOnDisk -= first.lines
+	b.segments = b.segments[1:]
+}
+
+func (b *diskBuffer) segmentPath(seq int) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%v%016d%v", segmentFilePrefix, seq, segmentFileSuffix))
+}
+
+// Finds the segments in b.dir, and counts their unread lines.
+func (b *diskBuffer) loadSegments() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return fmt.Errorf("%v: failed to read buffer directory: %v", b.dir, err)
+	}
+	var segments []*segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentFilePrefix) || !strings.HasSuffix(name, segmentFileSuffix) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentFilePrefix), segmentFileSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, &segment{seq: seq})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].seq < segments[j].seq
+	})
+	positionSeq, positionOffset := b.loadPosition()
+	b.nextSeq = positionSeq + 1
+	for _, s := range segments {
+		if s.seq >= b.nextSeq {
+			b.nextSeq = s.seq + 1
+		}
+		if s.seq == positionSeq {
+			s.readOffset = positionOffset
+		}
+		err = b.scanSegment(s)
+		if err != nil {
+			return fmt.Errorf("%v: failed to read segment: %v", b.segmentPath(s.seq), err)
+		}
+		if s.lines == 0 {
+			err = os.Remove(b.segmentPath(s.seq))
+			if err != nil {
+				return fmt.Errorf("failed to remove consumed segment: %v", err)
+			}
+			continue
+		}
+		b.segments = append(b.segments, s)
+		b.linesOnDisk += s.lines
+	}
+	return nil
+}
+
+// Counts the lines after the read offset. If the process crashed while writing, the incomplete last line is removed.
+func (b *diskBuffer) scanSegment(s *segment) error {
+	file, err := os.OpenFile(b.segmentPath(s.seq), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if s.readOffset > stat.Size() {
+		s.readOffset = 0 // Inconsistent position. Replaying lines is better than losing lines.
+	}
+	_, err = file.Seek(s.readOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	s.size = s.readOffset
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				return file.Truncate(s.size)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.size += int64(len(data))
+		s.lines++
+	}
+}
+
+// The position file contains the sequence number and the read offset of the first segment.
+func (b *diskBuffer) loadPosition() (int, int64) {
+	data, err := os.ReadFile(filepath.Join(b.dir, positionFileName))
+	if err != nil {
+		return -1, 0
+	}
+	var (
+		seq    int
+		offset int64
+	)
+	_, err = fmt.Sscanf(string(data), "%d %d", &seq, &offset)
+	if err != nil {
+		b.log.Warnf("ignoring invalid position file: %v", err)
+		return -1, 0
+	}
+	return seq, offset
+}
+
+func (b *diskBuffer) savePosition() error {
+	path := filepath.Join(b.dir, positionFileName)
+	if len(b.segments) == 0 {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmpPath := path + ".tmp"
+	err := os.WriteFile(tmpPath, []byte(fmt.Sprintf("%d %d\n", b.segments[0].seq, b.segments[0].readOffset)), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,301 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	ctx "context"
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setDiskBufferSegmentSize(t *testing.T, size int64) {
+	orig := diskBufferSegmentSize
+	diskBufferSegmentSize = size
+	t.Cleanup(func() {
+		diskBufferSegmentSize = orig
+	})
+}
+
+func countSegments(t *testing.T, dir string) int {
+	segments, err := filepath.Glob(filepath.Join(dir, segmentFilePrefix+"*"+segmentFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(segments)
+}
+
+func pushLines(buf lineBuffer, from, to int) {
+	for i := from; i <= to; i++ {
+		buf.Push(&fswatcher.Line{Line: fmt.Sprintf("This is line number %v.", i), File: "test.log"})
+	}
+}
+
+func popLines(t *testing.T, buf lineBuffer, from, to int) {
+	for i := from; i <= to; i++ {
+		line := buf.BlockingPop()
+		if line == nil {
+			t.Fatalf("Expected 'This is line number %v', but the buffer was closed.", i)
+		}
+		if line.Line != fmt.Sprintf("This is line number %v.", i) || line.File != "test.log" {
+			t.Fatalf("Expected 'This is line number %v', but got '%v'.", i, line)
+		}
+	}
+}
+
+func TestDiskBufferOrdering(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	dir := t.TempDir()
+	buf, err := NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	pushLines(buf, 1, 100)
+	if buf.Len() != 100 {
+		t.Fatalf("Expected 100 lines in the buffer, but got %v.", buf.Len())
+	}
+	if countSegments(t, dir) < 2 {
+		t.Fatalf("Expected the lines to be spilled to multiple segments, but found %v segments.", countSegments(t, dir))
+	}
+	popLines(t, buf, 1, 50)
+	pushLines(buf, 101, 150) // written to disk, because there are still lines on disk
+	popLines(t, buf, 51, 150)
+	if buf.Len() != 0 {
+		t.Fatalf("Expected an empty buffer, but got %v lines.", buf.Len())
+	}
+	if countSegments(t, dir) != 0 {
+		t.Fatalf("Expected consumed segments to be removed, but found %v segments.", countSegments(t, dir))
+	}
+	pushLines(buf, 151, 160) // in memory again
+	if countSegments(t, dir) != 0 {
+		t.Fatalf("Expected lines to be kept in memory, but found %v segments.", countSegments(t, dir))
+	}
+	popLines(t, buf, 151, 160)
+}
+
+func TestDiskBufferRestart(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	dir := t.TempDir()
+	buf, err := NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushLines(buf, 1, 100)
+	popLines(t, buf, 1, 25)
+	err = buf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.BlockingPop() != nil {
+		t.Fatal("Expected BlockingPop() to return nil after Close().")
+	}
+
+	// Simulate a crash while writing a line.
+	segments, _ := filepath.Glob(filepath.Join(dir, segmentFilePrefix+"*"+segmentFileSuffix))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"Line":"incomplete`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines 1 - 25 were consumed, lines 26 - 100 are replayed.
+	buf, err = NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	if buf.Len() != 75 {
+		t.Fatalf("Expected 75 lines after restart, but got %v.", buf.Len())
+	}
+	pushLines(buf, 101, 110)
+	popLines(t, buf, 26, 110)
+	if buf.Len() != 0 {
+		t.Fatalf("Expected an empty buffer, but got %v lines.", buf.Len())
+	}
+}
+
+func TestDiskBufferClear(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	dir := t.TempDir()
+	buf, err := NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	pushLines(buf, 1, 100)
+	if line := buf.RemoveOldest(); line == nil || !strings.HasSuffix(line.Line, " 1.") {
+		t.Fatalf("Expected RemoveOldest() to return line 1, but got %v.", line)
+	}
+	if n := buf.Clear(); n != 99 {
+		t.Fatalf("Expected Clear() to remove 99 lines, but got %v.", n)
+	}
+	if countSegments(t, dir) != 0 {
+		t.Fatalf("Expected Clear() to remove all segments, but found %v segments.", countSegments(t, dir))
+	}
+	pushLines(buf, 101, 120)
+	popLines(t, buf, 101, 120)
+}
+
+func TestDiskBufferCloseWritesLinesInMemory(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	dir := t.TempDir()
+	buf, err := NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushLines(buf, 1, 5) // in memory only
+	err = buf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushLines(buf, 6, 100)
+	popLines(t, buf, 1, 30) // lines 1 - 10 are in memory again, the first segment is partially consumed
+	err = buf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	if buf.Len() != 70 {
+		t.Fatalf("Expected 70 lines after restart, but got %v.", buf.Len())
+	}
+	popLines(t, buf, 31, 100)
+}
+
+func TestDiskBufferStalePosition(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	dir := t.TempDir()
+	buf, err := NewDiskBuffer(dir, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushLines(buf, 1, 20)
+	popLines(t, buf, 1, 3)
+	err = buf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = NewDiskBuffer(dir, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	popLines(t, buf, 4, 20) // all segments are consumed, but the position file is still there
+	pushLines(buf, 21, 40)
+
+	// Simulate a crash: The position file must not match the new segments.
+	buf, err = NewDiskBuffer(dir, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	// Line 21 was in memory, and the last lines may not have been flushed, but no line must be skipped.
+	n := buf.Len()
+	if n < 15 || n > 19 {
+		t.Fatalf("Expected 15 - 19 lines after restart, but got %v.", n)
+	}
+	popLines(t, buf, 22, 21+n)
+}
+
+func TestDiskBufferRetry(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	orig := diskBufferRetryInterval
+	diskBufferRetryInterval = 0
+	defer func() {
+		diskBufferRetryInterval = orig
+	}()
+	dir := filepath.Join(t.TempDir(), "buffer")
+	buf, err := NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	pushLines(buf, 1, 10)
+
+	// Writing fails while dir is a regular file.
+	err = os.Remove(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushLines(buf, 11, 20)
+	if countSegments(t, dir) != 0 || buf.Len() != 20 {
+		t.Fatalf("Expected 20 lines in memory, but got %v lines and %v segments.", buf.Len(), countSegments(t, dir))
+	}
+	err = os.Remove(dir)
+	if err == nil {
+		err = os.Mkdir(dir, 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushLines(buf, 21, 100)
+	if countSegments(t, dir) < 2 {
+		t.Fatalf("Expected lines to be written to disk again, but found %v segments.", countSegments(t, dir))
+	}
+	popLines(t, buf, 1, 100)
+}
+
+// Lines that were not consumed when the buffered tailer is shut down are replayed by the next disk buffer.
+func TestBufferedTailerWithDiskBufferRestart(t *testing.T) {
+	setDiskBufferSegmentSize(t, 256)
+	dir := t.TempDir()
+	buf, err := NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	buffered := BufferedTailerWithOptions(src, BufferOptions{Buffer: buf, Log: log})
+	for i := 1; i <= 100; i++ {
+		src.lines <- &fswatcher.Line{Line: fmt.Sprintf("This is line number %v.", i), File: "test.log"}
+	}
+	if line := <-buffered.Lines(); line == nil || line.Line != "This is line number 1." {
+		t.Fatalf("Expected line 1, but got %v.", line)
+	}
+	time.Sleep(10 * time.Millisecond) // let the consumer pop line 2 and wait until it is read
+	shutdownCtx, cancel := ctx.WithTimeout(ctx.Background(), 2*time.Second)
+	defer cancel()
+	err = buffered.Shutdown(shutdownCtx)
+	if err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	buf, err = NewDiskBuffer(dir, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Close()
+	if buf.Len() != 99 {
+		t.Fatalf("Expected 99 lines after restart, but got %v.", buf.Len())
+	}
+	popLines(t, buf, 2, 100)
+}
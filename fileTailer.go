@@ -0,0 +1,172 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	ctx "context"
+	"fmt"
+	configuration "github.com/jdrews/go-tailer/config"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"github.com/jdrews/go-tailer/glob"
+	"github.com/sirupsen/logrus"
+)
+
+// FileTailerOptions maps the file input config onto fswatcher.Options.
+// If cfg.Globs is empty, the globs are parsed from cfg.Path and cfg.Paths.
+func FileTailerOptions(cfg *configuration.InputConfig, log logrus.FieldLogger) (fswatcher.Options, error) {
+	var (
+		opts = fswatcher.Options{
+			Globs:               cfg.Globs,
+			Readall:             cfg.Readall,
+			FailOnMissingFile:   cfg.FailOnMissingLogfile,
+			WaitForDirectories:  cfg.WaitForDirectories,
+			PollInterval:        cfg.PollInterval,
+			CheckpointInterval:  cfg.CheckpointInterval,
+			RotationGracePeriod: cfg.RotationGracePeriod,
+			FingerprintSize:     cfg.FingerprintSize,
+			MaxLineLength:       cfg.MaxLineLength,
+			MaxBatchSize:        cfg.MaxBatchSize,
+			MaxBatchLatency:     cfg.MaxBatchLatency,
+			Log:                 log,
+		}
+		err error
+	)
+	if len(opts.Globs) == 0 {
+		paths := cfg.Paths
+		if len(cfg.Path) > 0 {
+			paths = append([]string{cfg.Path}, paths...)
+		}
+		for _, path := range paths {
+			parsedGlob, err := glob.Parse(path)
+			if err != nil {
+				return opts, err
+			}
+			opts.Globs = append(opts.Globs, parsedGlob)
+		}
+	}
+	for _, pattern := range cfg.Exclude {
+		exclude, err := glob.ParseMatcher(pattern)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: exclude: %v", err)
+		}
+		opts.Exclude = append(opts.Exclude, exclude)
+	}
+	if len(cfg.PathRegex) > 0 {
+		pathRegex, err := glob.ParseRegex(cfg.PathRegex)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: path_regex: %v", err)
+		}
+		opts.PathMatcher = pathRegex
+	}
+	switch {
+	case len(cfg.Backend) > 0:
+		opts.Backend, err = fswatcher.ParseBackend(cfg.Backend)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	case cfg.PollInterval > 0:
+		opts.Backend = fswatcher.PollingBackend
+	default:
+		opts.Backend = fswatcher.FseventBackend
+	}
+	if len(cfg.LongLinePolicy) > 0 {
+		opts.LongLinePolicy, err = fswatcher.ParseLongLinePolicy(cfg.LongLinePolicy)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.Framing) > 0 {
+		opts.Framer, err = fswatcher.ParseFramer(cfg.Framing, cfg.FramingDelimiter, cfg.FramingPrefixSize)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	for path, framing := range cfg.Framings {
+		g, err := configuredGlob(opts.Globs, path)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: framings: %v", err)
+		}
+		if opts.Framers == nil {
+			opts.Framers = make(map[glob.Glob]fswatcher.Framer)
+		}
+		opts.Framers[g], err = fswatcher.ParseFramer(framing, cfg.FramingDelimiter, cfg.FramingPrefixSize)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.Encoding) > 0 {
+		opts.Encoding, err = fswatcher.ParseEncoding(cfg.Encoding)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	for path, encoding := range cfg.Encodings {
+		g, err := configuredGlob(opts.Globs, path)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: encodings: %v", err)
+		}
+		if opts.Encodings == nil {
+			opts.Encodings = make(map[glob.Glob]fswatcher.Encoding)
+		}
+		opts.Encodings[g], err = fswatcher.ParseEncoding(encoding)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.InvalidEncoding) > 0 {
+		opts.InvalidEncodingPolicy, err = fswatcher.ParseInvalidEncodingPolicy(cfg.InvalidEncoding)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.Header) > 0 {
+		opts.Header, err = fswatcher.ParseHeader(cfg.Header)
+		if err != nil {
+			return opts, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.CheckpointFile) > 0 {
+		opts.CheckpointStore = fswatcher.NewCheckpointFile(cfg.CheckpointFile)
+	}
+	return opts, nil
+}
+
+// Returns the element of globs given as path in a per-glob option, like the keys of cfg.Encodings.
+func configuredGlob(globs []glob.Glob, path string) (glob.Glob, error) {
+	parsedGlob, err := glob.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	for _, g := range globs {
+		if g == parsedGlob {
+			return g, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not one of the configured paths", path)
+}
+
+// RunFileTailer runs the file tailer configured in cfg.
+func RunFileTailer(cfg *configuration.InputConfig, log logrus.FieldLogger) (fswatcher.FileTailer, error) {
+	return RunFileTailerContext(ctx.Background(), cfg, log)
+}
+
+// RunFileTailerContext runs the file tailer configured in cfg until parent is done or the tailer is closed.
+func RunFileTailerContext(parent ctx.Context, cfg *configuration.InputConfig, log logrus.FieldLogger) (fswatcher.FileTailer, error) {
+	opts, err := FileTailerOptions(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return fswatcher.RunContext(parent, opts)
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	configuration "github.com/jdrews/go-tailer/config"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"testing"
+	"time"
+)
+
+func TestFileTailerOptions(t *testing.T) {
+	for _, test := range []struct {
+		cfg             configuration.InputConfig
+		expectedBackend fswatcher.Backend
+		expectedGlobs   int
+	}{
+		{
+			cfg:             configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log"}},
+			expectedBackend: fswatcher.FseventBackend,
+			expectedGlobs:   1,
+		},
+		{
+			cfg:             configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/a.log", Paths: []string{"/var/log/b.log"}}, PollInterval: time.Second},
+			expectedBackend: fswatcher.PollingBackend,
+			expectedGlobs:   2,
+		},
+		{
+			cfg:             configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Paths: []string{"/var/log/*.log"}}, PollInterval: time.Second, Backend: "hybrid"},
+			expectedBackend: fswatcher.HybridBackend,
+			expectedGlobs:   1,
+		},
+	} {
+		opts, err := FileTailerOptions(&test.cfg, log)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.cfg.Backend, err)
+		}
+		if opts.Backend != test.expectedBackend {
+			t.Errorf("expected backend %v but got %v", test.expectedBackend, opts.Backend)
+		}
+		if len(opts.Globs) != test.expectedGlobs {
+			t.Errorf("expected %v globs but got %v", test.expectedGlobs, len(opts.Globs))
+		}
+		if opts.PollInterval != test.cfg.PollInterval {
+			t.Errorf("expected poll interval %v but got %v", test.cfg.PollInterval, opts.PollInterval)
+		}
+	}
+	_, err := FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log"}, Backend: "inotify"}, log)
+	if err == nil {
+		t.Error("expected error for invalid backend")
+	}
+	_, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log"}, Framing: "delimiter"}, log)
+	if err == nil {
+		t.Error("expected error for delimiter framing without delimiter")
+	}
+	opts, err := FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Paths: []string{"/var/log/*.log", "/var/log/*.json"}}, Framings: map[string]string{"/var/log/*.json": "rfc7464"}}, log)
+	if err != nil || len(opts.Framers) != 1 || opts.Framers[opts.Globs[1]] == nil || opts.Framer != nil {
+		t.Errorf("unexpected framers %v: %v", opts.Framers, err)
+	}
+	_, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log"}, Framings: map[string]string{"/var/log/*.log": "delimiter"}}, log)
+	if err == nil {
+		t.Error("expected error for per-path delimiter framing without delimiter")
+	}
+	_, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log", PathRegex: "app-[0-9"}}, log)
+	if err == nil {
+		t.Error("expected error for invalid path_regex")
+	}
+	opts, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log", Exclude: []string{"*-debug.log"}, PathRegex: "app"}}, log)
+	if err != nil || len(opts.Exclude) != 1 || opts.PathMatcher == nil {
+		t.Errorf("unexpected exclude options %v, %v: %v", opts.Exclude, opts.PathMatcher, err)
+	}
+	opts, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log"}, Encoding: "UTF-16LE", InvalidEncoding: "skip"}, log)
+	if err != nil || opts.Encoding != fswatcher.UTF16LE || opts.InvalidEncodingPolicy != fswatcher.SkipInvalid {
+		t.Errorf("unexpected encoding options %v, %v: %v", opts.Encoding, opts.InvalidEncodingPolicy, err)
+	}
+	opts, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Paths: []string{"/var/log/*.log", "/var/log/*.csv"}}, Encodings: map[string]string{"/var/log/*.csv": "latin1"}}, log)
+	if err != nil || len(opts.Encodings) != 1 || opts.Encodings[opts.Globs[1]] != fswatcher.Latin1 {
+		t.Errorf("unexpected encodings %v: %v", opts.Encodings, err)
+	}
+	_, err = FileTailerOptions(&configuration.InputConfig{PathsAndGlobs: configuration.PathsAndGlobs{Path: "/var/log/*.log"}, Encodings: map[string]string{"/var/log/*.csv": "latin1"}}, log)
+	if err == nil {
+		t.Error("expected error for encoding of a path that is not configured")
+	}
+}
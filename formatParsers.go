@@ -0,0 +1,390 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"fmt"
+	configuration "github.com/jdrews/go-tailer/config"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parser for a well-known log format, returns the fields of a line.
+type formatParser func(line *fswatcher.Line) (map[string]interface{}, error)
+
+var formatParsers = map[string]formatParser{
+	"nginx_combined":  parseCombinedLog,
+	"apache_combined": parseCombinedLog,
+	"apache_common":   parseCommonLog,
+	"syslog_rfc3164":  parseSyslogRFC3164,
+	"syslog_rfc5424":  parseSyslogRFC5424,
+	"go_log":          parseGoLog,
+	"java_log":        parseJavaLog,
+}
+
+// FormatNames returns the names of the formats supported by FormatParser(), sorted alphabetically.
+func FormatNames() []string {
+	names := make([]string, 0, len(formatParsers))
+	for name := range formatParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatParser creates a Processor that adds the fields of a well-known log format to Line.Extra:
+//
+//   - nginx_combined, apache_combined, and apache_common: remote_addr, remote_user, time, request, method, path,
+//     protocol, status (int), and bytes (int64). The combined format adds referer and user_agent.
+//   - syslog_rfc3164: time, hostname, app_name, proc_id, and message. If the line starts with a priority like <34>,
+//     priority, facility, and severity (int) are added as well. The timestamp may be RFC 3339, like in /var/log/syslog
+//     on current distributions. Otherwise the year is not part of the line, and is inferred from Line.ReadTime.
+//   - syslog_rfc5424: priority, facility, severity, version (int), time, hostname, app_name, proc_id, msg_id,
+//     structured_data (map[string]map[string]string), and message. Nil values "-" are not added.
+//   - go_log: time, file, line (int), and message, for lines written by the standard log package.
+//   - java_log: time, level, thread, logger, and message, for lines like 2026-01-02 10:00:00,123 INFO [main] com.example.App - started.
+//
+// Timestamps are time.Time. Fields that are not part of a line, like the bytes of a response without body, are not added.
+// Lines that cannot be parsed are reported as ProcessorError and passed on unchanged.
+// The parsers work with lines from any tailer, use ForFiles() or FormatPipeline() to select the format per file.
+func FormatParser(name string) (Processor, error) {
+	parse, exists := formatParsers[name]
+	if !exists {
+		return nil, fmt.Errorf("%q: invalid format, expected one of \"%v\"", name, strings.Join(FormatNames(), "\", \""))
+	}
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		parsed, err := parse(line)
+		if err != nil {
+			return line, err
+		}
+		fields, err := extraFields(line)
+		if err != nil {
+			return line, err
+		}
+		for key, value := range parsed {
+			fields[key] = value
+		}
+		return line, nil
+	}), nil
+}
+
+// FormatPipeline maps the format and formats of the input config onto a Pipeline, see FormatParser().
+// The keys of cfg.Formats are file name patterns or globs, like cfg.Exclude. Files matching more than one
+// pattern use the first pattern in alphabetical order. Lines from other files use cfg.Format.
+// The result is empty if no format is configured.
+func FormatPipeline(cfg *configuration.InputConfig) (Pipeline, error) {
+	var (
+		parsers  = make(map[string]Processor, len(cfg.Formats))
+		fallback Processor
+		err      error
+	)
+	for pattern, format := range cfg.Formats {
+		parsers[pattern], err = FormatParser(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	if len(cfg.Format) > 0 {
+		fallback, err = FormatParser(cfg.Format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input configuration: %v", err)
+		}
+	}
+	return filePatternPipeline(parsers, fallback)
+}
+
+var (
+	commonLogRegex   = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^]]+)] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)`)
+	combinedLogRegex = regexp.MustCompile(commonLogRegex.String() + ` "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"`)
+	javaLogRegex     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?)\s+(?:(\w+)\s+\[([^]]*)]|\[([^]]*)]\s+(\w+))\s+(\S+)\s+-\s?(.*)$`)
+	goLogRegex       = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) (?:(\S+\.go):(\d+): )?(.*)$`)
+	syslogPriRegex   = regexp.MustCompile(`^<(\d{1,3})>`)
+	rfc3164Regex     = regexp.MustCompile(`^(\w{3} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) ([^:\[\s]+)(?:\[([^]]*)])?: ?(.*)$`)
+)
+
+func parseCommonLog(line *fswatcher.Line) (map[string]interface{}, error) {
+	match := commonLogRegex.FindStringSubmatch(line.Line)
+	if match == nil {
+		return nil, fmt.Errorf("line is not in common log format")
+	}
+	return commonLogFields(match)
+}
+
+func parseCombinedLog(line *fswatcher.Line) (map[string]interface{}, error) {
+	match := combinedLogRegex.FindStringSubmatch(line.Line)
+	if match == nil {
+		return nil, fmt.Errorf("line is not in combined log format")
+	}
+	fields, err := commonLogFields(match)
+	if err != nil {
+		return nil, err
+	}
+	setUnlessNil(fields, "referer", match[7])
+	setUnlessNil(fields, "user_agent", match[8])
+	return fields, nil
+}
+
+func commonLogFields(match []string) (map[string]interface{}, error) {
+	timestamp, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	status, _ := strconv.Atoi(match[5]) // three digits
+	fields := map[string]interface{}{
+		"remote_addr": match[1],
+		"time":        timestamp,
+		"request":     match[4],
+		"status":      status,
+	}
+	setUnlessNil(fields, "remote_user", match[2])
+	if request := strings.Fields(match[4]); len(request) == 3 {
+		fields["method"] = request[0]
+		fields["path"] = request[1]
+		fields["protocol"] = request[2]
+	}
+	if match[6] != "-" {
+		bytes, err := strconv.ParseInt(match[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of bytes: %v", err)
+		}
+		fields["bytes"] = bytes
+	}
+	return fields, nil
+}
+
+func setUnlessNil(fields map[string]interface{}, name string, value string) {
+	if len(value) > 0 && value != "-" {
+		fields[name] = value
+	}
+}
+
+// Parses the priority at the start of a syslog line, and returns the rest of the line.
+func parseSyslogPriority(s string, fields map[string]interface{}) (string, error) {
+	match := syslogPriRegex.FindStringSubmatch(s)
+	if match == nil {
+		return s, nil
+	}
+	priority, _ := strconv.Atoi(match[1]) // up to three digits
+	if priority > 191 {
+		return s, fmt.Errorf("invalid syslog priority %v", priority)
+	}
+	fields["priority"] = priority
+	fields["facility"] = priority / 8
+	fields["severity"] = priority % 8
+	return s[len(match[0]):], nil
+}
+
+func parseSyslogRFC3164(line *fswatcher.Line) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	rest, err := parseSyslogPriority(line.Line, fields)
+	if err != nil {
+		return nil, err
+	}
+	match := rfc3164Regex.FindStringSubmatch(rest)
+	if match == nil {
+		return nil, fmt.Errorf("line is not in rfc3164 syslog format")
+	}
+	var timestamp time.Time
+	if strings.Contains(match[1], "T") {
+		timestamp, err = time.Parse(time.RFC3339Nano, match[1])
+	} else {
+		timestamp, err = parseSyslogStamp(match[1], line.ReadTime)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	fields["time"] = timestamp
+	fields["hostname"] = match[2]
+	fields["app_name"] = match[3]
+	setUnlessNil(fields, "proc_id", match[4])
+	fields["message"] = match[5]
+	return fields, nil
+}
+
+// Parses a timestamp without year, like Jan  2 15:04:05, in local time.
+// The year is the year of readTime, or of the previous year if the timestamp would be more than a day after readTime.
+func parseSyslogStamp(s string, readTime time.Time) (time.Time, error) {
+	if readTime.IsZero() {
+		readTime = time.Now()
+	}
+	timestamp, err := time.ParseInLocation(time.Stamp, s, time.Local)
+	if err != nil {
+		return timestamp, err
+	}
+	// time.Date() instead of AddDate(), because AddDate() would turn Feb 29 into Mar 1 in years that are not leap years.
+	withYear := func(year int) time.Time {
+		return time.Date(year, timestamp.Month(), timestamp.Day(), timestamp.Hour(), timestamp.Minute(), timestamp.Second(), timestamp.Nanosecond(), time.Local)
+	}
+	result := withYear(readTime.Year())
+	if result.After(readTime.Add(24 * time.Hour)) {
+		result = withYear(readTime.Year() - 1)
+	}
+	return result, nil
+}
+
+func parseSyslogRFC5424(line *fswatcher.Line) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	rest, err := parseSyslogPriority(line.Line, fields)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := fields["priority"]; !exists {
+		return nil, fmt.Errorf("line is not in rfc5424 syslog format: missing priority")
+	}
+	// VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+	header := strings.SplitN(rest, " ", 7)
+	if len(header) < 7 {
+		return nil, fmt.Errorf("line is not in rfc5424 syslog format: incomplete header")
+	}
+	version, err := strconv.Atoi(header[0])
+	if err != nil {
+		return nil, fmt.Errorf("line is not in rfc5424 syslog format: invalid version %q", header[0])
+	}
+	fields["version"] = version
+	if header[1] != "-" {
+		timestamp, err := time.Parse(time.RFC3339Nano, header[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %v", err)
+		}
+		fields["time"] = timestamp
+	}
+	setUnlessNil(fields, "hostname", header[2])
+	setUnlessNil(fields, "app_name", header[3])
+	setUnlessNil(fields, "proc_id", header[4])
+	setUnlessNil(fields, "msg_id", header[5])
+	structuredData, message, err := parseStructuredData(header[6])
+	if err != nil {
+		return nil, err
+	}
+	if structuredData != nil {
+		fields["structured_data"] = structuredData
+	}
+	if strings.HasPrefix(message, " ") {
+		message = strings.TrimPrefix(message[1:], "\ufeff")
+		fields["message"] = message
+	} else if len(message) > 0 {
+		return nil, fmt.Errorf("line is not in rfc5424 syslog format: missing space after structured data")
+	}
+	return fields, nil
+}
+
+// Parses the structured data of an RFC 5424 line, like [id param="value"][id2 param="value"],
+// and returns the rest of the line. The result is nil if there is no structured data.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return nil, s[1:], nil
+	}
+	result := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", fmt.Errorf("invalid structured data: missing ']'")
+		}
+		params := make(map[string]string)
+		result[s[1:end]] = params
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return nil, "", fmt.Errorf("invalid structured data: expected param=\"value\"")
+			}
+			name := s[:eq]
+			value, n, err := parseParamValue(s[eq+2:])
+			if err != nil {
+				return nil, "", err
+			}
+			params[name] = value
+			s = s[eq+2+n:]
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("invalid structured data: missing ']'")
+		}
+		s = s[1:]
+	}
+	if len(result) == 0 {
+		return nil, "", fmt.Errorf("invalid structured data: expected '-' or '['")
+	}
+	return result, s, nil
+}
+
+// Parses a param value after the opening quote, and returns the value and the number of bytes including the closing quote.
+// Inside the value, '"', '\' and ']' are escaped with '\'.
+func parseParamValue(s string) (string, int, error) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return value.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+			}
+		}
+		value.WriteByte(s[i])
+	}
+	return "", 0, fmt.Errorf("invalid structured data: missing '\"'")
+}
+
+func parseGoLog(line *fswatcher.Line) (map[string]interface{}, error) {
+	match := goLogRegex.FindStringSubmatch(line.Line)
+	if match == nil {
+		return nil, fmt.Errorf("line is not in go log format")
+	}
+	timestamp, err := time.ParseInLocation("2006/01/02 15:04:05", match[1], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	fields := map[string]interface{}{
+		"time":    timestamp,
+		"message": match[4],
+	}
+	if len(match[2]) > 0 {
+		lineNumber, err := strconv.Atoi(match[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid line number: %v", err)
+		}
+		fields["file"] = match[2]
+		fields["line"] = lineNumber
+	}
+	return fields, nil
+}
+
+func parseJavaLog(line *fswatcher.Line) (map[string]interface{}, error) {
+	match := javaLogRegex.FindStringSubmatch(line.Line)
+	if match == nil {
+		return nil, fmt.Errorf("line is not in java log format")
+	}
+	// Java uses ',' as decimal separator in the default log4j pattern, time.Parse() accepts both.
+	timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", strings.Replace(match[1], "T", " ", 1), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	level, thread := match[2], match[3]
+	if len(level) == 0 {
+		level, thread = match[5], match[4]
+	}
+	return map[string]interface{}{
+		"time":    timestamp,
+		"level":   level,
+		"thread":  thread,
+		"logger":  match[6],
+		"message": match[7],
+	}, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	configuration "github.com/jdrews/go-tailer/config"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFormatParsers(t *testing.T) {
+	readTime := time.Date(2026, time.January, 2, 12, 0, 0, 0, time.Local)
+	for _, test := range []struct {
+		format   string
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			format: "nginx_combined",
+			line:   `10.0.0.1 - jane [02/Jan/2026:10:00:00 +0100] "GET /index.html?a=b HTTP/1.1" 200 612 "-" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			expected: map[string]interface{}{
+				"remote_addr": "10.0.0.1",
+				"remote_user": "jane",
+				"time":        time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC),
+				"request":     "GET /index.html?a=b HTTP/1.1",
+				"method":      "GET",
+				"path":        "/index.html?a=b",
+				"protocol":    "HTTP/1.1",
+				"status":      200,
+				"bytes":       int64(612),
+				"user_agent":  "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+		},
+		{
+			format: "apache_common",
+			line:   `::1 - - [02/Jan/2026:10:00:00 +0000] "\x16\x03" 400 -`,
+			expected: map[string]interface{}{
+				"remote_addr": "::1",
+				"time":        time.Date(2026, time.January, 2, 10, 0, 0, 0, time.UTC),
+				"request":     `\x16\x03`,
+				"status":      400,
+			},
+		},
+		{
+			format: "syslog_rfc3164",
+			line:   "<34>Jan  2 11:00:00 myhost sshd[4321]: Failed password for root",
+			expected: map[string]interface{}{
+				"priority": 34,
+				"facility": 4,
+				"severity": 2,
+				"time":     time.Date(2026, time.January, 2, 11, 0, 0, 0, time.Local),
+				"hostname": "myhost",
+				"app_name": "sshd",
+				"proc_id":  "4321",
+				"message":  "Failed password for root",
+			},
+		},
+		{
+			// logged on Dec 31, read on Jan 2
+			format: "syslog_rfc3164",
+			line:   "Dec 31 23:59:59 myhost kernel: shutting down",
+			expected: map[string]interface{}{
+				"time":     time.Date(2025, time.December, 31, 23, 59, 59, 0, time.Local),
+				"hostname": "myhost",
+				"app_name": "kernel",
+				"message":  "shutting down",
+			},
+		},
+		{
+			format: "syslog_rfc3164",
+			line:   "2026-01-02T10:00:00.123456+00:00 myhost systemd[1]: Started Daily apt upgrade.",
+			expected: map[string]interface{}{
+				"time":     time.Date(2026, time.January, 2, 10, 0, 0, 123456000, time.UTC),
+				"hostname": "myhost",
+				"app_name": "systemd",
+				"proc_id":  "1",
+				"message":  "Started Daily apt upgrade.",
+			},
+		},
+		{
+			format: "syslog_rfc5424",
+			line:   `<165>1 2026-01-02T10:00:00.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\"lication"][meta seq="1"] ` + "\ufeff" + `An application event`,
+			expected: map[string]interface{}{
+				"priority": 165,
+				"facility": 20,
+				"severity": 5,
+				"version":  1,
+				"time":     time.Date(2026, time.January, 2, 10, 0, 0, 3000000, time.UTC),
+				"hostname": "mymachine.example.com",
+				"app_name": "evntslog",
+				"msg_id":   "ID47",
+				"structured_data": map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": `App"lication`},
+					"meta":              {"seq": "1"},
+				},
+				"message": "An application event",
+			},
+		},
+		{
+			format: "syslog_rfc5424",
+			line:   "<13>1 - - - - - -",
+			expected: map[string]interface{}{
+				"priority": 13,
+				"facility": 1,
+				"severity": 5,
+				"version":  1,
+			},
+		},
+		{
+			format: "go_log",
+			line:   "2026/01/02 10:00:00.123456 main.go:42: listening on :8080",
+			expected: map[string]interface{}{
+				"time":    time.Date(2026, time.January, 2, 10, 0, 0, 123456000, time.Local),
+				"file":    "main.go",
+				"line":    42,
+				"message": "listening on :8080",
+			},
+		},
+		{
+			format: "java_log",
+			line:   "2026-01-02 10:00:00,123 ERROR [http-nio-8080-exec-1] com.example.OrderService - order failed",
+			expected: map[string]interface{}{
+				"time":    time.Date(2026, time.January, 2, 10, 0, 0, 123000000, time.Local),
+				"level":   "ERROR",
+				"thread":  "http-nio-8080-exec-1",
+				"logger":  "com.example.OrderService",
+				"message": "order failed",
+			},
+		},
+		{
+			format: "java_log",
+			line:   "2026-01-02 10:00:00.123 [main] INFO  c.e.Application - Started Application",
+			expected: map[string]interface{}{
+				"time":    time.Date(2026, time.January, 2, 10, 0, 0, 123000000, time.Local),
+				"level":   "INFO",
+				"thread":  "main",
+				"logger":  "c.e.Application",
+				"message": "Started Application",
+			},
+		},
+	} {
+		processor, err := FormatParser(test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := processor.Process(&fswatcher.Line{Line: test.line, ReadTime: readTime})
+		if err != nil {
+			t.Fatalf("%v: %q: unexpected error: %v", test.format, test.line, err)
+		}
+		if !reflect.DeepEqual(normalizeTimes(line.Extra), normalizeTimes(test.expected)) {
+			t.Fatalf("%v: %q: expected %v, but got %v", test.format, test.line, test.expected, line.Extra)
+		}
+	}
+}
+
+// Syslog timestamps have no year, Feb 29 must not become Mar 1.
+func TestSyslogStampLeapDay(t *testing.T) {
+	for _, test := range []struct {
+		readTime time.Time
+		expected time.Time
+	}{
+		{time.Date(2024, time.February, 29, 12, 0, 0, 0, time.Local), time.Date(2024, time.February, 29, 10, 0, 0, 0, time.Local)},
+		{time.Date(2028, time.March, 1, 12, 0, 0, 0, time.Local), time.Date(2028, time.February, 29, 10, 0, 0, 0, time.Local)},
+		{time.Date(2025, time.January, 2, 12, 0, 0, 0, time.Local), time.Date(2024, time.February, 29, 10, 0, 0, 0, time.Local)},
+	} {
+		timestamp, err := parseSyslogStamp("Feb 29 10:00:00", test.readTime)
+		if err != nil || !timestamp.Equal(test.expected) {
+			t.Fatalf("read at %v: expected %v, but got %v and error %v", test.readTime, test.expected, timestamp, err)
+		}
+	}
+}
+
+// Compares times with Equal() instead of reflect.DeepEqual().
+func normalizeTimes(extra interface{}) interface{} {
+	fields, ok := extra.(map[string]interface{})
+	if !ok {
+		return extra
+	}
+	result := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if timestamp, ok := value.(time.Time); ok {
+			value = timestamp.UTC()
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func TestFormatParserErrors(t *testing.T) {
+	for _, format := range FormatNames() {
+		processor, err := FormatParser(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := processor.Process(&fswatcher.Line{Line: "\tat com.example.Main.main(Main.java:5)"})
+		if err == nil || line == nil || line.Extra != nil {
+			t.Fatalf("%v: expected an error and the unchanged line, but got %v and error %v.", format, line, err)
+		}
+	}
+	if _, err := FormatParser("nginx"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestFormatPipeline(t *testing.T) {
+	pipeline, err := FormatPipeline(&configuration.InputConfig{
+		Format:  "go_log",
+		Formats: map[string]string{"access.log": "nginx_combined"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := pipeline.Process(&fswatcher.Line{File: "/var/log/nginx/access.log", Line: `10.0.0.1 - - [02/Jan/2026:10:00:00 +0000] "GET / HTTP/1.1" 304 0 "-" "curl/8.5.0"`})
+	if err != nil || line.Extra.(map[string]interface{})["status"] != 304 {
+		t.Fatalf("expected an nginx line, but got %v and error %v", line, err)
+	}
+	// lines from the webhook or kafka tailer use the default format
+	line, err = pipeline.Process(&fswatcher.Line{Line: "2026/01/02 10:00:00 started"})
+	if err != nil || line.Extra.(map[string]interface{})["message"] != "started" {
+		t.Fatalf("expected a go log line, but got %v and error %v", line, err)
+	}
+	pipeline, err = FormatPipeline(&configuration.InputConfig{})
+	if err != nil || len(pipeline) != 0 {
+		t.Fatalf("expected an empty pipeline, but got %v and error %v", pipeline, err)
+	}
+	if _, err = FormatPipeline(&configuration.InputConfig{Formats: map[string]string{"*.log": "unknown"}}); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The default interval for flushing checkpoints while the tailer is running.
+// Checkpoints are flushed on shutdown in any case.
+const DefaultCheckpointInterval = 5 * time.Second
+
+// Checkpoint is the read position of a watched file.
+// Device, Inode and Fingerprint identify the file, so that we don't resume a file at the
+// offset of another file that was created under the same path in the meantime.
+// Compressed files are checkpointed when they were read completely. They are identified by Fingerprint only,
+// so that they are not read again after being renamed.
+type Checkpoint struct {
+	Path              string `json:"path"`
+	Device            uint64 `json:"device"`
+	Inode             uint64 `json:"inode"`
+	Offset            int64  `json:"offset"`                       // start of the first line that was not yet sent to the Lines() channel
+	Fingerprint       uint64 `json:"fingerprint,omitempty"`        // hash of the first FingerprintLength bytes of the file
+	FingerprintLength int    `json:"fingerprint_length,omitempty"` // zero if there is no fingerprint
+	Compressed        bool   `json:"compressed,omitempty"`         // true for a compressed file that was read completely, Offset is unused
+}
+
+// CheckpointStore persists the read positions of the file tailer across restarts.
+// Load() is called once when the tailer starts, Save() is called periodically
+// and when the tailer shuts down. Save() always gets the full list of checkpoints,
+// files that are no longer watched are not included.
+type CheckpointStore interface {
+	Load() ([]Checkpoint, error)
+	Save(checkpoints []Checkpoint) error
+}
+
+type checkpointFile struct {
+	path string
+}
+
+// NewCheckpointFile creates a CheckpointStore writing checkpoints as JSON to path.
+// The file is replaced atomically, so a crash while saving will leave the previous checkpoints intact.
+// A missing file is not an error, it means that there are no checkpoints yet.
+func NewCheckpointFile(path string) CheckpointStore {
+	return &checkpointFile{path: path}
+}
+
+func (s *checkpointFile) Load() ([]Checkpoint, error) {
+	var result []Checkpoint
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%v: failed to read checkpoints: %v", s.path, err)
+	}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("%v: failed to parse checkpoints: %v", s.path, err)
+	}
+	return result, nil
+}
+
+func (s *checkpointFile) Save(checkpoints []Checkpoint) error {
+	if checkpoints == nil {
+		checkpoints = []Checkpoint{}
+	}
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%v: failed to serialize checkpoints: %v", s.path, err)
+	}
+	// Write to a temporary file in the same directory and rename it,
+	// because rename() is atomic if source and target are on the same file system.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("%v: failed to create temporary checkpoint file: %v", s.path, err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%v: failed to write checkpoints: %v", tmp.Name(), err)
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%v: failed to replace checkpoint file: %v", s.path, err)
+	}
+	return nil
+}
+
+// Returns the current read positions of all watched files.
+func (t *fileTailer) checkpoints() ([]Checkpoint, Error) {
+	result := make([]Checkpoint, 0, len(t.watchedFiles)+len(t.savedCheckpoints)+len(t.compressedFiles)+len(t.savedCompressed))
+	// If we are shut down during initialization, keep the checkpoints of files that we did not open yet.
+	for _, checkpoint := range t.savedCheckpoints {
+		result = append(result, checkpoint)
+	}
+	for _, checkpoint := range t.savedCompressed {
+		result = append(result, checkpoint)
+	}
+	for _, checkpoint := range t.compressedFiles {
+		if checkpoint != nil {
+			result = append(result, *checkpoint)
+		}
+	}
+	for path, file := range t.watchedFiles {
+		stat, err := statFile(file.file)
+		if err != nil {
+			return nil, NewErrorf(NotSpecified, err, "%v: stat failed", path)
+		}
+		offset := file.reader.Offset()
+		if pendingOffset, exists := t.pendingOffsets[file]; exists {
+			offset = pendingOffset // The reader is past lines that were not yet sent.
+		}
+		result = append(result, Checkpoint{
+			Path:              path,
+			Device:            stat.device,
+			Inode:             stat.inode,
+			Offset:            offset,
+			Fingerprint:       file.id.fingerprint,
+			FingerprintLength: file.id.fingerprintLength,
+		})
+	}
+	return result, nil
+}
+
+func (t *fileTailer) saveCheckpoints() Error {
+	if t.checkpointStore == nil {
+		return nil
+	}
+	checkpoints, Err := t.checkpoints()
+	if Err != nil {
+		return Err
+	}
+	err := t.checkpointStore.Save(checkpoints)
+	if err != nil {
+		return NewError(NotSpecified, err, "failed to save checkpoints")
+	}
+	return nil
+}
+
+// Returns the offset where reading should be resumed, or -1 if there is no checkpoint for the file.
+// Each checkpoint is used only once, i.e. only when the file is opened for the first time after startup.
+func (t *fileTailer) popCheckpoint(path string, stat fileStat, file io.ReaderAt) int64 {
+	checkpoint, exists := t.savedCheckpoints[path]
+	if !exists {
+		return -1
+	}
+	delete(t.savedCheckpoints, path)
+	if stat.device != checkpoint.Device || stat.inode != checkpoint.Inode || checkpoint.Offset > stat.size {
+		// The file was replaced or truncated while we were not running.
+		return -1
+	}
+	if checkpoint.FingerprintLength > 0 {
+		fingerprint, length, err := readFingerprint(file, checkpoint.FingerprintLength)
+		if err != nil || length != checkpoint.FingerprintLength || fingerprint != checkpoint.Fingerprint {
+			// The inode was re-used for a new file, or the file was truncated and rewritten.
+			return -1
+		}
+	}
+	return checkpoint.Offset
+}
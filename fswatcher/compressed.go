@@ -0,0 +1,190 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"time"
+)
+
+// decompressor reads a compressed file format identified by magic bytes at the start of the file.
+type decompressor struct {
+	name      string
+	extension string // file name extension, used to detect files that are not completely written yet
+	magic     []byte
+	matches   func(header []byte) bool                 // additional check of the header after the magic bytes matched, may be nil
+	newReader func(r io.Reader) (io.ReadCloser, error) // nil if the format is not supported in this build
+}
+
+var decompressors = []*decompressor{
+	{
+		name:      "gzip",
+		extension: ".gz",
+		magic:     []byte{0x1f, 0x8b},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		name:      "bzip2",
+		extension: ".bz2",
+		magic:     []byte("BZh"),
+		matches: func(header []byte) bool {
+			// "BZh" is a common start of a text line, so we also check the block size
+			// and the magic of the first block, or of the end of stream if the stream is empty.
+			return len(header) >= 10 && header[3] >= '1' && header[3] <= '9' &&
+				(bytes.Equal(header[4:10], []byte("1AY&SY")) || bytes.Equal(header[4:10], []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}))
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+	zstdDecompressor, // zstd support requires the zstd build tag, see compressed_zstd.go
+}
+
+// The headers checked by all supported formats are at most this long.
+const maxMagicLen = 10
+
+// incompleteCompressedFile is returned by detectCompression() for files that are too short to detect the format,
+// but whose name says that they are compressed. logrotate creates x.log.1.gz empty and writes the compressed data
+// afterwards, so these files must not be tailed as text. They are skipped like compressed files created at runtime.
+var incompleteCompressedFile = &decompressor{name: "incomplete"}
+
+// Reads the first bytes of file and returns the decompressor for the file format, or nil if the file is not compressed.
+// The caller must seek the file back to the start.
+func detectCompression(file io.Reader, path string) (*decompressor, error) {
+	header := make([]byte, maxMagicLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	for _, d := range decompressors {
+		if bytes.HasPrefix(header[:n], d.magic) && (d.matches == nil || d.matches(header[:n])) {
+			return d, nil
+		}
+	}
+	if n < maxMagicLen {
+		for _, d := range decompressors {
+			if strings.HasSuffix(strings.ToLower(path), d.extension) {
+				return incompleteCompressedFile, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Key of a compressed file that was read completely. Compressed files are identified by fingerprint rather than path,
+// because rotated archives are often renamed, like test.log.1.gz -> test.log.2.gz.
+type compressedKey struct {
+	fingerprint       uint64
+	fingerprintLength int
+}
+
+// Reads a compressed file during backfill, unless a checkpoint shows that it was read completely before.
+// id always contains the fingerprint, even if fingerprints are disabled.
+// Returns the checkpoint for the file if it was read completely, or nil.
+func (t *fileTailer) backfillCompressedFile(file io.Reader, path string, id fileIdentity, d *decompressor, log logrus.FieldLogger) (*Checkpoint, Error) {
+	checkpoint := &Checkpoint{
+		Path:              path,
+		Device:            id.device,
+		Inode:             id.inode,
+		Compressed:        true,
+		Fingerprint:       id.fingerprint,
+		FingerprintLength: id.fingerprintLength,
+	}
+	key := compressedKey{fingerprint: id.fingerprint, fingerprintLength: id.fingerprintLength}
+	if _, exists := t.savedCompressed[key]; exists {
+		delete(t.savedCompressed, key)
+		log.Debugf("skipping %v compressed file, because it was read completely before", d.name)
+		return checkpoint, nil
+	}
+	if t.fingerprintSize <= 0 {
+		id.fingerprint, id.fingerprintLength = 0, 0
+	}
+	finished, Err := t.readCompressedFile(file, path, id, d, log)
+	if !finished {
+		return nil, Err
+	}
+	return checkpoint, nil
+}
+
+// Decompresses file and sends all lines to the lines channel.
+// Compressed files are typically rotated logs, so they are read once during backfill and never tailed.
+// Offsets in the resulting lines refer to the decompressed content.
+// Returns true if all lines were delivered to the consumer.
+func (t *fileTailer) readCompressedFile(file io.Reader, path string, id fileIdentity, d *decompressor, log logrus.FieldLogger) (bool, Error) {
+	if d.newReader == nil {
+		log.Warnf("skipping %v compressed file, because %v support is not included in this build", d.name, d.name)
+		return false, nil
+	}
+	reader, err := d.newReader(file)
+	if err != nil {
+		return false, NewErrorf(NotSpecified, err, "%v: failed to read %v compressed file", path, d.name)
+	}
+	defer reader.Close()
+	log.Infof("reading %v compressed file", d.name)
+	lineReader := t.newLineReader(path)
+	header := t.newFileHeader(path)
+	nLines := 0
+	defer func() {
+		if nLines > 0 {
+			t.metrics.LinesRead(path, nLines, lineReader.Offset())
+		}
+	}()
+	for {
+		offset := lineReader.Offset()
+		line, eof, err := lineReader.ReadLine(reader)
+		if err != nil {
+			return false, NewErrorf(NotSpecified, err, "%v: failed to read %v compressed file", path, d.name)
+		}
+		if eof {
+			// The file is finished, so there will be no line terminator for the last line.
+			line = lineReader.Remainder()
+		}
+		if !t.reportLongLines(lineReader, path) {
+			return false, nil
+		}
+		if eof && len(line) == 0 {
+			// Lines in the current batch are not delivered yet.
+			return t.flushBatch(), nil
+		}
+		nLines++
+		if header != nil && header.add(line) {
+			continue
+		}
+		ok := t.sendLine(nil, Line{
+			Line:        line,
+			File:        path,
+			Offset:      offset,
+			EndOffset:   lineReader.Offset(),
+			LineNumber:  lineReader.LineNumber(),
+			Device:      id.device,
+			Inode:       id.inode,
+			Generation:  id.generation,
+			Fingerprint: id.fingerprint,
+			ReadTime:    time.Now(),
+			Truncated:   lineReader.Truncated(),
+			Header:      headerLines(header),
+		})
+		if !ok {
+			return false, nil
+		}
+	}
+}
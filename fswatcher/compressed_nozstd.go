@@ -0,0 +1,24 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !zstd
+
+package fswatcher
+
+// zstd files are detected, but skipped with a warning. Build with -tags zstd to read them.
+var zstdDecompressor = &decompressor{
+	name:      "zstd",
+	extension: ".zst",
+	magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+}
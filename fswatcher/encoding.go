@@ -0,0 +1,255 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the character encoding of a file. Lines are always converted to UTF-8.
+// If a UTF-8 or UTF-16 file starts with a byte order mark (BOM), the BOM is removed and overrides the configured encoding.
+// Files in single byte encodings are never checked for a BOM, because the BOM bytes are valid characters there.
+type Encoding int
+
+const (
+	UTF8 Encoding = iota
+	UTF16LE
+	UTF16BE
+	// ISO-8859-1
+	Latin1
+	Windows1252
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case UTF8:
+		return "utf-8"
+	case UTF16LE:
+		return "utf-16le"
+	case UTF16BE:
+		return "utf-16be"
+	case Latin1:
+		return "latin1"
+	case Windows1252:
+		return "windows-1252"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+// ParseEncoding parses the String() representation of an Encoding.
+func ParseEncoding(s string) (Encoding, error) {
+	for _, e := range []Encoding{UTF8, UTF16LE, UTF16BE, Latin1, Windows1252} {
+		if strings.EqualFold(s, e.String()) {
+			return e, nil
+		}
+	}
+	return UTF8, fmt.Errorf("%q: invalid encoding, expected one of \"utf-8\", \"utf-16le\", \"utf-16be\", \"latin1\", or \"windows-1252\"", s)
+}
+
+// InvalidEncodingPolicy defines what happens with byte sequences that are invalid in the file's encoding.
+type InvalidEncodingPolicy int
+
+const (
+	// Pass invalid UTF-8 through unchanged. This is the default.
+	// Lines in other encodings cannot keep the original bytes, so invalid sequences are replaced like with ReplaceInvalid.
+	PassInvalid InvalidEncodingPolicy = iota
+	// Replace each invalid sequence with the replacement character U+FFFD.
+	ReplaceInvalid
+	// Remove invalid sequences.
+	SkipInvalid
+)
+
+func (p InvalidEncodingPolicy) String() string {
+	switch p {
+	case PassInvalid:
+		return "pass"
+	case ReplaceInvalid:
+		return "replace"
+	case SkipInvalid:
+		return "skip"
+	default:
+		return fmt.Sprintf("InvalidEncodingPolicy(%d)", int(p))
+	}
+}
+
+// ParseInvalidEncodingPolicy parses the String() representation of an InvalidEncodingPolicy.
+func ParseInvalidEncodingPolicy(s string) (InvalidEncodingPolicy, error) {
+	for _, p := range []InvalidEncodingPolicy{PassInvalid, ReplaceInvalid, SkipInvalid} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return PassInvalid, fmt.Errorf("%q: invalid encoding policy, expected \"pass\", \"replace\", or \"skip\"", s)
+}
+
+var byteOrderMarks = []struct {
+	bom      []byte
+	encoding Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, UTF8},
+	{[]byte{0xFF, 0xFE}, UTF16LE},
+	{[]byte{0xFE, 0xFF}, UTF16BE},
+}
+
+// Returns the length of the BOM at the start of data, and the encoding it indicates.
+// If data is too short to tell, incomplete is true.
+func detectBOM(data []byte) (length int, encoding Encoding, incomplete bool) {
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(data, b.bom) {
+			return len(b.bom), b.encoding, false
+		}
+		if len(data) < len(b.bom) && bytes.HasPrefix(b.bom, data) {
+			incomplete = true
+		}
+	}
+	return 0, UTF8, incomplete
+}
+
+func (e Encoding) isUTF16() bool {
+	return e == UTF16LE || e == UTF16BE
+}
+
+// Single byte encodings have no BOM.
+func (e Encoding) hasBOM() bool {
+	return e == UTF8 || e.isUTF16()
+}
+
+// Converts a line to UTF-8.
+func (e Encoding) decode(line string, policy InvalidEncodingPolicy) string {
+	switch e {
+	case UTF16LE, UTF16BE:
+		return decodeUTF16(line, e == UTF16BE, policy)
+	case Latin1:
+		return decodeSingleByte(line, nil, policy)
+	case Windows1252:
+		return decodeSingleByte(line, &windows1252, policy)
+	default:
+		if policy == PassInvalid || utf8.ValidString(line) {
+			return line
+		}
+		if policy == SkipInvalid {
+			return strings.ToValidUTF8(line, "")
+		}
+		return strings.ToValidUTF8(line, string(utf8.RuneError))
+	}
+}
+
+// Windows-1252 is Latin-1 except for 0x80 - 0x9F. Zero means undefined.
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+func decodeSingleByte(line string, high *[32]rune, policy InvalidEncodingPolicy) string {
+	var result strings.Builder
+	result.Grow(len(line))
+	for i := 0; i < len(line); i++ {
+		r := rune(line[i])
+		if high != nil && r >= 0x80 && r < 0xA0 {
+			r = high[r-0x80]
+			if r == 0 {
+				if policy == SkipInvalid {
+					continue
+				}
+				r = utf8.RuneError
+			}
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+func decodeUTF16(line string, bigEndian bool, policy InvalidEncodingPolicy) string {
+	var result strings.Builder
+	result.Grow(len(line))
+	unit := func(i int) rune {
+		if bigEndian {
+			return rune(line[i])<<8 | rune(line[i+1])
+		}
+		return rune(line[i+1])<<8 | rune(line[i])
+	}
+	writeInvalid := func() {
+		if policy != SkipInvalid {
+			result.WriteRune(utf8.RuneError)
+		}
+	}
+	for i := 0; i+1 < len(line); i += 2 {
+		r := unit(i)
+		if utf16.IsSurrogate(r) {
+			if i+3 < len(line) {
+				if decoded := utf16.DecodeRune(r, unit(i+2)); decoded != utf8.RuneError {
+					result.WriteRune(decoded)
+					i += 2
+					continue
+				}
+			}
+			writeInvalid()
+			continue
+		}
+		result.WriteRune(r)
+	}
+	if len(line)%2 != 0 {
+		// incomplete code unit
+		writeInvalid()
+	}
+	return result.String()
+}
+
+// Splits UTF-16 encoded files into lines. The newline is searched for in 16 bit code units,
+// so that the 0x0A byte of other characters doesn't terminate the line.
+type utf16NewlineFramer struct {
+	bigEndian bool
+}
+
+func (f utf16NewlineFramer) Frame(data []byte, atEOF bool) (int, []byte, error) {
+	for i := 0; i+1 < len(data); i += 2 {
+		if f.isUnit(data[i:], '\n') {
+			line := data[:i]
+			if i >= 2 && f.isUnit(data[i-2:], '\r') {
+				line = data[:i-2]
+			}
+			return i + 2, line, nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Finds the end of a long line, see recordEndFinder. data starts at a code unit boundary.
+func (f utf16NewlineFramer) findRecordEnd(data []byte) (int, int, bool) {
+	for i := 0; i+1 < len(data); i += 2 {
+		if f.isUnit(data[i:], '\n') {
+			if i >= 2 && f.isUnit(data[i-2:], '\r') {
+				return i - 2, i + 2, true
+			}
+			return i, i + 2, true
+		}
+	}
+	return 0, 0, false
+}
+
+func (f utf16NewlineFramer) isUnit(data []byte, c byte) bool {
+	if f.bigEndian {
+		return data[0] == 0 && data[1] == c
+	}
+	return data[0] == c && data[1] == 0
+}
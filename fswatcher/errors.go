@@ -26,8 +26,39 @@ const (
 	// The WinFileRemoved Error should never be seen, because it is handled internally in the FileTailer.
 	// TODO: Refactor error handling such that this is not part of the public interface.
 	WinFileRemoved
+
+	// LineTooLong errors are warnings, the FileTailer keeps running after reporting them. See LineTooLongError.
+	LineTooLong
+
+	// LinesDropped errors are warnings reported by the buffered tailer when lines are dropped because the buffer is full.
+	LinesDropped
+
+	// ProcessingFailed errors are warnings reported by the pipeline tailer when a processor fails.
+	ProcessingFailed
 )
 
+// String returns the error type in snake case, like "file_not_found". It is used as a metric label.
+func (t ErrorType) String() string {
+	switch t {
+	case NotSpecified:
+		return "not_specified"
+	case DirectoryNotFound:
+		return "directory_not_found"
+	case FileNotFound:
+		return "file_not_found"
+	case WinFileRemoved:
+		return "win_file_removed"
+	case LineTooLong:
+		return "line_too_long"
+	case LinesDropped:
+		return "lines_dropped"
+	case ProcessingFailed:
+		return "processing_failed"
+	default:
+		return fmt.Sprintf("ErrorType(%d)", int(t))
+	}
+}
+
 type Error interface {
 	Cause() error
 	Type() ErrorType
@@ -71,3 +102,24 @@ func (e tailerError) Error() string {
 		return "unknown error"
 	}
 }
+
+// LineTooLongError is reported when a line exceeds Options.MaxLineLength.
+type LineTooLongError struct {
+	File      string
+	Offset    int64 // offset of the first byte of the line
+	Length    int64 // length of the line in bytes, not including the line terminator
+	Discarded int64 // number of bytes that were not emitted because of the LongLinePolicy
+	Policy    LongLinePolicy
+}
+
+func (e *LineTooLongError) Cause() error {
+	return nil
+}
+
+func (e *LineTooLongError) Type() ErrorType {
+	return LineTooLong
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("%v: line at offset %v exceeds the max line length: line length %v bytes, policy %v, %v bytes discarded", e.File, e.Offset, e.Length, e.Policy, e.Discarded)
+}
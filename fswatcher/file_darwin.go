@@ -15,6 +15,7 @@
 package fswatcher
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"syscall"
@@ -56,6 +57,22 @@ func NewFile(orig *os.File, newPath string) (*os.File, error) {
 	return os.NewFile(uintptr(fd), newPath), nil
 }
 
+func statFile(file *os.File) (fileStat, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fileStat{}, err
+	}
+	sys, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, fmt.Errorf("%v: unexpected stat result of type %T", file.Name(), fileInfo.Sys())
+	}
+	return fileStat{
+		device: uint64(sys.Dev),
+		inode:  sys.Ino,
+		size:   fileInfo.Size(),
+	}, nil
+}
+
 func open(path string) (*os.File, Error) {
 	file, err := os.Open(path)
 	if err != nil {
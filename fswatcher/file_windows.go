@@ -146,6 +146,16 @@ func (f *File) Read(b []byte) (int, error) {
 	return result, resultErr
 }
 
+// ReadAt doesn't change the current position, like os.File.ReadAt().
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	file, Err := f.reopen()
+	if Err != nil {
+		return 0, Err
+	}
+	defer file.Close()
+	return file.ReadAt(b, off)
+}
+
 func (f *File) Name() string {
 	return f.path
 }
@@ -172,6 +182,24 @@ func (f *File) CheckTruncated() (bool, Error) {
 	return f.currentPos > fileInfo.Size(), nil
 }
 
+// The file index is unique per volume. We don't know the volume serial number, so device is always 0.
+func statFile(f *File) (fileStat, error) {
+	file, Err := f.reopen()
+	if Err != nil {
+		return fileStat{}, Err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fileStat{}, NewError(NotSpecified, os.NewSyscallError("stat", err), f.Name())
+	}
+	return fileStat{
+		device: 0,
+		inode:  uint64(f.fileIndexHigh)<<32 | uint64(f.fileIndexLow),
+		size:   fileInfo.Size(),
+	}, nil
+}
+
 func (f *File) CheckMoved() (bool, error) {
 	// As this implementation closes the file after each operation, we don't need special treatment for moved files.
 	// We can just pretend the file is never moved.
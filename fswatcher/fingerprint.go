@@ -0,0 +1,111 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"github.com/sirupsen/logrus"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+// The default for Options.FingerprintSize.
+const DefaultFingerprintSize = 1024
+
+// Returns the FNV-1a hash of the first size bytes of file, and the number of bytes hashed,
+// which is less than size if the file is shorter.
+func readFingerprint(file io.ReaderAt, size int) (uint64, int, error) {
+	buf := make([]byte, size)
+	n, err := file.ReadAt(buf, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return fingerprint(buf[:n]), n, nil
+}
+
+func fingerprint(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// Sets the fingerprint of a new or truncated file.
+func (t *fileTailer) initFingerprint(file *fileWithReader) error {
+	if t.fingerprintSize <= 0 {
+		return nil
+	}
+	var err error
+	file.id.fingerprint, file.id.fingerprintLength, err = readFingerprint(file.file, t.fingerprintSize)
+	return err
+}
+
+// Returns true if the first bytes of the file changed since the fingerprint was taken,
+// which means that the file was truncated and rewritten, or that the inode was re-used for a new file.
+// While the file is shorter than the fingerprint size, the fingerprint is extended as the file grows.
+func (t *fileTailer) fingerprintChanged(file *fileWithReader) (bool, Error) {
+	if t.fingerprintSize <= 0 {
+		return false, nil
+	}
+	buf := make([]byte, t.fingerprintSize)
+	n, err := file.file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		if Err, ok := err.(Error); ok {
+			return false, Err
+		}
+		return false, NewErrorf(NotSpecified, os.NewSyscallError("read", err), "%v: failed to read fingerprint", file.file.Name())
+	}
+	if n < file.id.fingerprintLength || fingerprint(buf[:file.id.fingerprintLength]) != file.id.fingerprint {
+		return true, nil
+	}
+	if n > file.id.fingerprintLength {
+		file.id.fingerprint, file.id.fingerprintLength = fingerprint(buf[:n]), n
+	}
+	return false, nil
+}
+
+// Like isTruncated(), but also detects files that were truncated and then written past the read position
+// before we noticed, because the fingerprint changed.
+func (t *fileTailer) isTruncated(file *fileWithReader) (bool, error) {
+	truncated, err := isTruncated(file.file)
+	if err != nil {
+		return false, err
+	}
+	if truncated {
+		return true, nil
+	}
+	changed, Err := t.fingerprintChanged(file)
+	if Err != nil {
+		return false, Err
+	}
+	return changed, nil
+}
+
+// Seeks a watched file to the start and starts a new generation if its fingerprint changed.
+func (t *fileTailer) restartIfFingerprintChanged(file *fileWithReader, log logrus.FieldLogger) (bool, Error) {
+	changed, Err := t.fingerprintChanged(file)
+	if Err != nil || !changed {
+		return false, Err
+	}
+	log.Info("the first bytes of the file changed, reading it from the start")
+	_, err := file.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, NewError(NotSpecified, os.NewSyscallError("seek", err), file.file.Name())
+	}
+	t.restartTruncatedFile(file)
+	return true, nil
+}
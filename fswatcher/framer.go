@@ -0,0 +1,231 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A Framer splits a byte stream into records. The default is NewlineFramer().
+//
+// Frame has the same contract as bufio.SplitFunc, so Framer.Frame can be passed to bufio.Scanner.Split():
+// It returns the number of bytes to advance the input and the next record, or advance 0 if data doesn't
+// contain a complete record yet. atEOF is true if there will be no more data.
+// The file tailer calls Frame with atEOF false, because tailed files may always grow,
+// except for compressed files, which are known to be complete.
+// An error returned by Frame stops the tailer.
+type Framer interface {
+	Frame(data []byte, atEOF bool) (advance int, record []byte, err error)
+}
+
+// NewlineFramer returns the default framer: Records are terminated by '\n', and a trailing '\r' is removed.
+func NewlineFramer() Framer {
+	return newlineFramer{}
+}
+
+// DelimiterFramer returns a framer for records terminated by delim, like DelimiterFramer("\x00") for NUL-terminated records.
+// It panics if delim is empty.
+func DelimiterFramer(delim string) Framer {
+	if len(delim) == 0 {
+		panic("fswatcher: empty record delimiter")
+	}
+	return &delimiterFramer{delim: []byte(delim)}
+}
+
+// RFC7464Framer returns a framer for JSON text sequences as defined in RFC 7464:
+// Each record starts with the record separator 0x1E and is usually terminated by '\n'.
+// The record separator and surrounding whitespace are removed from the records.
+// A record is complete when the next record separator is read, or if it is valid JSON ending with '\n'.
+// Bytes before the first record separator are ignored.
+func RFC7464Framer() Framer {
+	return rfc7464Framer{}
+}
+
+// LengthPrefixFramer returns a framer for records that are prefixed with their length in bytes,
+// as an unsigned big-endian integer of size 1, 2, 4, or 8 bytes. The length prefix is removed from the records.
+// It panics for other sizes.
+func LengthPrefixFramer(size int) Framer {
+	switch size {
+	case 1, 2, 4, 8:
+		return &lengthPrefixFramer{size: size}
+	default:
+		panic(fmt.Sprintf("fswatcher: invalid length prefix size %v, expected 1, 2, 4, or 8", size))
+	}
+}
+
+// ParseFramer returns the framer for a config value: "newline", "nul", "rfc7464", "delimiter", or "length_prefix".
+// delim is used for "delimiter", and prefixSize is used for "length_prefix", where 0 means 4 bytes.
+// The empty string means "newline".
+func ParseFramer(name string, delim string, prefixSize int) (Framer, error) {
+	switch name {
+	case "", "newline":
+		return NewlineFramer(), nil
+	case "nul":
+		return DelimiterFramer("\x00"), nil
+	case "rfc7464":
+		return RFC7464Framer(), nil
+	case "delimiter":
+		if len(delim) == 0 {
+			return nil, fmt.Errorf("framing \"delimiter\" requires a non-empty delimiter")
+		}
+		return DelimiterFramer(delim), nil
+	case "length_prefix":
+		switch prefixSize {
+		case 0:
+			return LengthPrefixFramer(4), nil
+		case 1, 2, 4, 8:
+			return LengthPrefixFramer(prefixSize), nil
+		default:
+			return nil, fmt.Errorf("%v: invalid length prefix size, expected 1, 2, 4, or 8", prefixSize)
+		}
+	default:
+		return nil, fmt.Errorf("%q: invalid framing, expected one of \"newline\", \"nul\", \"rfc7464\", \"delimiter\", or \"length_prefix\"", name)
+	}
+}
+
+type newlineFramer struct{}
+
+func (newlineFramer) Frame(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, stripWindowsLineEnding(data[:i]), nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), stripWindowsLineEnding(data), nil
+	}
+	return 0, nil, nil
+}
+
+// Implemented by framers that can find the end of a record in data that doesn't start with the record,
+// which is needed to skip the rest of a long record, see lineReader.nextLongRecordChunk().
+type recordEndFinder interface {
+	// findRecordEnd returns the end of the record, and the start of the next frame.
+	findRecordEnd(data []byte) (int, int, bool)
+}
+
+type delimiterFramer struct {
+	delim []byte
+}
+
+func (f *delimiterFramer) Frame(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.Index(data, f.delim); i >= 0 {
+		return i + len(f.delim), data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func (f *delimiterFramer) findRecordEnd(data []byte) (int, int, bool) {
+	if i := bytes.Index(data, f.delim); i >= 0 {
+		return i, i + len(f.delim), true
+	}
+	return 0, 0, false
+}
+
+const recordSeparator = 0x1E
+
+type rfc7464Framer struct{}
+
+// A nil record with advance > 0 means that the bytes are skipped, like bufio.Scanner does.
+func (rfc7464Framer) Frame(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.IndexByte(data, recordSeparator)
+	switch {
+	case start < 0:
+		// Skip garbage before the first record separator.
+		return len(data), nil, nil
+	case start > 0:
+		return start, nil, nil
+	}
+	var record []byte
+	end := bytes.IndexByte(data[1:], recordSeparator) + 1
+	switch {
+	case end > 0:
+		record = bytes.TrimSpace(data[1:end])
+	case atEOF || data[len(data)-1] == '\n' && json.Valid(data[1:]):
+		// Without the next record separator, we can't know if a '\n' terminates the record or is part of
+		// pretty-printed JSON. If the JSON is complete, we assume the record is complete.
+		record = bytes.TrimSpace(data[1:])
+		end = len(data)
+	default:
+		return 0, nil, nil
+	}
+	if len(record) == 0 {
+		// Skip empty records.
+		return end, nil, nil
+	}
+	return end, record, nil
+}
+
+// The record ends where the next record starts.
+func (rfc7464Framer) findRecordEnd(data []byte) (int, int, bool) {
+	if i := bytes.IndexByte(data, recordSeparator); i >= 0 {
+		return i, i, true
+	}
+	return 0, 0, false
+}
+
+type lengthPrefixFramer struct {
+	size int
+}
+
+// Implemented by framers that know the size of a frame before it is complete, see lineReader.nextRecord().
+type sizedFramer interface {
+	// frameSize returns the size of the frame at the start of data, and the offset of the record in the frame.
+	frameSize(data []byte) (int64, int, bool)
+}
+
+func (f *lengthPrefixFramer) frameSize(data []byte) (int64, int, bool) {
+	if len(data) < f.size {
+		return 0, 0, false
+	}
+	length := f.length(data)
+	if length > math.MaxInt64-uint64(f.size) {
+		return 0, 0, false
+	}
+	return int64(f.size) + int64(length), f.size, true
+}
+
+func (f *lengthPrefixFramer) length(data []byte) uint64 {
+	switch f.size {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data))
+	default:
+		return binary.BigEndian.Uint64(data)
+	}
+}
+
+func (f *lengthPrefixFramer) Frame(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) >= f.size {
+		length := f.length(data)
+		if length <= uint64(len(data)-f.size) {
+			end := f.size + int(length)
+			return end, data[f.size:end], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return 0, nil, fmt.Errorf("incomplete length-prefixed record: %w", io.ErrUnexpectedEOF)
+	}
+	return 0, nil, nil
+}
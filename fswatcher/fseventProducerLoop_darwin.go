@@ -20,10 +20,11 @@ import (
 )
 
 type keventloop struct {
-	kq     int
-	events chan fsevent
-	errors chan Error
-	done   chan struct{}
+	kq      int
+	events  chan fsevent
+	errors  chan Error
+	done    chan struct{}
+	stopped chan struct{}
 }
 
 // Terminate the kevent loop.
@@ -41,12 +42,17 @@ func (p *keventloop) Errors() chan Error {
 	return p.errors
 }
 
+func (p *keventloop) Stopped() chan struct{} {
+	return p.stopped
+}
+
 func runKeventLoop(kq int) *keventloop {
 	var result = &keventloop{
-		kq:     kq,
-		events: make(chan fsevent),
-		errors: make(chan Error),
-		done:   make(chan struct{}),
+		kq:      kq,
+		events:  make(chan fsevent),
+		errors:  make(chan Error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 	go func(l *keventloop) {
 		var (
@@ -57,6 +63,7 @@ func runKeventLoop(kq int) *keventloop {
 		defer func() {
 			close(result.errors)
 			close(result.events)
+			close(result.stopped)
 		}()
 		for {
 			eventBuf = make([]syscall.Kevent_t, 10)
@@ -23,10 +23,12 @@ import (
 )
 
 type inotifyloop struct {
-	fd     int
-	events chan fsevent
-	errors chan Error
-	done   chan struct{}
+	fd       int
+	events   chan fsevent
+	errors   chan Error
+	done     chan struct{}
+	stopped  chan struct{}
+	resumeCh chan struct{}
 }
 
 type inotifyEvent struct {
@@ -42,6 +44,10 @@ func (l *inotifyloop) Errors() chan Error {
 	return l.errors
 }
 
+func (l *inotifyloop) Stopped() chan struct{} {
+	return l.stopped
+}
+
 // Terminate the inotify loop.
 // If the loop hangs in syscall.Read(), it will keep hanging there until the next event is read.
 // Therefore, after the consumer called Close(), it should generate an artificial IN_IGNORE event to
@@ -50,12 +56,22 @@ func (l *inotifyloop) Close() {
 	close(l.done)
 }
 
+// After an IN_IGNORED event, the loop pauses until either Close() or resume() is called.
+func (l *inotifyloop) resume() {
+	select {
+	case l.resumeCh <- struct{}{}:
+	case <-l.done:
+	}
+}
+
 func runInotifyLoop(fd int) *inotifyloop {
 	var result = &inotifyloop{
-		fd:     fd,
-		events: make(chan fsevent),
-		errors: make(chan Error),
-		done:   make(chan struct{}),
+		fd:       fd,
+		events:   make(chan fsevent),
+		errors:   make(chan Error),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		resumeCh: make(chan struct{}),
 	}
 	go func(l *inotifyloop) {
 		var (
@@ -68,8 +84,15 @@ func runInotifyLoop(fd int) *inotifyloop {
 		defer func() {
 			close(result.errors)
 			close(result.events)
+			close(result.stopped)
 		}()
 		for {
+			// Don't read after Close(), because l.fd might already be closed and re-used by another inotify instance.
+			select {
+			case <-l.done:
+				return
+			default:
+			}
 			n, err = syscall.Read(l.fd, buf)
 			if err != nil {
 				// Getting an err might be part of the shutdown, when l.fd is closed.
@@ -103,12 +126,19 @@ func runInotifyLoop(fd int) *inotifyloop {
 					return
 				}
 				if event.Mask&syscall.IN_IGNORED == syscall.IN_IGNORED {
-					// IN_IGNORED event can have two reasons:
+					// IN_IGNORED event can have three reasons:
 					// 1) The consumer loop is shutting down and called inotify_rm_watch() to interrupt syscall.Read()
-					// 2) The watched directory was deleted. fswatcher will report an error and terminate if that happens.
-					// In both cases, we should terminate here and not call syscall.Read() again, as the next
+					// 2) The watched directory was deleted. fswatcher will report an error and terminate if that happens,
+					//    unless the directory was found by expanding wildcards in the glob's directory path.
+					// 3) fswatcher called inotify_rm_watch() because a directory found by expanding wildcards was removed.
+					// In case 1) and 2) we should terminate here and not call syscall.Read() again, as the next
 					// call might block forever as we don't receive events anymore.
-					return
+					// In case 2) with a dynamic directory and in case 3), the consumer calls resume() to continue reading events.
+					select {
+					case <-l.resumeCh:
+					case <-l.done:
+						return
+					}
 				}
 				offset += syscall.SizeofInotifyEvent + int(event.Len)
 			}
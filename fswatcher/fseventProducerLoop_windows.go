@@ -19,9 +19,10 @@ import (
 )
 
 type winwatcherloop struct {
-	events chan fsevent
-	errors chan Error
-	done   chan struct{}
+	events  chan fsevent
+	errors  chan Error
+	done    chan struct{}
+	stopped chan struct{}
 }
 
 func (l *winwatcherloop) Events() chan fsevent {
@@ -32,17 +33,23 @@ func (l *winwatcherloop) Errors() chan Error {
 	return l.errors
 }
 
+func (l *winwatcherloop) Stopped() chan struct{} {
+	return l.stopped
+}
+
 func (l *winwatcherloop) Close() {
 	close(l.done)
 }
 
 func runWinWatcherLoop(w *fsnotify.Watcher) *winwatcherloop {
 	var (
-		events = make(chan fsevent)
-		errors = make(chan Error)
-		done   = make(chan struct{})
+		events  = make(chan fsevent)
+		errors  = make(chan Error)
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
 	)
 	go func() {
+		defer close(stopped)
 		for {
 			select {
 			case event := <-w.Events:
@@ -66,8 +73,9 @@ func runWinWatcherLoop(w *fsnotify.Watcher) *winwatcherloop {
 		}
 	}()
 	return &winwatcherloop{
-		events: events,
-		errors: errors,
-		done:   done,
+		events:  events,
+		errors:  errors,
+		done:    done,
+		stopped: stopped,
 	}
 }
@@ -15,25 +15,87 @@
 package fswatcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/jdrews/go-tailer/glob"
 	"github.com/sirupsen/logrus"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
 type FileTailer interface {
 	Lines() chan *Line
 	Errors() chan Error
+	// Close triggers the shutdown of the tailer and returns immediately.
+	// The Lines() and Errors() channels are closed when the tailer has terminated.
 	Close()
+	// Shutdown closes the tailer and blocks until all of its goroutines have terminated and all
+	// of its resources are released, or until ctx is done, in which case ctx.Err() is returned.
+	// Errors that occurred while shutting down are returned to the caller.
+	Shutdown(ctx context.Context) error
+}
+
+// GlobTailer is a FileTailer whose globs can be changed while it is running.
+// The file tailers returned by Run() and the Run*FileTailer*() functions implement GlobTailer.
+type GlobTailer interface {
+	FileTailer
+	// AddGlob starts tailing the files matching g. Files that already exist are read from the start if Options.Readall is set,
+	// otherwise from the end. Files that are already watched are not affected.
+	// AddGlob returns an error if g's directory doesn't exist, unless Options.WaitForDirectories is set.
+	AddGlob(g glob.Glob) error
+	// RemoveGlob stops tailing the files that don't match any of the remaining globs.
+	// RemoveGlob returns an error if g is unknown or if it is the last glob.
+	RemoveGlob(g glob.Glob) error
+}
+
+// BatchTailer is a FileTailer that delivers lines in batches.
+// The file tailers returned by Run() and RunContext() implement BatchTailer, see Options.MaxBatchSize.
+// Consumers should read either Lines() or Batches(), but not both.
+// Batches() and Lines() are both closed when the tailer has terminated.
+type BatchTailer interface {
+	FileTailer
+	Batches() chan []*Line
 }
 
 type Line struct {
 	Line  string
 	File  string
 	Extra interface{}
+	// Offset is the byte offset of the first byte of the line, EndOffset is the offset of the
+	// first byte after the line terminator, i.e. where the next line starts.
+	// For Kafka lines, Offset is the message offset within the partition and EndOffset is not set.
+	Offset    int64
+	EndOffset int64
+	// LineNumber counts lines starting with 1 since the file was opened or truncated.
+	// If the tailer didn't start reading at the beginning of the file, this is not the line number within the file.
+	LineNumber int64
+	// Device and Inode identify the file. On Windows, Device is 0 and Inode is the file index.
+	Device uint64
+	Inode  uint64
+	// Generation is incremented each time a new file is opened under the same path, or the file is truncated.
+	// It starts with 0 for the first file the tailer opens under a path.
+	Generation int
+	// Fingerprint is a hash of the first bytes of the file, see Options.FingerprintSize.
+	// Together with Device and Inode, it identifies the file even if the inode is re-used.
+	Fingerprint uint64
+	// ReadTime is the wall-clock time when the line was read.
+	ReadTime time.Time
+	// Topic and Partition are set for lines read by the Kafka tailer.
+	Topic     string
+	Partition int32
+	// RequestID is set for lines received by the webhook tailer.
+	RequestID string
+	// Truncated is set if the line exceeded Options.MaxLineLength and was truncated.
+	Truncated bool
+	// Rotated is set if the line was read after the file was rotated away or deleted, see Options.RotationGracePeriod.
+	// File and Generation still refer to the file before the rotation.
+	Rotated bool
+	// Header contains the header lines of the file, see Options.Headers. It is shared by all lines of the file, don't modify it.
+	Header []string
 }
 
 // ideas how this might look like in the config file:
@@ -47,13 +109,69 @@ type Line struct {
 // Moreover, we should provide vars {{.filename}} and {{.filepath}} for labels.
 
 type fileTailer struct {
-	globs        []glob.Glob
-	watchedDirs  []*Dir
-	watchedFiles map[string]*fileWithReader // path -> fileWithReader
-	osSpecific   fswatcher
-	lines        chan *Line
-	errors       chan Error
-	done         chan struct{}
+	globs            []glob.Glob
+	exclude          []glob.Matcher
+	pathMatcher      glob.Matcher // nil if all files matching the globs are tailed
+	watchedDirs      []*Dir
+	watchedFiles     map[string]*fileWithReader    // path -> fileWithReader
+	checkpointStore  CheckpointStore               // nil if checkpoints are disabled
+	savedCheckpoints map[string]Checkpoint         // path -> checkpoint loaded on startup, removed when used
+	generations      map[string]int                // path -> generation of the last file opened under that path
+	savedCompressed  map[compressedKey]Checkpoint  // checkpoints of compressed files loaded on startup, removed when used
+	compressedFiles  map[string]*Checkpoint        // paths of compressed files, they are read once during backfill and never tailed. The checkpoint is nil unless the file was read completely.
+	backfilling      bool                          // true while the files found on startup are initialized
+	fingerprintSize  int                           // <= 0 if fingerprints are disabled
+	drainingFiles    map[*fileWithReader]time.Time // rotated or deleted files that are read until the deadline
+	gracePeriod      time.Duration
+	waitForDirs      bool // true if missing directories are awaited, see Options.WaitForDirectories
+	readall          bool
+	globsLock        sync.Mutex
+	requestedGlobs   []glob.Glob   // t.globs including the pending changes, guarded by globsLock
+	pendingGlobs     []globChange  // changes from AddGlob() and RemoveGlob(), guarded by globsLock
+	globsChanged     chan struct{} // signals pendingGlobs to the consumer loop
+	maxLineLength    int
+	longLinePolicy   LongLinePolicy
+	framer           Framer
+	framers          map[glob.Glob]Framer
+	encoding         Encoding
+	encodings        map[glob.Glob]Encoding
+	invalidEncoding  InvalidEncodingPolicy
+	header           HeaderFunc
+	headers          map[glob.Glob]HeaderFunc
+	osSpecific       fswatcher
+	producerLoop     fseventProducerLoop // nil until the producer loop is started
+	maxBatchSize     int                 // <= 0 if batching is disabled
+	maxBatchLatency  time.Duration
+	batch            []*Line                   // lines that were not yet sent to the batches channel
+	batchLines       []Line                    // backing array for the lines in batch, so that we allocate once per batch
+	batchFiles       []*fileWithReader         // the file of each line in batch, nil for compressed files
+	pendingOffsets   map[*fileWithReader]int64 // offset of the first line per file that the consumer did not accept yet, used for checkpoints
+	batchTimer       *time.Timer               // fires when the first line in batch has waited for maxBatchLatency
+	metrics          TailerMetrics
+	reportPositions  bool // false if metrics are disabled, because ReadPosition() needs a stat() call
+	log              logrus.FieldLogger
+	lines            chan *Line
+	batches          chan []*Line
+	errors           chan Error
+	done             chan struct{}
+	closeOnce        sync.Once
+	stopped          chan struct{} // closed when shutdown() is complete
+	shutdownErr      error         // errors from shutdown(), valid after stopped is closed
+}
+
+type fileStat struct {
+	device uint64
+	inode  uint64
+	size   int64
+}
+
+// identifies the file that a line was read from, see Line
+type fileIdentity struct {
+	device            uint64
+	inode             uint64
+	generation        int
+	fingerprint       uint64 // hash of the first fingerprintLength bytes
+	fingerprintLength int
 }
 
 type fswatcher interface {
@@ -69,6 +187,7 @@ type fseventProducerLoop interface {
 	Close()
 	Events() chan fsevent
 	Errors() chan Error
+	Stopped() chan struct{} // closed when the loop's goroutine has terminated
 }
 
 type fsevent interface{}
@@ -82,6 +201,10 @@ func (t *fileTailer) Lines() chan *Line {
 	return t.lines
 }
 
+func (t *fileTailer) Batches() chan []*Line {
+	return t.batches
+}
+
 func (t *fileTailer) Errors() chan Error {
 	return t.errors
 }
@@ -89,36 +212,171 @@ func (t *fileTailer) Errors() chan Error {
 // Close() triggers the shutdown of the file tailer.
 // The file tailer will eventually terminate,
 // but after Close() returns it might still be running in the background for a few milliseconds.
+// Use Shutdown() to wait until the file tailer has terminated.
+// It is safe to call Close() multiple times.
 func (t *fileTailer) Close() {
 	// Closing the done channel will stop the consumer loop.
 	// Deferred functions within the consumer loop will close the producer loop.
-	close(t.done)
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+}
+
+// Shutdown() closes the file tailer and waits until the consumer loop and the producer loop have terminated,
+// and all watched files and directories are closed.
+func (t *fileTailer) Shutdown(ctx context.Context) error {
+	t.Close()
+	select {
+	case <-t.stopped:
+		return t.shutdownErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func RunFileTailer(globs []glob.Glob, readall bool, failOnMissingFile bool, log logrus.FieldLogger) (FileTailer, error) {
-	return runFileTailer(initWatcher, globs, readall, failOnMissingFile, log)
+	return Run(Options{
+		Globs:             globs,
+		Readall:           readall,
+		FailOnMissingFile: failOnMissingFile,
+		Log:               log,
+	})
 }
 
 func RunPollingFileTailer(globs []glob.Glob, readall bool, failOnMissingFile bool, pollInterval time.Duration, log logrus.FieldLogger) (FileTailer, error) {
-	initFunc := func() (fswatcher, Error) {
-		return initPollingWatcher(pollInterval)
-	}
-	return runFileTailer(initFunc, globs, readall, failOnMissingFile, log)
+	return Run(Options{
+		Globs:             globs,
+		Readall:           readall,
+		FailOnMissingFile: failOnMissingFile,
+		Backend:           PollingBackend,
+		PollInterval:      pollInterval,
+		Log:               log,
+	})
 }
 
-func runFileTailer(initFunc func() (fswatcher, Error), globs []glob.Glob, readall bool, failOnMissingFile bool, log logrus.FieldLogger) (FileTailer, error) {
+// RunFileTailerContext is like RunFileTailer, but the file tailer is closed when ctx is done.
+func RunFileTailerContext(ctx context.Context, globs []glob.Glob, readall bool, failOnMissingFile bool, log logrus.FieldLogger) (FileTailer, error) {
+	return RunContext(ctx, Options{
+		Globs:             globs,
+		Readall:           readall,
+		FailOnMissingFile: failOnMissingFile,
+		Log:               log,
+	})
+}
+
+// RunPollingFileTailerContext is the polling version of RunFileTailerContext.
+func RunPollingFileTailerContext(ctx context.Context, globs []glob.Glob, readall bool, failOnMissingFile bool, pollInterval time.Duration, log logrus.FieldLogger) (FileTailer, error) {
+	return RunContext(ctx, Options{
+		Globs:             globs,
+		Readall:           readall,
+		FailOnMissingFile: failOnMissingFile,
+		Backend:           PollingBackend,
+		PollInterval:      pollInterval,
+		Log:               log,
+	})
+}
+
+// RunFileTailerWithCheckpoints is like RunFileTailer, but resumes reading each file at the offset
+// saved in checkpointStore, as long as it is still the same file.
+// Files without checkpoint are handled according to readall.
+// Checkpoints are saved every DefaultCheckpointInterval and when the tailer is closed.
+func RunFileTailerWithCheckpoints(globs []glob.Glob, readall bool, failOnMissingFile bool, checkpointStore CheckpointStore, log logrus.FieldLogger) (FileTailer, error) {
+	return Run(Options{
+		Globs:             globs,
+		Readall:           readall,
+		FailOnMissingFile: failOnMissingFile,
+		CheckpointStore:   checkpointStore,
+		Log:               log,
+	})
+}
+
+// RunPollingFileTailerWithCheckpoints is the polling version of RunFileTailerWithCheckpoints.
+func RunPollingFileTailerWithCheckpoints(globs []glob.Glob, readall bool, failOnMissingFile bool, pollInterval time.Duration, checkpointStore CheckpointStore, log logrus.FieldLogger) (FileTailer, error) {
+	return Run(Options{
+		Globs:             globs,
+		Readall:           readall,
+		FailOnMissingFile: failOnMissingFile,
+		Backend:           PollingBackend,
+		PollInterval:      pollInterval,
+		CheckpointStore:   checkpointStore,
+		Log:               log,
+	})
+}
+
+// Starts the file tailer. opts must be complete, i.e. defaults must already be applied.
+func runFileTailer(ctx context.Context, initFunc func() (fswatcher, Error), opts Options) (FileTailer, error) {
 
 	var (
-		t   *fileTailer
-		Err Error
+		t               *fileTailer
+		Err             Error
+		checkpointTicks <-chan time.Time // nil if checkpoints are disabled, i.e. never fires
+		drainTicks      <-chan time.Time // nil without rotation grace period
+		batchTimeouts   <-chan time.Time // nil if batching is disabled
+		log             = opts.Log
 	)
 
 	t = &fileTailer{
-		globs:        globs,
-		watchedFiles: make(map[string]*fileWithReader),
-		lines:        make(chan *Line),
-		errors:       make(chan Error),
-		done:         make(chan struct{}),
+		globs:            opts.Globs,
+		exclude:          opts.Exclude,
+		pathMatcher:      opts.PathMatcher,
+		watchedFiles:     make(map[string]*fileWithReader),
+		checkpointStore:  opts.CheckpointStore,
+		savedCheckpoints: make(map[string]Checkpoint),
+		generations:      make(map[string]int),
+		savedCompressed:  make(map[compressedKey]Checkpoint),
+		compressedFiles:  make(map[string]*Checkpoint),
+		backfilling:      true,
+		maxLineLength:    opts.MaxLineLength,
+		longLinePolicy:   opts.LongLinePolicy,
+		drainingFiles:    make(map[*fileWithReader]time.Time),
+		gracePeriod:      opts.RotationGracePeriod,
+		waitForDirs:      opts.WaitForDirectories,
+		readall:          opts.Readall,
+		requestedGlobs:   append([]glob.Glob(nil), opts.Globs...),
+		globsChanged:     make(chan struct{}, 1),
+		fingerprintSize:  opts.FingerprintSize,
+		framer:           opts.Framer,
+		framers:          opts.Framers,
+		encoding:         opts.Encoding,
+		encodings:        opts.Encodings,
+		invalidEncoding:  opts.InvalidEncodingPolicy,
+		header:           opts.Header,
+		headers:          opts.Headers,
+		maxBatchSize:     opts.MaxBatchSize,
+		maxBatchLatency:  opts.MaxBatchLatency,
+		pendingOffsets:   make(map[*fileWithReader]int64),
+		metrics:          opts.Metrics,
+		reportPositions:  opts.Metrics != nil,
+		log:              opts.Log,
+		lines:            make(chan *Line),
+		batches:          make(chan []*Line),
+		errors:           make(chan Error),
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+
+	if t.metrics == nil {
+		t.metrics = NoopMetrics{}
+	}
+
+	if t.maxBatchSize > 0 {
+		t.batchTimer = time.NewTimer(t.maxBatchLatency)
+		t.batchTimer.Stop()
+		batchTimeouts = t.batchTimer.C
+	}
+
+	if t.checkpointStore != nil {
+		checkpoints, err := t.checkpointStore.Load()
+		if err != nil {
+			return nil, NewError(NotSpecified, err, "failed to load checkpoints")
+		}
+		for _, checkpoint := range checkpoints {
+			if checkpoint.Compressed {
+				t.savedCompressed[compressedKey{fingerprint: checkpoint.Fingerprint, fingerprintLength: checkpoint.FingerprintLength}] = checkpoint
+			} else {
+				t.savedCheckpoints[checkpoint.Path] = checkpoint
+			}
+		}
 	}
 
 	t.osSpecific, Err = initFunc()
@@ -126,71 +384,103 @@ func runFileTailer(initFunc func() (fswatcher, Error), globs []glob.Glob, readal
 		return nil, Err
 	}
 
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				t.Close()
+			case <-t.stopped:
+			}
+		}()
+	}
+
 	go func() {
 
+		defer close(t.stopped)
 		defer t.shutdown()
 
 		Err = t.watchDirs(log)
 		if Err != nil {
-			select {
-			case <-t.done:
-			case t.errors <- Err:
-			}
+			t.sendError(Err)
 			return
 		}
 
 		eventProducerLoop := t.osSpecific.runFseventProducerLoop()
+		t.producerLoop = eventProducerLoop
 		defer eventProducerLoop.Close()
 
 		for _, dir := range t.watchedDirs {
 			dirLogger := log.WithField("directory", dir.Path())
 			dirLogger.Debugf("initializing directory")
-			Err = t.syncFilesInDir(dir, readall, dirLogger) // This may already write lines to the lines channel, so we will not go past this line unless the consumer starts reading lines.
+			Err = t.syncFilesInDir(dir, opts.Readall, dirLogger) // This may already write lines to the lines channel, so we will not go past this line unless the consumer starts reading lines.
 			if Err != nil {
-				select {
-				case <-t.done:
-				case t.errors <- Err:
-				}
+				t.sendError(Err)
 				return
 			}
 		}
 
 		// make sure at least one logfile was found for each glob
-		if failOnMissingFile {
+		if opts.FailOnMissingFile {
 			missingFileError := t.checkMissingFile()
 			if missingFileError != nil {
-				select {
-				case <-t.done:
-				case t.errors <- missingFileError:
-				}
+				t.sendError(missingFileError)
 				return
 			}
 		}
 
+		// Checkpoints for files that were not found during initialization are obsolete.
+		t.savedCheckpoints = make(map[string]Checkpoint)
+		t.savedCompressed = make(map[compressedKey]Checkpoint)
+		t.backfilling = false
+
+		if t.checkpointStore != nil {
+			checkpointTicker := time.NewTicker(opts.CheckpointInterval)
+			defer checkpointTicker.Stop()
+			checkpointTicks = checkpointTicker.C
+		}
+
+		if t.gracePeriod > 0 {
+			drainTicker := time.NewTicker(drainInterval)
+			defer drainTicker.Stop()
+			drainTicks = drainTicker.C
+		}
+
 		for { // event consumer loop
 			select {
 			case <-t.done:
 				return
+			case <-drainTicks:
+				t.drainFiles(log)
+			case <-batchTimeouts:
+				if !t.flushBatch() {
+					return
+				}
+			case <-t.globsChanged:
+				Err = t.applyGlobChanges(log)
+				if Err != nil {
+					t.sendError(Err)
+					return
+				}
+			case <-checkpointTicks:
+				Err = t.saveCheckpoints()
+				if Err != nil {
+					t.sendError(Err) // The checkpoints are saved again on the next tick and on shutdown.
+				}
 			case event, open := <-eventProducerLoop.Events():
 				if !open {
 					return
 				}
+				t.metrics.EventProcessed()
 				processEventError := t.osSpecific.processEvent(t, event, log)
 				if processEventError != nil {
-					select {
-					case <-t.done:
-					case t.errors <- processEventError:
-					}
+					t.sendError(processEventError)
 					return
 				}
 			case err, open := <-eventProducerLoop.Errors():
 				if !open {
 					return
 				}
-				select {
-				case <-t.done:
-				case t.errors <- NewError(NotSpecified, err, "error reading file system events"):
-				}
+				t.sendError(NewError(NotSpecified, err, "error reading file system events"))
 				return
 			}
 		}
@@ -198,34 +488,60 @@ func runFileTailer(initFunc func() (fswatcher, Error), globs []glob.Glob, readal
 	return t, nil
 }
 
+// Releases all resources of the file tailer. The errors are stored in t.shutdownErr, so that Shutdown() can return them.
 func (t *fileTailer) shutdown() {
 
 	close(t.lines)
+	close(t.batches)
 	close(t.errors)
-	logger := logrus.New()
+	if t.batchTimer != nil {
+		t.batchTimer.Stop()
+	}
+
+	var errs []error
 
-	warnf := func(format string, args ...interface{}) {
-		logger.Warnf("error while shutting down the file system watcher: %v", fmt.Sprintf(format, args))
+	Err := t.saveCheckpoints()
+	if Err != nil {
+		errs = append(errs, Err)
 	}
 
 	for _, dir := range t.watchedDirs {
 		err := t.osSpecific.unwatchDir(dir)
 		if err != nil {
-			warnf("%v", err)
+			errs = append(errs, err)
 		}
 	}
 
 	err := t.osSpecific.Close()
 	if err != nil {
-		warnf("%v", err)
+		errs = append(errs, err)
 	}
 
 	for _, file := range t.watchedFiles {
+		t.metrics.FileClosed(file.file.Name())
 		err = file.file.Close()
 		if err != nil {
-			warnf("close(%q) failed: %v", file.file.Name(), err)
+			errs = append(errs, fmt.Errorf("close(%q) failed: %v", file.file.Name(), err))
 		}
 	}
+
+	for file := range t.drainingFiles {
+		t.metrics.FileClosed(file.file.Name())
+		err = file.file.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("close(%q) failed: %v", file.file.Name(), err))
+		}
+	}
+
+	// Closing the file system watcher above interrupts the producer loop if it is blocked in a system call.
+	if t.producerLoop != nil {
+		<-t.producerLoop.Stopped()
+	}
+
+	t.shutdownErr = errors.Join(errs...)
+	if t.shutdownErr != nil {
+		t.log.Debugf("error while shutting down the file system watcher: %v", t.shutdownErr)
+	}
 }
 
 func (t *fileTailer) watchDirs(log logrus.FieldLogger) Error {
@@ -234,10 +550,15 @@ func (t *fileTailer) watchDirs(log logrus.FieldLogger) Error {
 		dirPaths []string
 		dirPath  string
 	)
-	dirPaths, Err = uniqueDirs(t.globs)
+	dirPaths, Err = uniqueDirs(t.globs, t.waitForDirs)
 	if Err != nil {
 		return Err
 	}
+	for _, g := range t.globs {
+		if !containsString(dirPaths, g.BaseDir()) {
+			log.Infof("%v: no such directory, waiting for it to be created", g.BaseDir())
+		}
+	}
 	for _, dirPath = range dirPaths {
 		log.Debugf("watching directory %v", dirPath)
 		dir, Err := t.osSpecific.watchDir(dirPath)
@@ -256,14 +577,27 @@ func (t *fileTailer) syncFilesInDir(dir *Dir, readall bool, log logrus.FieldLogg
 			watchedFilesAfter[path] = file
 		}
 	}
+	compressedFilesAfter := make(map[string]*Checkpoint)
+	for path, checkpoint := range t.compressedFiles {
+		if filepath.Dir(path) != dir.Path() {
+			compressedFilesAfter[path] = checkpoint
+		}
+	}
 	fileInfos, Err := dir.ls()
 	if Err != nil {
+		if _, err := os.Stat(dir.Path()); os.IsNotExist(err) && !t.isStaticDir(dir.Path()) {
+			// The directory will be un-watched when we process the event for its removal.
+			// Its files are closed now, because on Linux the event is delayed as long as files in the directory are open.
+			log.Debug("skipping, because directory does no longer exist")
+			t.closeFilesInDir(dir, log)
+			return nil
+		}
 		return Err
 	}
 	for _, fileInfo := range fileInfos {
 		filePath := filepath.Join(dir.Path(), fileInfo.Name())
 		fileLogger := log.WithField("file", fileInfo.Name())
-		if !anyGlobMatches(t.globs, filePath) {
+		if !t.isSelected(filePath) {
 			fileLogger.Debug("skipping file, because file name does not match")
 			continue
 		}
@@ -271,6 +605,11 @@ func (t *fileTailer) syncFilesInDir(dir *Dir, readall bool, log logrus.FieldLogg
 			fileLogger.Debug("skipping, because it is a directory")
 			continue
 		}
+		if checkpoint, exists := t.compressedFiles[filePath]; exists {
+			fileLogger.Debug("skipping, because it is a compressed file")
+			compressedFilesAfter[filePath] = checkpoint
+			continue
+		}
 		alreadyWatched, Err := findSameFile(t, fileInfo, filePath)
 		if Err != nil {
 			return Err
@@ -288,19 +627,38 @@ func (t *fileTailer) syncFilesInDir(dir *Dir, readall bool, log logrus.FieldLogg
 					renamedFile.Close()
 					return Err
 				}
+				t.metrics.FileClosed(alreadyWatched.file.Name())
+				t.metrics.FileOpened(filePath)
 				alreadyWatched.file = renamedFile // re-use lineReader
-				Err = t.readNewLines(alreadyWatched, fileLogger)
+				_, Err = t.restartIfFingerprintChanged(alreadyWatched, fileLogger)
+				if Err == nil {
+					Err = t.readNewLines(alreadyWatched, fileLogger)
+				}
 				if Err != nil {
 					alreadyWatched.file.Close()
 					return Err
 				}
 				watchedFilesAfter[filePath] = alreadyWatched
 			} else {
-				fileLogger.Debug("skipping, because file is already watched")
+				// The same inode might have been re-used for a new file, or the file was truncated and rewritten.
+				restarted, Err := t.restartIfFingerprintChanged(alreadyWatched, fileLogger)
+				if restarted && Err == nil {
+					Err = t.readNewLines(alreadyWatched, fileLogger)
+				}
+				if Err != nil {
+					return Err
+				}
+				if !restarted {
+					fileLogger.Debug("skipping, because file is already watched")
+				}
 				watchedFilesAfter[filePath] = alreadyWatched
 			}
 			continue
 		}
+		if replaced, exists := t.watchedFiles[filePath]; exists && !contains(watchedFilesAfter, replaced) {
+			// The file was rotated. Read the lines written before the rotation before reading the new file.
+			t.drainFile(replaced, fileLogger)
+		}
 		newFile, Err := open(filePath)
 		if Err != nil {
 			if Err.Type() == FileNotFound {
@@ -310,12 +668,51 @@ func (t *fileTailer) syncFilesInDir(dir *Dir, readall bool, log logrus.FieldLogg
 				return Err
 			}
 		}
-		if !readall {
-			_, err := newFile.Seek(0, io.SeekEnd)
-			if err != nil {
-				newFile.Close()
-				return NewError(NotSpecified, os.NewSyscallError("seek", err), filePath)
+		compression, err := detectCompression(newFile, filePath)
+		if err != nil {
+			newFile.Close()
+			return NewErrorf(NotSpecified, err, "%v: read() failed", filePath)
+		}
+		if compression != nil {
+			var checkpoint *Checkpoint
+			if compression == incompleteCompressedFile {
+				fileLogger.Info("skipping, because the file name says it is compressed, but the file is not completely written yet")
+			} else if t.backfilling && readall {
+				var stat fileStat
+				stat, err = statFile(newFile)
+				if err == nil {
+					_, err = newFile.Seek(0, io.SeekStart)
+				}
+				if err != nil {
+					newFile.Close()
+					return NewErrorf(NotSpecified, err, "%v: stat() or seek() failed", filePath)
+				}
+				id := fileIdentity{device: stat.device, inode: stat.inode}
+				fingerprintSize := t.fingerprintSize
+				if fingerprintSize <= 0 {
+					fingerprintSize = DefaultFingerprintSize // compressed files are always checkpointed by fingerprint
+				}
+				id.fingerprint, id.fingerprintLength, err = readFingerprint(newFile, fingerprintSize)
+				if err == nil {
+					checkpoint, Err = t.backfillCompressedFile(newFile, filePath, id, compression, fileLogger)
+				} else {
+					Err = NewErrorf(NotSpecified, err, "%v: failed to read fingerprint", filePath)
+				}
+			} else {
+				fileLogger.Debugf("skipping %v compressed file, because compressed files are only read on startup with readall", compression.name)
 			}
+			newFile.Close()
+			if Err != nil {
+				return Err
+			}
+			compressedFilesAfter[filePath] = checkpoint
+			continue
+		}
+		newFileWithReader := &fileWithReader{file: newFile, reader: t.newLineReader(filePath), header: t.newFileHeader(filePath)}
+		Err = t.initNewFile(newFileWithReader, filePath, readall)
+		if Err != nil {
+			newFile.Close()
+			return Err
 		}
 		fileLogger = fileLogger.WithField("fd", newFile.Fd())
 		fileLogger.Info("watching new file")
@@ -326,46 +723,370 @@ func (t *fileTailer) syncFilesInDir(dir *Dir, readall bool, log logrus.FieldLogg
 			return Err
 		}
 
-		newFileWithReader := &fileWithReader{file: newFile, reader: NewLineReader()}
 		Err = t.readNewLines(newFileWithReader, fileLogger)
 		if Err != nil {
 			newFile.Close()
 			return Err
 		}
+		t.metrics.FileOpened(filePath)
 		watchedFilesAfter[filePath] = newFileWithReader
 	}
 	for _, f := range t.watchedFiles {
 		if !contains(watchedFilesAfter, f) {
 			fileLogger := log.WithField("file", filepath.Base(f.file.Name())).WithField("fd", f.file.Fd())
-			fileLogger.Info("file was removed, closing and un-watching")
-			f.file.Close()
+			t.startDraining(f, fileLogger)
 		}
 	}
 	t.watchedFiles = watchedFilesAfter
+	t.compressedFiles = compressedFilesAfter
 	return nil
 }
 
+// Sets the identity of a newly opened file and seeks it to the position where reading should start.
+// This is the checkpoint if there is one, otherwise the start or end of the file depending on readall.
+func (t *fileTailer) initNewFile(file *fileWithReader, path string, readall bool) Error {
+	var offset int64
+	stat, err := statFile(file.file)
+	if err != nil {
+		return NewErrorf(NotSpecified, err, "%v: stat failed", path)
+	}
+	file.id = fileIdentity{
+		device:     stat.device,
+		inode:      stat.inode,
+		generation: t.nextGeneration(path),
+	}
+	err = t.initFingerprint(file)
+	if err != nil {
+		return NewErrorf(NotSpecified, err, "%v: failed to read fingerprint", path)
+	}
+	offset = t.popCheckpoint(path, stat, file.file)
+	switch {
+	case offset >= 0:
+		_, err = file.file.Seek(offset, io.SeekStart)
+	case !readall:
+		offset, err = file.file.Seek(0, io.SeekEnd)
+	default:
+		// The file might not be at the start, because we read the header to detect compression.
+		offset, err = file.file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return NewError(NotSpecified, os.NewSyscallError("seek", err), path)
+	}
+	file.reader.Reset(offset)
+	if offset > 0 && file.header != nil {
+		Err := t.readHeader(file, path, offset)
+		if Err != nil {
+			return Err
+		}
+	}
+	if offset > 0 {
+		return t.detectEncoding(file, path, offset)
+	}
+	return nil
+}
+
+// Reads the byte order mark of a file that is not read from the start.
+func (t *fileTailer) detectEncoding(file *fileWithReader, path string, offset int64) Error {
+	var (
+		header = make([]byte, 3)
+		n      int
+		err    error
+	)
+	_, err = file.file.Seek(0, io.SeekStart)
+	if err == nil {
+		n, err = io.ReadFull(file.file, header)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			err = nil
+		}
+		file.reader.DetectEncoding(header[:n])
+	}
+	if err == nil {
+		_, err = file.file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return NewErrorf(NotSpecified, err, "%v: failed to read the byte order mark", path)
+	}
+	return nil
+}
+
+// Returns a line reader using the framer and encoding configured for path.
+func (t *fileTailer) newLineReader(path string) *lineReader {
+	var (
+		framer        = t.framer
+		encoding      = t.encoding
+		framerFound   bool
+		encodingFound bool
+	)
+	for _, g := range t.globs {
+		if !g.Match(path) {
+			continue
+		}
+		if f, exists := t.framers[g]; exists && !framerFound {
+			framer, framerFound = f, true
+		}
+		if e, exists := t.encodings[g]; exists && !encodingFound {
+			encoding, encodingFound = e, true
+		}
+	}
+	result := newFramedLineReader(framer, t.maxLineLength, t.longLinePolicy)
+	result.setEncoding(encoding, t.invalidEncoding)
+	return result
+}
+
+// Returns the generation for a new file under path, or for a truncated file under path.
+func (t *fileTailer) nextGeneration(path string) int {
+	generation, exists := t.generations[path]
+	if exists {
+		generation++
+	}
+	t.generations[path] = generation
+	return generation
+}
+
+// Must be called after a truncated file was seeked to the start.
+func (t *fileTailer) restartTruncatedFile(file *fileWithReader) {
+	t.metrics.FileTruncated(file.file.Name())
+	delete(t.pendingOffsets, file) // the pending lines refer to the content before the truncation
+	if file.header != nil {
+		file.header = t.newFileHeader(file.file.Name())
+	}
+	file.reader.Clear()
+	file.id.generation = t.nextGeneration(file.file.Name())
+	err := t.initFingerprint(file)
+	if err != nil {
+		// The fingerprint will be taken when the file grows, see fingerprintChanged().
+		file.id.fingerprint, file.id.fingerprintLength = fingerprint(nil), 0
+		t.log.Debugf("%v: failed to read fingerprint: %v", file.file.Name(), err)
+	}
+}
+
 func (t *fileTailer) readNewLines(file *fileWithReader, log logrus.FieldLogger) Error {
 	var (
-		line string
-		eof  bool
-		err  error
+		line        string
+		offset      int64
+		eof         bool
+		err         error
+		_, rotated  = t.drainingFiles[file]
+		startOffset = file.reader.Offset()
+		nLines      int
 	)
+	defer func() {
+		if nLines > 0 {
+			t.metrics.LinesRead(file.file.Name(), nLines, file.reader.Offset()-startOffset)
+		}
+	}()
 	for {
+		offset = file.reader.Offset()
 		line, eof, err = file.reader.ReadLine(file.file)
 		if err != nil {
 			return NewErrorf(NotSpecified, err, "%v: read() failed", file.file.Name())
 		}
+		if !t.reportLongLines(file.reader, file.file.Name()) {
+			return nil
+		}
 		if eof {
+			if t.reportPositions && !rotated {
+				t.reportPosition(file)
+			}
 			return nil
 		}
+		nLines++
+		if file.header != nil && file.header.add(line) {
+			log.Debugf("read header line %q", line)
+			continue
+		}
 		log.Debugf("read line %q", line)
+		ok := t.sendLine(file, Line{
+			Line:        line,
+			File:        file.file.Name(),
+			Rotated:     rotated,
+			Offset:      offset,
+			EndOffset:   file.reader.Offset(),
+			LineNumber:  file.reader.LineNumber(),
+			Device:      file.id.device,
+			Inode:       file.id.inode,
+			Generation:  file.id.generation,
+			Fingerprint: file.id.fingerprint,
+			ReadTime:    time.Now(),
+			Truncated:   file.reader.Truncated(),
+			Header:      headerLines(file.header),
+		})
+		if !ok {
+			return nil
+		}
+	}
+}
+
+func headerLines(header *fileHeader) []string {
+	if header == nil {
+		return nil
+	}
+	return header.lines
+}
+
+// Sends line to the lines channel, or adds it to the current batch if batching is enabled.
+// file is nil for compressed files, because they are not checkpointed. Returns false if the tailer was closed.
+func (t *fileTailer) sendLine(file *fileWithReader, line Line) bool {
+	if t.maxBatchSize <= 0 {
+		if file != nil {
+			t.pendingOffsets[file] = line.Offset
+		}
 		select {
 		case <-t.done:
-			return nil
-		case t.lines <- &Line{Line: line, File: file.file.Name()}:
+			return false
+		case t.lines <- &line:
+			delete(t.pendingOffsets, file)
+			return true
 		}
 	}
+	if len(t.batch) == 0 {
+		t.batch = make([]*Line, 0, t.maxBatchSize)
+		t.batchLines = make([]Line, t.maxBatchSize)
+		t.batchFiles = make([]*fileWithReader, 0, t.maxBatchSize)
+		t.batchTimer.Reset(t.maxBatchLatency)
+	}
+	if _, exists := t.pendingOffsets[file]; file != nil && !exists {
+		t.pendingOffsets[file] = line.Offset
+	}
+	t.batchLines[len(t.batch)] = line
+	t.batch = append(t.batch, &t.batchLines[len(t.batch)])
+	t.batchFiles = append(t.batchFiles, file)
+	if len(t.batch) >= t.maxBatchSize {
+		return t.flushBatch()
+	}
+	return true
+}
+
+// Sends the current batch to the batches channel, or line by line to the lines channel if the consumer reads lines.
+// The checkpoint offsets of the lines are kept until the consumer has accepted them. Returns false if the tailer was closed.
+func (t *fileTailer) flushBatch() bool {
+	if len(t.batch) == 0 {
+		return true
+	}
+	t.batchTimer.Stop()
+	batch, files := t.batch, t.batchFiles
+	t.batch, t.batchLines, t.batchFiles = nil, nil, nil
+	select {
+	case <-t.done:
+		return false
+	case t.batches <- batch:
+		clear(t.pendingOffsets)
+		return true
+	case t.lines <- batch[0]:
+	}
+	// The consumer reads lines. next[i] is the index of the next line from the same file as line i, or -1.
+	next := make([]int, len(batch))
+	last := make(map[*fileWithReader]int)
+	for i := len(batch) - 1; i >= 0; i-- {
+		next[i] = -1
+		if j, exists := last[files[i]]; exists {
+			next[i] = j
+		}
+		last[files[i]] = i
+	}
+	for i := 0; i < len(batch); i++ {
+		if i > 0 {
+			select {
+			case <-t.done:
+				return false
+			case t.lines <- batch[i]:
+			}
+		}
+		if files[i] == nil {
+			continue
+		}
+		if next[i] >= 0 {
+			t.pendingOffsets[files[i]] = batch[next[i]].Offset
+		} else {
+			delete(t.pendingOffsets, files[i])
+		}
+	}
+	return true
+}
+
+// Reports the read position and the size of a file that was read up to the end.
+func (t *fileTailer) reportPosition(file *fileWithReader) {
+	stat, err := statFile(file.file)
+	if err != nil {
+		return // The file might have been removed, this will be handled by the next file system event.
+	}
+	t.metrics.ReadPosition(file.file.Name(), file.reader.Offset(), stat.size)
+}
+
+// How often rotated or deleted files are read during the grace period.
+const drainInterval = 200 * time.Millisecond
+
+// Called when a watched file was rotated away or deleted.
+// The remaining lines are read, and if there is a grace period, the file is kept open and read until the grace period expires.
+func (t *fileTailer) startDraining(file *fileWithReader, log logrus.FieldLogger) {
+	log = log.WithField("fd", file.file.Fd())
+	t.metrics.FileRotated(file.file.Name())
+	if t.gracePeriod <= 0 {
+		t.drainFile(file, log)
+		log.Info("file was removed, closing and un-watching")
+		t.metrics.FileClosed(file.file.Name())
+		file.file.Close()
+		return
+	}
+	log.Infof("file was removed, reading it for another %v before closing", t.gracePeriod)
+	t.drainingFiles[file] = time.Now().Add(t.gracePeriod)
+	t.drainFile(file, log)
+}
+
+// Reads the remaining lines of a rotated or deleted file.
+// Read errors are expected, for example on Windows, where deleted files cannot be read. They are logged and ignored.
+func (t *fileTailer) drainFile(file *fileWithReader, log logrus.FieldLogger) {
+	if _, isDraining := t.drainingFiles[file]; !isDraining {
+		t.drainingFiles[file] = time.Now()
+		defer delete(t.drainingFiles, file)
+	}
+	Err := t.readNewLines(file, log)
+	if Err != nil {
+		log.Debugf("failed to read rotated file: %v", Err)
+	}
+}
+
+// Reads all rotated or deleted files, and closes those whose grace period has expired.
+func (t *fileTailer) drainFiles(log logrus.FieldLogger) {
+	for file, deadline := range t.drainingFiles {
+		fileLogger := log.WithField("file", filepath.Base(file.file.Name())).WithField("fd", file.file.Fd())
+		t.drainFile(file, fileLogger)
+		if time.Now().After(deadline) {
+			fileLogger.Info("grace period for removed file expired, closing")
+			t.metrics.FileClosed(file.file.Name())
+			file.file.Close()
+			delete(t.drainingFiles, file)
+		}
+	}
+}
+
+// Sends a LineTooLongError for each long line that was completely read.
+// Returns false if the tailer was closed.
+func (t *fileTailer) reportLongLines(reader *lineReader, path string) bool {
+	for _, longLine := range reader.TakeLongLines() {
+		ok := t.sendError(&LineTooLongError{
+			File:      path,
+			Offset:    longLine.offset,
+			Length:    longLine.length,
+			Discarded: longLine.discarded,
+			Policy:    reader.longLinePolicy,
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Sends Err to the errors channel. Returns false if the tailer was closed.
+func (t *fileTailer) sendError(Err Error) bool {
+	t.metrics.Error(Err)
+	select {
+	case <-t.done:
+		return false
+	case t.errors <- Err:
+		return true
+	}
 }
 
 func (t *fileTailer) checkMissingFile() Error {
@@ -378,6 +1099,9 @@ OUTER:
 		}
 		// Error message must be phrased so that it makes sense for globs,
 		// but also if g is a plain path without wildcards.
+		if len(t.exclude) > 0 || t.pathMatcher != nil {
+			return NewErrorf(FileNotFound, nil, "%v: no such file, or all matching files are excluded", g)
+		}
 		return NewErrorf(FileNotFound, nil, "%v: no such file", g)
 	}
 	return nil
@@ -385,7 +1109,11 @@ OUTER:
 
 // Gets the directory paths from the glob expressions,
 // and makes sure these directories exist.
-func uniqueDirs(globs []glob.Glob) ([]string, Error) {
+// Globs with wildcards in the directory path are expanded to all existing directories
+// that may contain matching files. In that case, only the base directory must exist.
+// If waitForDirs is true, a missing base directory is replaced with its nearest existing parent,
+// so that we learn when the directory is created.
+func uniqueDirs(globs []glob.Glob, waitForDirs bool) ([]string, Error) {
 	var (
 		result  = make([]string, 0, len(globs))
 		g       glob.Glob
@@ -393,24 +1121,207 @@ func uniqueDirs(globs []glob.Glob) ([]string, Error) {
 		err     error
 	)
 	for _, g = range globs {
-		if containsString(result, g.Dir()) {
+		if containsString(result, g.BaseDir()) && !g.HasDirWildcards() {
 			continue
 		}
-		dirInfo, err = os.Stat(g.Dir())
+		dirInfo, err = os.Stat(g.BaseDir())
 		if err != nil {
+			if os.IsNotExist(err) && waitForDirs {
+				parent, err := nearestExistingParent(g.BaseDir())
+				if err != nil {
+					return nil, NewErrorf(NotSpecified, err, "%q: failed to find an existing parent directory", g.BaseDir())
+				}
+				if !containsString(result, parent) {
+					result = append(result, parent)
+				}
+				continue
+			}
 			if os.IsNotExist(err) {
-				return nil, NewErrorf(DirectoryNotFound, nil, "%q: no such directory", g.Dir())
+				return nil, NewErrorf(DirectoryNotFound, nil, "%q: no such directory", g.BaseDir())
 			}
-			return nil, NewErrorf(NotSpecified, err, "%q: stat() failed", g.Dir())
+			return nil, NewErrorf(NotSpecified, err, "%q: stat() failed", g.BaseDir())
 		}
 		if !dirInfo.IsDir() {
-			return nil, NewErrorf(NotSpecified, nil, "%q is not a directory", g.Dir())
+			return nil, NewErrorf(NotSpecified, nil, "%q is not a directory", g.BaseDir())
+		}
+		if !g.HasDirWildcards() {
+			result = append(result, g.Dir())
+			continue
+		}
+		result, err = appendSubDirs(result, g, g.BaseDir())
+		if err != nil {
+			return nil, NewErrorf(NotSpecified, err, "%q: failed to search for directories matching %v", g.BaseDir(), g)
+		}
+	}
+	return result, nil
+}
+
+func nearestExistingParent(dir string) (string, error) {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%q: no such directory", dir)
+		}
+		dirInfo, err := os.Stat(parent)
+		if err == nil {
+			if !dirInfo.IsDir() {
+				return "", fmt.Errorf("%q is not a directory", parent)
+			}
+			return parent, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		dir = parent
+	}
+}
+
+// Appends dir and all of its subdirectories that may contain files matching g.
+// Symbolic links are not followed.
+func appendSubDirs(result []string, g glob.Glob, dir string) ([]string, error) {
+	if !containsString(result, dir) {
+		result = append(result, dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil // removed while we were searching
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		subDir := filepath.Join(dir, entry.Name())
+		if entry.IsDir() && g.MayContain(subDir) {
+			result, err = appendSubDirs(result, g, subDir)
+			if err != nil {
+				return nil, err
+			}
 		}
-		result = append(result, g.Dir())
 	}
 	return result, nil
 }
 
+// Static directories are directories that are watched from startup until shutdown.
+// If a static directory is removed, the tailer fails.
+// Directories found by expanding wildcards are dynamic, they are watched and un-watched as they are created and removed.
+// If missing directories are awaited, all directories are dynamic.
+func (t *fileTailer) isStaticDir(path string) bool {
+	if t.waitForDirs {
+		return false
+	}
+	for _, g := range t.globs {
+		if g.BaseDir() == path {
+			return true
+		}
+	}
+	return false
+}
+
+func anyDirWildcards(globs []glob.Glob) bool {
+	for _, g := range globs {
+		if g.HasDirWildcards() {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the list of watched directories may change while the tailer is running.
+func (t *fileTailer) hasDynamicDirs() bool {
+	return t.waitForDirs || anyDirWildcards(t.globs)
+}
+
+// Updates the list of watched directories if the globs contain wildcards in the directory path, or if missing directories are awaited:
+// New directories are watched and their files are read from the start, removed directories are un-watched.
+func (t *fileTailer) syncDirs(log logrus.FieldLogger) Error {
+	if !t.hasDynamicDirs() {
+		return nil
+	}
+	dirPaths, Err := uniqueDirs(t.globs, t.waitForDirs)
+	if Err != nil {
+		return Err
+	}
+	watchedDirsAfter := make([]*Dir, 0, len(dirPaths))
+	watchedPaths := make([]string, 0, len(dirPaths))
+	for _, dir := range t.watchedDirs {
+		if containsString(dirPaths, dir.Path()) {
+			watchedDirsAfter = append(watchedDirsAfter, dir)
+			watchedPaths = append(watchedPaths, dir.Path())
+		} else {
+			t.removeDir(dir, true, log)
+		}
+	}
+	t.watchedDirs = watchedDirsAfter
+	for _, dirPath := range dirPaths {
+		if containsString(watchedPaths, dirPath) {
+			continue
+		}
+		dirLogger := log.WithField("directory", dirPath)
+		dirLogger.Info("watching new directory")
+		dir, Err := t.osSpecific.watchDir(dirPath)
+		if Err != nil {
+			return Err
+		}
+		t.watchedDirs = append(t.watchedDirs, dir)
+		Err = t.syncFilesInDir(dir, true, dirLogger)
+		if Err != nil {
+			return Err
+		}
+		if t.waitForDirs {
+			// dir might be the parent of a missing directory. Sub-directories that were created before
+			// the watch was added don't trigger events, so we need to check again.
+			return t.syncDirs(log)
+		}
+	}
+	return nil
+}
+
+// Drains and closes all files in a dynamic directory that was removed. The caller must remove dir from t.watchedDirs.
+// If unwatch is false, the operating system already removed the watch.
+func (t *fileTailer) removeDir(dir *Dir, unwatch bool, log logrus.FieldLogger) {
+	dirLogger := log.WithField("directory", dir.Path())
+	dirLogger.Info("directory was removed, un-watching")
+	if unwatch {
+		err := t.osSpecific.unwatchDir(dir)
+		if err != nil {
+			// The directory is gone, so the watch might already have been removed.
+			dirLogger.Debugf("%v", err)
+		}
+	}
+	t.closeFilesInDir(dir, dirLogger)
+}
+
+// Drains and closes all files in dir, and forgets the compressed files in dir.
+func (t *fileTailer) closeFilesInDir(dir *Dir, log logrus.FieldLogger) {
+	for path, file := range t.watchedFiles {
+		if filepath.Dir(path) == dir.Path() {
+			t.startDraining(file, log.WithField("file", filepath.Base(path)))
+			delete(t.watchedFiles, path)
+		}
+	}
+	for path := range t.compressedFiles {
+		if filepath.Dir(path) == dir.Path() {
+			delete(t.compressedFiles, path)
+		}
+	}
+}
+
+// Returns true if path matches one of the globs and the path matcher, and none of the exclude patterns.
+func (t *fileTailer) isSelected(path string) bool {
+	if !anyGlobMatches(t.globs, path) {
+		return false
+	}
+	if t.pathMatcher != nil && !t.pathMatcher.Match(path) {
+		return false
+	}
+	for _, exclude := range t.exclude {
+		if exclude.Match(path) {
+			return false
+		}
+	}
+	return true
+}
+
 func anyGlobMatches(globs []glob.Glob, path string) bool {
 	for _, pattern := range globs {
 		if pattern.Match(path) {
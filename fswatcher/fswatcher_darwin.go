@@ -29,6 +29,8 @@ type watcher struct {
 type fileWithReader struct {
 	file   *os.File
 	reader *lineReader
+	id     fileIdentity
+	header *fileHeader // nil if the file has no header, see Options.Headers
 }
 
 func (w *watcher) unwatchDir(dir *Dir) error {
@@ -131,6 +133,14 @@ func (w *watcher) processEvent(t *fileTailer, event fsevent, log logrus.FieldLog
 			return w.processFileEvent(t, kevent, file, fileLogger)
 		}
 	}
+	for file = range t.drainingFiles {
+		if kevent.Ident == fdToInt(file.file.Fd()) {
+			fileLogger = log.WithField("file", file.file.Name()).WithField("fd", file.file.Fd())
+			fileLogger.Debugf("event for removed file: %v", event2string(kevent))
+			t.drainFile(file, fileLogger)
+			return nil
+		}
+	}
 	// Events for unknown file descriptors are ignored. This might happen if syncFilesInDir() already
 	// closed a file while a pending event is still coming in.
 	log.Debugf("event for unknown file descriptor %v: %v", kevent.Ident, event2string(kevent))
@@ -146,6 +156,15 @@ func (w *watcher) processDirEvent(t *fileTailer, kevent syscall.Kevent_t, dir *D
 		if err != nil {
 			return NewErrorf(NotSpecified, err, "%v: failed to update list of files in directory", dir.file.Name())
 		}
+		// NOTE_WRITE also covers new, deleted, and moved sub-directories.
+		err = t.syncDirs(dirLogger)
+		if err != nil {
+			return NewErrorf(NotSpecified, err, "%v: failed to update list of watched directories", dir.file.Name())
+		}
+	}
+	if !t.isStaticDir(dir.Path()) && kevent.Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME|syscall.NOTE_REVOKE) != 0 {
+		// A directory found by expanding wildcards in the glob's directory path was removed.
+		return t.syncDirs(dirLogger)
 	}
 	if kevent.Fflags&syscall.NOTE_DELETE == syscall.NOTE_DELETE {
 		return NewErrorf(NotSpecified, nil, "%v: directory was deleted", dir.file.Name())
@@ -169,7 +188,7 @@ func (w *watcher) processFileEvent(t *fileTailer, kevent syscall.Kevent_t, file
 
 	// Handle truncate events.
 	if kevent.Fflags&syscall.NOTE_ATTRIB == syscall.NOTE_ATTRIB {
-		truncated, err = isTruncated(file.file)
+		truncated, err = t.isTruncated(file)
 		if err != nil {
 			return NewErrorf(NotSpecified, err, "%v: seek() or stat() failed", file.file.Name())
 		}
@@ -178,7 +197,7 @@ func (w *watcher) processFileEvent(t *fileTailer, kevent syscall.Kevent_t, file
 			if err != nil {
 				return NewErrorf(NotSpecified, err, "%v: seek() failed", file.file.Name())
 			}
-			file.reader.Clear()
+			t.restartTruncatedFile(file)
 		}
 	}
 
@@ -25,17 +25,22 @@ import (
 )
 
 type watcher struct {
-	fd int
+	fd          int
+	loop        *inotifyloop
+	unwatchedWd map[int]bool // watch descriptors removed with inotify_rm_watch(), waiting for the IN_IGNORED event
 }
 
 type fileWithReader struct {
 	file   *os.File
 	reader *lineReader
+	id     fileIdentity
+	header *fileHeader // nil if the file has no header, see Options.Headers
 }
 
 func (w *watcher) unwatchDir(dir *Dir) error {
 	// After calling eventProducerLoop.Close(), we need to call inotify_rm_watch()
 	// in order to terminate the inotify loop. See eventProducerLoop.Close().
+	w.unwatchedWd[dir.wd] = true
 	success, err := syscall.InotifyRmWatch(w.fd, uint32(dir.wd))
 	if success != 0 || err != nil {
 		return fmt.Errorf("inotify_rm_watch(%q) failed: status=%v, err=%v", dir.path, success, err)
@@ -64,7 +69,8 @@ func unwatchDirByEvent(t *fileTailer, event inotifyEvent) {
 }
 
 func (w *watcher) runFseventProducerLoop() fseventProducerLoop {
-	return runInotifyLoop(w.fd)
+	w.loop = runInotifyLoop(w.fd)
+	return w.loop
 }
 
 func initWatcher() (fswatcher, Error) {
@@ -72,7 +78,7 @@ func initWatcher() (fswatcher, Error) {
 	if err != nil {
 		return nil, NewError(NotSpecified, err, "inotify_init1() failed")
 	}
-	return &watcher{fd: fd}, nil
+	return &watcher{fd: fd, unwatchedWd: make(map[int]bool)}, nil
 }
 
 func (w *watcher) watchDir(path string) (*Dir, Error) {
@@ -132,6 +138,14 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 	if !ok {
 		return NewErrorf(NotSpecified, nil, "received a file system event of unknown type %T", event)
 	}
+	if w.unwatchedWd[int(event.Wd)] {
+		// Pending event for a directory that we un-watched in syncDirs().
+		if event.Mask&syscall.IN_IGNORED == syscall.IN_IGNORED {
+			delete(w.unwatchedWd, int(event.Wd))
+			w.loop.resume()
+		}
+		return nil
+	}
 	dir, Err := findDir(t, event)
 	if Err != nil {
 		return Err
@@ -140,14 +154,30 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 	dirLogger.Debugf("received event: %v", event)
 	if event.Mask&syscall.IN_IGNORED == syscall.IN_IGNORED {
 		unwatchDirByEvent(t, event) // need to remove it from watchedDirs, because otherwise we close the removed dir on shutdown which causes an error
-		return NewErrorf(NotSpecified, nil, "%s: directory was removed while being watched", dir.path)
+		if t.isStaticDir(dir.path) {
+			return NewErrorf(NotSpecified, nil, "%s: directory was removed while being watched", dir.path)
+		}
+		t.removeDir(dir, false, log)
+		w.loop.resume()
+		if t.waitForDirs {
+			// The parent directory might not be watched, so we don't get an event for the removal there.
+			return t.syncDirs(log)
+		}
+		return nil
+	}
+	if event.Mask&syscall.IN_ISDIR == syscall.IN_ISDIR {
+		// A sub-directory was created, removed, or moved. This is only relevant if globs contain wildcards in the directory path.
+		if event.Mask&(syscall.IN_CREATE|syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_MOVED_TO) != 0 {
+			return t.syncDirs(log)
+		}
+		return nil
 	}
 	if event.Mask&syscall.IN_MODIFY == syscall.IN_MODIFY {
 		file, ok := t.watchedFiles[filepath.Join(dir.path, event.Name)]
 		if !ok {
 			return nil // unrelated file was modified
 		}
-		truncated, err := isTruncated(file.file)
+		truncated, err := t.isTruncated(file)
 		if err != nil {
 			return NewErrorf(NotSpecified, err, "%v: seek() or stat() failed", file.file.Name())
 		}
@@ -156,7 +186,7 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 			if err != nil {
 				return NewErrorf(NotSpecified, err, "%v: seek() failed", file.file.Name())
 			}
-			file.reader.Clear()
+			t.restartTruncatedFile(file)
 		}
 		readErr := t.readNewLines(file, dirLogger)
 		if readErr != nil {
@@ -32,6 +32,8 @@ type watcher struct {
 type fileWithReader struct {
 	file   *File
 	reader *lineReader
+	id     fileIdentity
+	header *fileHeader // nil if the file has no header, see Options.Headers
 }
 
 type fileInfo struct {
@@ -106,6 +108,9 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 
 	dir, fileName := dirAndFile(t, event.Name)
 	if dir == nil {
+		if t.hasDynamicDirs() {
+			return nil // pending event for a directory that was removed in syncDirs()
+		}
 		return NewError(NotSpecified, nil, "watch list inconsistent: received a file system event for an unknown directory")
 	}
 	log.WithField("directory", dir.path).Debugf("received event: %v", event)
@@ -115,6 +120,9 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 			return nil // unrelated file was modified
 		}
 		truncated, Err := file.file.CheckTruncated()
+		if Err == nil && !truncated {
+			truncated, Err = t.fingerprintChanged(file)
+		}
 		if Err != nil {
 			if Err.Type() == WinFileRemoved {
 				return t.syncFilesInDir(dir, true, log)
@@ -127,7 +135,7 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 			if err != nil {
 				return NewError(NotSpecified, os.NewSyscallError("seek", err), file.file.Name())
 			}
-			file.reader.Clear()
+			t.restartTruncatedFile(file)
 		}
 		Err = t.readNewLines(file, log)
 		if Err != nil {
@@ -142,7 +150,15 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 		// Trying to figure out what happened from the events would be error prone.
 		// Therefore, we don't care which of the above events we received, we just update our watched files with the current
 		// state of the watched directory.
-		err := t.syncFilesInDir(dir, true, log)
+		// The same is true for sub-directories if globs contain wildcards in the directory path.
+		err := t.syncDirs(log)
+		if err != nil {
+			return err
+		}
+		if !containsDir(t.watchedDirs, dir) {
+			return nil // dir itself was removed
+		}
+		err = t.syncFilesInDir(dir, true, log)
 		if err != nil {
 			return err
 		}
@@ -150,6 +166,15 @@ func (w *watcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldL
 	return nil
 }
 
+func containsDir(dirs []*Dir, dir *Dir) bool {
+	for _, existing := range dirs {
+		if existing == dir {
+			return true
+		}
+	}
+	return false
+}
+
 func isTruncated(file *File) (bool, Error) {
 	return file.CheckTruncated()
 }
@@ -183,5 +208,8 @@ func dirAndFile(t *fileTailer, fileOrDir string) (*Dir, string) {
 			}
 		}
 	}
+	if found == nil {
+		return nil, ""
+	}
 	return found, strings.TrimLeft(fileOrDir[len(found.path):], "\\/")
 }
@@ -0,0 +1,207 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"github.com/jdrews/go-tailer/glob"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+type globChange struct {
+	glob   glob.Glob
+	remove bool
+}
+
+// AddGlob is called by the user, and passes the change to the consumer loop. See GlobTailer.
+func (t *fileTailer) AddGlob(g glob.Glob) error {
+	t.globsLock.Lock()
+	defer t.globsLock.Unlock()
+	if t.isClosed() {
+		return NewErrorf(NotSpecified, nil, "%v: cannot add glob, because the file tailer is closed", g)
+	}
+	if containsGlob(t.requestedGlobs, g) {
+		return nil
+	}
+	// Check if the directory exists, so that the consumer loop doesn't fail with DirectoryNotFound.
+	_, Err := uniqueDirs([]glob.Glob{g}, t.waitForDirs)
+	if Err != nil {
+		return Err
+	}
+	t.requestedGlobs = append(t.requestedGlobs, g)
+	t.pendingGlobs = append(t.pendingGlobs, globChange{glob: g})
+	t.signalGlobsChanged()
+	return nil
+}
+
+// RemoveGlob is called by the user, and passes the change to the consumer loop. See GlobTailer.
+func (t *fileTailer) RemoveGlob(g glob.Glob) error {
+	t.globsLock.Lock()
+	defer t.globsLock.Unlock()
+	if t.isClosed() {
+		return NewErrorf(NotSpecified, nil, "%v: cannot remove glob, because the file tailer is closed", g)
+	}
+	if !containsGlob(t.requestedGlobs, g) {
+		return NewErrorf(NotSpecified, nil, "%v: cannot remove glob, because it is not watched", g)
+	}
+	if len(t.requestedGlobs) == 1 {
+		// The inotify loop can only be interrupted on shutdown if at least one directory is watched.
+		return NewErrorf(NotSpecified, nil, "%v: cannot remove the last glob", g)
+	}
+	t.requestedGlobs = removeGlob(t.requestedGlobs, g)
+	t.pendingGlobs = append(t.pendingGlobs, globChange{glob: g, remove: true})
+	t.signalGlobsChanged()
+	return nil
+}
+
+func (t *fileTailer) isClosed() bool {
+	select {
+	case <-t.done:
+		return true
+	case <-t.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// The consumer loop picks up all pending changes at once, so one signal is enough.
+func (t *fileTailer) signalGlobsChanged() {
+	select {
+	case t.globsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Called from the consumer loop when AddGlob() or RemoveGlob() was called.
+func (t *fileTailer) applyGlobChanges(log logrus.FieldLogger) Error {
+	t.globsLock.Lock()
+	changes := t.pendingGlobs
+	t.pendingGlobs = nil
+	t.globsLock.Unlock()
+	for _, change := range changes {
+		var Err Error
+		if change.remove {
+			Err = t.removeGlob(change.glob, log.WithField("glob", change.glob))
+		} else {
+			Err = t.addGlob(change.glob, log.WithField("glob", change.glob))
+		}
+		if Err != nil {
+			return Err
+		}
+	}
+	return nil
+}
+
+// Watches the directories for g, and reads the files matching g in these directories.
+func (t *fileTailer) addGlob(g glob.Glob, log logrus.FieldLogger) Error {
+	if containsGlob(t.globs, g) {
+		return nil
+	}
+	dirPaths, Err := uniqueDirs([]glob.Glob{g}, t.waitForDirs)
+	if Err != nil {
+		return Err
+	}
+	log.Info("adding glob")
+	t.globs = append(append(make([]glob.Glob, 0, len(t.globs)+1), t.globs...), g)
+	for _, dirPath := range dirPaths {
+		dirLogger := log.WithField("directory", dirPath)
+		dir := findDirByPath(t.watchedDirs, dirPath)
+		if dir == nil {
+			dirLogger.Info("watching new directory")
+			dir, Err = t.osSpecific.watchDir(dirPath)
+			if Err != nil {
+				return Err
+			}
+			t.watchedDirs = append(t.watchedDirs, dir)
+		}
+		Err = t.syncFilesInDir(dir, t.readall, dirLogger)
+		if Err != nil {
+			return Err
+		}
+	}
+	return nil
+}
+
+// Closes the files that don't match any of the remaining globs, and un-watches the directories that are no longer needed.
+// Unlike rotated files, the files are closed without reading the remaining lines.
+func (t *fileTailer) removeGlob(g glob.Glob, log logrus.FieldLogger) Error {
+	if !containsGlob(t.globs, g) {
+		return nil
+	}
+	remainingGlobs := removeGlob(t.globs, g)
+	dirPaths, Err := uniqueDirs(remainingGlobs, t.waitForDirs)
+	if Err != nil {
+		return Err
+	}
+	log.Info("removing glob")
+	t.globs = remainingGlobs
+	for path, file := range t.watchedFiles {
+		if !t.isSelected(path) {
+			log.WithField("file", filepath.Base(path)).WithField("fd", file.file.Fd()).Info("closing file, because it doesn't match any glob")
+			t.metrics.FileClosed(path)
+			file.file.Close()
+			delete(t.watchedFiles, path)
+		}
+	}
+	for path := range t.compressedFiles {
+		if !t.isSelected(path) {
+			delete(t.compressedFiles, path)
+		}
+	}
+	watchedDirsAfter := make([]*Dir, 0, len(t.watchedDirs))
+	for _, dir := range t.watchedDirs {
+		if containsString(dirPaths, dir.Path()) {
+			watchedDirsAfter = append(watchedDirsAfter, dir)
+			continue
+		}
+		log.WithField("directory", dir.Path()).Info("un-watching directory")
+		err := t.osSpecific.unwatchDir(dir)
+		if err != nil {
+			return NewErrorf(NotSpecified, err, "%v: failed to un-watch directory", dir.Path())
+		}
+	}
+	t.watchedDirs = watchedDirsAfter
+	return nil
+}
+
+func findDirByPath(dirs []*Dir, path string) *Dir {
+	for _, dir := range dirs {
+		if dir.Path() == path {
+			return dir
+		}
+	}
+	return nil
+}
+
+func containsGlob(globs []glob.Glob, g glob.Glob) bool {
+	for _, existing := range globs {
+		if existing == g {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a new slice, because the original slice might be shared with the Options.
+func removeGlob(globs []glob.Glob, g glob.Glob) []glob.Glob {
+	result := make([]glob.Glob, 0, len(globs))
+	for _, existing := range globs {
+		if existing != g {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// HeaderFunc decides if a line at the start of a file belongs to the file's header, see Options.Headers.
+// index is the index of the line in the file, starting with 0. The header ends at the first line that is not a header line.
+type HeaderFunc func(index int, line string) bool
+
+// HeaderLines returns a HeaderFunc for headers with a fixed number of lines, like the column names of a CSV file.
+func HeaderLines(n int) HeaderFunc {
+	return func(index int, _ string) bool {
+		return index < n
+	}
+}
+
+// CommentHeader returns a HeaderFunc for headers where each line starts with prefix,
+// like the #Fields: directive and the other directives of W3C extended log files.
+func CommentHeader(prefix string) HeaderFunc {
+	return func(_ int, line string) bool {
+		return strings.HasPrefix(line, prefix)
+	}
+}
+
+// ParseHeader returns the HeaderFunc for a file format: "csv" and "tsv" have the column names in the first line,
+// "w3c" has directives like #Fields: in lines starting with '#'. "none" means no header.
+func ParseHeader(format string) (HeaderFunc, error) {
+	switch strings.ToLower(format) {
+	case "none":
+		return nil, nil
+	case "csv", "tsv":
+		return HeaderLines(1), nil
+	case "w3c":
+		return CommentHeader("#"), nil
+	default:
+		return nil, fmt.Errorf("%q: invalid header, expected one of \"none\", \"csv\", \"tsv\", or \"w3c\"", format)
+	}
+}
+
+// Headers with more lines are considered complete, the remaining lines are passed on as normal lines.
+const maxHeaderLines = 100
+
+// the header of a watched file, see Options.Headers
+type fileHeader struct {
+	isHeader HeaderFunc
+	lines    []string
+	complete bool // true after the first line that is not a header line
+}
+
+// Adds line to the header and returns true if line is a header line.
+func (h *fileHeader) add(line string) bool {
+	if h.complete {
+		return false
+	}
+	if len(h.lines) < maxHeaderLines && h.isHeader(len(h.lines), line) {
+		h.lines = append(h.lines, line)
+		return true
+	}
+	h.complete = true
+	return false
+}
+
+// Returns the header for a file under path, or nil if the file has no header.
+func (t *fileTailer) newFileHeader(path string) *fileHeader {
+	isHeader := t.header
+	for _, g := range t.globs {
+		if f, exists := t.headers[g]; exists && g.Match(path) {
+			isHeader = f
+			break
+		}
+	}
+	if isHeader == nil {
+		return nil
+	}
+	return &fileHeader{isHeader: isHeader}
+}
+
+// Reads the header of a file that is not read from the start, and seeks the file back to offset.
+// Only lines before offset are considered. If all lines before offset are header lines,
+// the header may continue after offset, so the next lines read by readNewLines() are checked as well.
+func (t *fileTailer) readHeader(file *fileWithReader, path string, offset int64) Error {
+	_, err := file.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return NewError(NotSpecified, os.NewSyscallError("seek", err), path)
+	}
+	reader := t.newLineReader(path)
+	for !file.header.complete {
+		line, eof, err := reader.ReadLine(file.file)
+		if err != nil {
+			return NewErrorf(NotSpecified, err, "%v: failed to read header", path)
+		}
+		if eof || reader.Offset() > offset {
+			break
+		}
+		file.header.add(line)
+		if reader.Offset() == offset {
+			break
+		}
+	}
+	_, err = file.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return NewError(NotSpecified, os.NewSyscallError("seek", err), path)
+	}
+	return nil
+}
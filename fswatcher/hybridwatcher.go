@@ -0,0 +1,142 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// hybridWatcher uses the operating system's file system watcher, and additionally
+// polls all watched directories and files like the pollingWatcher.
+type hybridWatcher struct {
+	fsevents fswatcher
+	poll     *pollingWatcher
+}
+
+func initHybridWatcher(pollInterval time.Duration) (fswatcher, Error) {
+	fsevents, Err := initWatcher()
+	if Err != nil {
+		return nil, Err
+	}
+	return &hybridWatcher{
+		fsevents: fsevents,
+		poll:     &pollingWatcher{pollInterval: pollInterval},
+	}, nil
+}
+
+func (w *hybridWatcher) runFseventProducerLoop() fseventProducerLoop {
+	return runHybridLoop(w.fsevents.runFseventProducerLoop(), runPollLoop(w.poll.pollInterval))
+}
+
+func (w *hybridWatcher) processEvent(t *fileTailer, event fsevent, log logrus.FieldLogger) Error {
+	if _, isPollEvent := event.(pollEvent); isPollEvent {
+		return w.poll.processEvent(t, event, log)
+	}
+	return w.fsevents.processEvent(t, event, log)
+}
+
+func (w *hybridWatcher) Close() error {
+	return w.fsevents.Close()
+}
+
+func (w *hybridWatcher) watchDir(path string) (*Dir, Error) {
+	return w.fsevents.watchDir(path)
+}
+
+func (w *hybridWatcher) unwatchDir(dir *Dir) error {
+	return w.fsevents.unwatchDir(dir)
+}
+
+func (w *hybridWatcher) watchFile(file fileMeta) Error {
+	return w.fsevents.watchFile(file)
+}
+
+// hybridloop merges the events of the operating system's event loop and the poll loop.
+type hybridloop struct {
+	events  chan fsevent
+	errors  chan Error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (l *hybridloop) Events() chan fsevent {
+	return l.events
+}
+
+func (l *hybridloop) Errors() chan Error {
+	return l.errors
+}
+
+func (l *hybridloop) Stopped() chan struct{} {
+	return l.stopped
+}
+
+func (l *hybridloop) Close() {
+	close(l.done)
+}
+
+func runHybridLoop(fsevents fseventProducerLoop, poll *pollloop) *hybridloop {
+	var result = &hybridloop{
+		events:  make(chan fsevent),
+		errors:  make(chan Error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go func(l *hybridloop) {
+		defer func() {
+			fsevents.Close()
+			poll.Close()
+			// The fsevents loop might hang in a system call until the consumer closes the file system watcher.
+			<-fsevents.Stopped()
+			<-poll.Stopped()
+			close(l.errors)
+			close(l.events)
+			close(l.stopped)
+		}()
+		for {
+			var event fsevent
+			select {
+			case e, open := <-fsevents.Events():
+				if !open {
+					return
+				}
+				event = e
+			case e, open := <-poll.Events():
+				if !open {
+					return
+				}
+				event = e
+			case err, open := <-fsevents.Errors():
+				if !open {
+					return
+				}
+				select {
+				case l.errors <- err:
+				case <-l.done:
+				}
+				return
+			case <-l.done:
+				return
+			}
+			select {
+			case l.events <- event:
+			case <-l.done:
+				return
+			}
+		}
+	}(result)
+	return result
+}
@@ -21,43 +21,206 @@ import (
 
 type lineReader struct {
 	remainingBytesFromLastRead []byte
+	offset                     int64 // file offset of remainingBytesFromLastRead[0]
+	lineNumber                 int64 // number of lines returned since the last Reset()
+	maxLineLength              int   // 0 means unlimited
+	longLinePolicy             LongLinePolicy
+	longLine                   *longLine   // the line exceeding maxLineLength that is currently being read, nil otherwise
+	finishedLongLines          []*longLine // long lines that were completely read, see TakeLongLines()
+	truncated                  bool        // the last line returned by ReadLine() was truncated
+	framer                     Framer      // nil means lines terminated by '\n', see readRecord()
+	splitRecord                []byte      // the remaining chunks of a framed record that is split, see SplitLongLines
+	splitRecordAdvance         int         // the number of bytes to consume when the last chunk of splitRecord is returned
+	encoding                   Encoding    // the configured encoding, or the encoding indicated by the byte order mark
+	configuredEncoding         Encoding
+	invalidEncodingPolicy      InvalidEncodingPolicy
+	bomPending                 bool // the reader is at the start of the file, where a byte order mark may be
+}
+
+// a line exceeding the maximum line length
+type longLine struct {
+	offset    int64 // offset of the first byte of the line
+	length    int64 // length without line terminator
+	discarded int64 // number of bytes that were not returned by ReadLine()
+	skipping  bool  // the remaining bytes of the line are discarded
+	remaining int64 // the number of bytes left in the frame of a long framed record, -1 if unknown
 }
 
 func NewLineReader() *lineReader {
 	return &lineReader{
 		remainingBytesFromLastRead: []byte{},
+		bomPending:                 true,
+	}
+}
+
+// Like NewLineReader(), but lines exceeding maxLineLength bytes are handled according to policy.
+// maxLineLength 0 means unlimited.
+func newLineReaderWithLimit(maxLineLength int, policy LongLinePolicy) *lineReader {
+	result := NewLineReader()
+	result.maxLineLength = maxLineLength
+	result.longLinePolicy = policy
+	return result
+}
+
+// Like newLineReaderWithLimit(), but records are split by framer instead of '\n'.
+// A nil framer or NewlineFramer() keep the default line handling.
+func newFramedLineReader(framer Framer, maxLineLength int, policy LongLinePolicy) *lineReader {
+	result := newLineReaderWithLimit(maxLineLength, policy)
+	if _, isNewline := framer.(newlineFramer); !isNewline {
+		result.framer = framer
+	}
+	return result
+}
+
+// Lines are converted from encoding to UTF-8. Invalid sequences are handled according to policy.
+func (r *lineReader) setEncoding(encoding Encoding, policy InvalidEncodingPolicy) {
+	r.encoding = encoding
+	r.configuredEncoding = encoding
+	r.invalidEncodingPolicy = policy
+	r.bomPending = r.bomPending && encoding.hasBOM()
+}
+
+// DetectEncoding sets the encoding from the byte order mark in header, which is the start of the file.
+// Call this after Reset() if the file is not read from the start.
+func (r *lineReader) DetectEncoding(header []byte) {
+	if !r.configuredEncoding.hasBOM() {
+		return
+	}
+	if length, encoding, _ := detectBOM(header); length > 0 {
+		r.encoding = encoding
 	}
 }
 
 // read the next line from the file.
 // return values are (line, eof, err).
-// * line is the line read.
+// * line is the line read, converted to UTF-8.
 // * eof is a boolean indicating if the end of file was reached before getting to the next '\n'.
 // * err is set if an error other than io.EOF has occurred. err is never io.EOF.
 // if eof is true, line is always "" and err always is nil.
 // if eof is false and err is nil, an empty line means that there actually was an empty line in the file.
+// If a max line length is set, remainingBytesFromLastRead will not grow much larger than the max line length.
+// Lines exceeding the max line length are handled according to the policy, and are reported via TakeLongLines().
 func (r *lineReader) ReadLine(file io.Reader) (string, bool, error) {
+	var (
+		line string
+		eof  bool
+		err  error
+	)
+	if r.bomPending {
+		eof, err = r.readBOM(file)
+		if eof || err != nil {
+			return "", eof, err
+		}
+	}
+	if framer := r.currentFramer(); framer != nil {
+		line, eof, err = r.readRecord(file, framer)
+	} else {
+		line, eof, err = r.readLine(file)
+	}
+	if eof || err != nil {
+		return "", eof, err
+	}
+	return r.encoding.decode(line, r.invalidEncodingPolicy), false, nil
+}
+
+// Reads the start of the file and removes the byte order mark, if there is one.
+// Returns eof if the file is too short to tell.
+func (r *lineReader) readBOM(file io.Reader) (bool, error) {
+	var (
+		err error
+		buf = make([]byte, 512)
+		n   = 0
+	)
+	for {
+		length, encoding, incomplete := detectBOM(r.remainingBytesFromLastRead)
+		if !incomplete {
+			r.bomPending = false
+			if length > 0 {
+				r.encoding = encoding
+				r.consume(length)
+			}
+			return false, nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return true, nil
+			} else {
+				return false, err
+			}
+		}
+		n, err = file.Read(buf)
+		if n > 0 {
+			r.remainingBytesFromLastRead = append(r.remainingBytesFromLastRead, buf[0:n]...)
+		}
+	}
+}
+
+// Returns the framer for the current file, or nil for the default handling of lines terminated by '\n'.
+func (r *lineReader) currentFramer() Framer {
+	if r.framer == nil && r.encoding.isUTF16() {
+		return utf16NewlineFramer{bigEndian: r.encoding == UTF16BE}
+	}
+	return r.framer
+}
+
+// ReadLine() for lines terminated by '\n' in ASCII-compatible encodings, without conversion to UTF-8.
+func (r *lineReader) readLine(file io.Reader) (string, bool, error) {
 	var (
 		err error
 		buf = make([]byte, 512)
 		n   = 0
 	)
+	r.truncated = false
 	for {
 		newlinePos := bytes.IndexByte(r.remainingBytesFromLastRead, '\n')
-		if newlinePos >= 0 {
-			l := len(r.remainingBytesFromLastRead)
-			result := make([]byte, newlinePos)
-			copy(result, r.remainingBytesFromLastRead[:newlinePos])
-			copy(r.remainingBytesFromLastRead, r.remainingBytesFromLastRead[newlinePos+1:])
-			r.remainingBytesFromLastRead = r.remainingBytesFromLastRead[:l-(newlinePos+1)]
-			return string(stripWindowsLineEnding(result)), false, nil
-		} else if err != nil {
+		switch {
+		case r.longLine != nil && r.longLine.skipping && len(r.remainingBytesFromLastRead) > 0:
+			if newlinePos >= 0 {
+				r.discard(newlinePos)
+				r.consume(1)
+				r.finishLongLine()
+			} else {
+				r.discard(len(r.remainingBytesFromLastRead))
+			}
+			continue
+		case newlinePos >= 0 && !r.exceedsMaxLineLength(newlinePos):
+			line := stripWindowsLineEnding(r.consume(newlinePos + 1)[:newlinePos])
+			if r.longLine != nil {
+				// last chunk of a split line
+				r.longLine.length += int64(len(line))
+				r.finishLongLine()
+				if len(line) == 0 {
+					continue
+				}
+			}
+			r.lineNumber++
+			return string(line), false, nil
+		case r.exceedsMaxLineLength(len(r.remainingBytesFromLastRead)):
+			if r.longLine == nil {
+				r.longLine = &longLine{offset: r.offset}
+			}
+			switch r.longLinePolicy {
+			case SkipLongLines:
+				r.longLine.skipping = true
+				continue
+			case SplitLongLines:
+				r.longLine.length += int64(r.maxLineLength)
+				r.lineNumber++
+				return string(r.consume(r.maxLineLength)), false, nil
+			default: // TruncateLongLines
+				r.longLine.length += int64(r.maxLineLength)
+				r.longLine.skipping = true
+				r.lineNumber++
+				r.truncated = true
+				return string(r.consume(r.maxLineLength)), false, nil
+			}
+		case err != nil:
 			if err == io.EOF {
 				return "", true, nil
 			} else {
 				return "", false, err
 			}
-		} else {
+		default:
 			n, err = file.Read(buf)
 			if n > 0 {
 				// io.Reader: Callers should always process the n > 0 bytes returned before considering the error err.
@@ -67,6 +230,276 @@ func (r *lineReader) ReadLine(file io.Reader) (string, bool, error) {
 	}
 }
 
+// ReadLine() for records split by a Framer.
+// Framed records are buffered until they are complete, and the max line length is applied to complete records.
+// Records that exceed the max line length before they are complete are handled by nextLongRecordChunk().
+func (r *lineReader) readRecord(file io.Reader, framer Framer) (string, bool, error) {
+	var (
+		err error
+		buf = make([]byte, 512)
+		n   = 0
+	)
+	r.truncated = false
+	for {
+		if r.splitRecord != nil {
+			return r.nextSplitChunk(), false, nil
+		}
+		if len(r.remainingBytesFromLastRead) > 0 {
+			var (
+				line     string
+				ok       bool
+				progress bool
+				frameErr error
+			)
+			if r.longLine != nil {
+				line, ok, progress, frameErr = r.nextLongRecordChunk(framer)
+			} else {
+				line, ok, progress, frameErr = r.nextRecord(framer)
+			}
+			if frameErr != nil {
+				return "", false, frameErr
+			}
+			if ok {
+				return line, false, nil
+			}
+			if progress {
+				continue
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return "", true, nil
+			} else {
+				return "", false, err
+			}
+		}
+		n, err = file.Read(buf)
+		if n > 0 {
+			r.remainingBytesFromLastRead = append(r.remainingBytesFromLastRead, buf[0:n]...)
+		}
+	}
+}
+
+// Frames the next record. ok is true if a line is returned, progress is false if more data is needed.
+// If the record is incomplete, but already exceeds the max line length, it is not buffered until it is complete.
+// Instead, its start is returned according to the policy, and the rest is handled by nextLongRecordChunk().
+func (r *lineReader) nextRecord(framer Framer) (string, bool, bool, error) {
+	advance, record, err := framer.Frame(r.remainingBytesFromLastRead, false)
+	if err != nil {
+		return "", false, false, err
+	}
+	if advance > 0 {
+		line, ok := r.applyMaxLineLength(advance, record)
+		return line, ok, true, nil
+	}
+	if !r.exceedsMaxRecordLength(framer) {
+		return "", false, false, nil
+	}
+	r.longLine = &longLine{offset: r.offset, remaining: -1}
+	var (
+		recordStart []byte
+		prefix      int // bytes of the frame before the record, not counted as part of the long line
+	)
+	if sized, isSized := framer.(sizedFramer); isSized {
+		if frameSize, start, known := sized.frameSize(r.remainingBytesFromLastRead); known {
+			r.longLine.remaining = frameSize - int64(start)
+			recordStart = r.remainingBytesFromLastRead[start:]
+			prefix = start
+		}
+	} else if _, record, err = framer.Frame(r.remainingBytesFromLastRead, true); err == nil {
+		recordStart = record
+	}
+	r.longLine.skipping = true
+	var line string
+	if r.longLinePolicy != SkipLongLines && len(recordStart) > 0 {
+		// TruncateLongLines, and SplitLongLines, because we can only split complete records.
+		// The returned bytes are still part of the frame, they are not counted as discarded when the frame is skipped.
+		line = string(recordStart[:min(len(recordStart), r.chunkLength())])
+		r.longLine.discarded = -int64(len(line))
+		r.lineNumber++
+		r.truncated = true
+	}
+	r.consume(prefix)
+	if r.longLine.remaining < 0 {
+		// The buffered bytes don't contain the end of the record, so skip them now. Afterwards, the
+		// buffer no longer starts with the frame, which is what recordEndFinder expects.
+		r.discard(r.discardableLength(framer))
+	}
+	return line, r.truncated, true, nil
+}
+
+// Skips the rest of a long framed record, see nextRecord().
+// The last bytes are kept in case they contain the start of the terminator of a record.
+func (r *lineReader) nextLongRecordChunk(framer Framer) (string, bool, bool, error) {
+	if r.longLine.remaining >= 0 {
+		n := int(min(r.longLine.remaining, int64(len(r.remainingBytesFromLastRead))))
+		r.discard(n)
+		r.longLine.remaining -= int64(n)
+		if r.longLine.remaining == 0 {
+			r.finishLongLine()
+		}
+		return "", false, true, nil
+	}
+	if finder, isFinder := framer.(recordEndFinder); isFinder {
+		if end, next, found := finder.findRecordEnd(r.remainingBytesFromLastRead); found {
+			r.discard(end)
+			r.consume(next - end)
+			r.finishLongLine()
+			return "", false, true, nil
+		}
+	} else {
+		// Custom framers don't know that the data doesn't start with a frame, the best we can do is to let them find the next frame.
+		advance, _, err := framer.Frame(r.remainingBytesFromLastRead, false)
+		if err != nil {
+			return "", false, false, err
+		}
+		if advance > 0 {
+			r.discard(advance)
+			r.finishLongLine()
+			return "", false, true, nil
+		}
+	}
+	n := r.discardableLength(framer)
+	if n <= 0 {
+		return "", false, false, nil
+	}
+	r.discard(n)
+	return "", false, true, nil
+}
+
+// Framers may add a few bytes to a record, like a length prefix or a terminator.
+// An incomplete frame is considered too long if it exceeds the max line length by more than this.
+const maxFramingOverhead = 64
+
+// Returns true if the buffered bytes don't contain a complete record, and the record will exceed the max line length.
+func (r *lineReader) exceedsMaxRecordLength(framer Framer) bool {
+	return r.maxLineLength > 0 && len(r.remainingBytesFromLastRead) > r.maxLineLength+framingOverhead(framer)
+}
+
+func framingOverhead(framer Framer) int {
+	if delimited, isDelimited := framer.(*delimiterFramer); isDelimited && len(delimited.delim) > maxFramingOverhead {
+		return len(delimited.delim)
+	}
+	return maxFramingOverhead
+}
+
+// Returns the number of bytes of an incomplete long record that can be skipped without missing its end.
+func (r *lineReader) discardableLength(framer Framer) int {
+	n := len(r.remainingBytesFromLastRead) - framingOverhead(framer)
+	if r.encoding.isUTF16() {
+		n &^= 1 // don't split UTF-16 code units
+	}
+	return n
+}
+
+// Consumes the framed record and returns it, if it is not skipped.
+// Records exceeding the max line length are handled according to the policy.
+func (r *lineReader) applyMaxLineLength(advance int, record []byte) (string, bool) {
+	if record == nil {
+		// The framer skipped some bytes.
+		r.consume(advance)
+		return "", false
+	}
+	if r.maxLineLength <= 0 || len(record) <= r.maxLineLength {
+		line := string(record)
+		r.consume(advance)
+		r.lineNumber++
+		return line, true
+	}
+	r.longLine = &longLine{offset: r.offset, length: int64(len(record))}
+	switch r.longLinePolicy {
+	case SkipLongLines:
+		r.longLine.discarded = int64(len(record))
+		r.consume(advance)
+		r.finishLongLine()
+		return "", false
+	case SplitLongLines:
+		// The offset stays at the start of the record until the last chunk is returned,
+		// so that a restart resumes with the complete record.
+		r.splitRecord = append([]byte(nil), record...)
+		r.splitRecordAdvance = advance
+		return r.nextSplitChunk(), true
+	default: // TruncateLongLines
+		line := string(record[:r.chunkLength()])
+		r.longLine.discarded = int64(len(record) - r.chunkLength())
+		r.consume(advance)
+		r.finishLongLine()
+		r.lineNumber++
+		r.truncated = true
+		return line, true
+	}
+}
+
+// Returns the length of chunks of long framed records, which must not split UTF-16 code units.
+func (r *lineReader) chunkLength() int {
+	switch {
+	case !r.encoding.isUTF16():
+		return r.maxLineLength
+	case r.maxLineLength < 2:
+		return 2
+	default:
+		return r.maxLineLength &^ 1
+	}
+}
+
+func (r *lineReader) nextSplitChunk() string {
+	r.lineNumber++
+	if len(r.splitRecord) > r.chunkLength() {
+		chunk := string(r.splitRecord[:r.chunkLength()])
+		r.splitRecord = r.splitRecord[r.chunkLength():]
+		return chunk
+	}
+	chunk := string(r.splitRecord)
+	r.splitRecord = nil
+	r.consume(r.splitRecordAdvance)
+	r.finishLongLine()
+	return chunk
+}
+
+// Returns true if a line of length bytes (including a trailing '\r', but not including '\n') is too long.
+func (r *lineReader) exceedsMaxLineLength(length int) bool {
+	if r.maxLineLength <= 0 || length <= r.maxLineLength {
+		return false
+	}
+	// Don't count the '\r' of a Windows line ending.
+	return length != r.maxLineLength+1 || r.remainingBytesFromLastRead[r.maxLineLength] != '\r'
+}
+
+// Removes n bytes from the start of remainingBytesFromLastRead and returns a copy of them.
+func (r *lineReader) consume(n int) []byte {
+	result := make([]byte, n)
+	copy(result, r.remainingBytesFromLastRead[:n])
+	l := len(r.remainingBytesFromLastRead)
+	copy(r.remainingBytesFromLastRead, r.remainingBytesFromLastRead[n:])
+	r.remainingBytesFromLastRead = r.remainingBytesFromLastRead[:l-n]
+	r.offset += int64(n)
+	return result
+}
+
+// Discards n bytes of the current long line.
+func (r *lineReader) discard(n int) {
+	r.consume(n)
+	r.longLine.length += int64(n)
+	r.longLine.discarded += int64(n)
+}
+
+func (r *lineReader) finishLongLine() {
+	r.finishedLongLines = append(r.finishedLongLines, r.longLine)
+	r.longLine = nil
+}
+
+// TakeLongLines returns the lines exceeding the max line length that were completely read since the last call.
+func (r *lineReader) TakeLongLines() []*longLine {
+	result := r.finishedLongLines
+	r.finishedLongLines = nil
+	return result
+}
+
+// Truncated returns true if the last line returned by ReadLine() was truncated.
+func (r *lineReader) Truncated() bool {
+	return r.truncated
+}
+
 func stripWindowsLineEnding(s []byte) []byte {
 	if len(s) > 0 && s[len(s)-1] == '\r' {
 		return s[:len(s)-1]
@@ -75,6 +508,92 @@ func stripWindowsLineEnding(s []byte) []byte {
 	}
 }
 
+// Remainder returns the bytes after the last '\n' as the last line, for files that are known to be complete.
+// It returns "" if there are no remaining bytes.
+func (r *lineReader) Remainder() string {
+	var line string
+	r.truncated = false
+	r.bomPending = false
+	if framer := r.currentFramer(); framer != nil {
+		line = r.framedRemainder(framer)
+	} else {
+		line = r.lineRemainder()
+	}
+	return r.encoding.decode(line, r.invalidEncodingPolicy)
+}
+
+// Remainder() for lines terminated by '\n'.
+func (r *lineReader) lineRemainder() string {
+	if r.longLine != nil && r.longLine.skipping {
+		r.discard(len(r.remainingBytesFromLastRead))
+		r.finishLongLine()
+		return ""
+	}
+	if len(r.remainingBytesFromLastRead) == 0 {
+		if r.longLine != nil {
+			r.finishLongLine()
+		}
+		return ""
+	}
+	result := stripWindowsLineEnding(r.consume(len(r.remainingBytesFromLastRead)))
+	if r.longLine != nil {
+		// last chunk of a split line
+		r.longLine.length += int64(len(result))
+		r.finishLongLine()
+	}
+	r.lineNumber++
+	return string(result)
+}
+
+// Remainder() for records split by a Framer. Incomplete records are discarded.
+func (r *lineReader) framedRemainder(framer Framer) string {
+	if r.longLine != nil {
+		r.discard(len(r.remainingBytesFromLastRead))
+		r.finishLongLine()
+	}
+	for {
+		if r.splitRecord != nil {
+			return r.nextSplitChunk()
+		}
+		if len(r.remainingBytesFromLastRead) == 0 {
+			return ""
+		}
+		advance, record, err := framer.Frame(r.remainingBytesFromLastRead, true)
+		if err != nil || advance == 0 {
+			r.consume(len(r.remainingBytesFromLastRead))
+			return ""
+		}
+		if line, ok := r.applyMaxLineLength(advance, record); ok {
+			return line
+		}
+	}
+}
+
+// Offset returns the file offset of the first byte that was not yet returned by ReadLine().
+// This is where reading should be resumed after a restart.
+func (r *lineReader) Offset() int64 {
+	return r.offset
+}
+
+// LineNumber returns the number of lines returned by ReadLine() since the last call to Reset() or Clear(),
+// i.e. the line number of the last line returned.
+func (r *lineReader) LineNumber() int64 {
+	return r.lineNumber
+}
+
+// Clear discards the remaining bytes and resets the offset to 0. Call this after seeking the file to the start.
 func (r *lineReader) Clear() {
+	r.Reset(0)
+}
+
+// Reset discards the remaining bytes. Call this after seeking the file to offset.
+func (r *lineReader) Reset(offset int64) {
 	r.remainingBytesFromLastRead = r.remainingBytesFromLastRead[:0]
+	r.offset = offset
+	r.lineNumber = 0
+	r.longLine = nil
+	r.truncated = false
+	r.splitRecord = nil
+	r.encoding = r.configuredEncoding
+	r.bomPending = offset == 0 && r.configuredEncoding.hasBOM()
 }
@@ -0,0 +1,50 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+// TailerMetrics is notified about the internals of a file tailer, see Options.Metrics.
+// The methods are called from the tailer's goroutine, so they must be fast and must not block.
+// Embed NoopMetrics to implement only some of the methods.
+type TailerMetrics interface {
+	// LinesRead is called with the number of lines and bytes read from a file.
+	LinesRead(path string, lines int, bytes int64)
+	// ReadPosition is called when the tailer has read up to the end of a file.
+	// The lag is size - offset, the tailer might have read a line while the file was growing.
+	ReadPosition(path string, offset int64, size int64)
+	// FileOpened and FileClosed are called when the tailer starts and stops reading a file.
+	// A renamed file is reported as closed under the old path and opened under the new path.
+	FileOpened(path string)
+	FileClosed(path string)
+	// FileRotated is called when a file was rotated away or deleted.
+	FileRotated(path string)
+	// FileTruncated is called when a file was truncated, or re-written from the start.
+	FileTruncated(path string)
+	// EventProcessed is called for each file system event, including synthetic events from polling.
+	EventProcessed()
+	// Error is called for each error reported on the Errors() channel, including warnings like LineTooLongError.
+	Error(err Error)
+}
+
+// NoopMetrics implements TailerMetrics without doing anything.
+type NoopMetrics struct{}
+
+func (NoopMetrics) LinesRead(path string, lines int, bytes int64)      {}
+func (NoopMetrics) ReadPosition(path string, offset int64, size int64) {}
+func (NoopMetrics) FileOpened(path string)                             {}
+func (NoopMetrics) FileClosed(path string)                             {}
+func (NoopMetrics) FileRotated(path string)                            {}
+func (NoopMetrics) FileTruncated(path string)                          {}
+func (NoopMetrics) EventProcessed()                                    {}
+func (NoopMetrics) Error(err Error)                                    {}
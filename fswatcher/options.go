@@ -0,0 +1,226 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/jdrews/go-tailer/glob"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Backend defines how the file tailer learns that files were changed.
+type Backend int
+
+const (
+	// Use the operating system's file system events (inotify on Linux, kqueue on macOS, ReadDirectoryChangesW on Windows).
+	FseventBackend Backend = iota
+	// Poll all watched directories and files every PollInterval.
+	PollingBackend
+	// Use file system events, and additionally poll every PollInterval to catch changes
+	// that don't trigger events, like changes on network file systems.
+	HybridBackend
+)
+
+func (b Backend) String() string {
+	switch b {
+	case FseventBackend:
+		return "fsevent"
+	case PollingBackend:
+		return "polling"
+	case HybridBackend:
+		return "hybrid"
+	default:
+		return fmt.Sprintf("Backend(%d)", int(b))
+	}
+}
+
+// ParseBackend parses the String() representation of a Backend.
+func ParseBackend(s string) (Backend, error) {
+	for _, b := range []Backend{FseventBackend, PollingBackend, HybridBackend} {
+		if s == b.String() {
+			return b, nil
+		}
+	}
+	return FseventBackend, fmt.Errorf("%q: invalid backend, expected one of \"fsevent\", \"polling\", or \"hybrid\"", s)
+}
+
+// LongLinePolicy defines what happens with lines exceeding Options.MaxLineLength.
+// Each long line is reported as a LineTooLongError on the Errors() channel. The tailer keeps running.
+type LongLinePolicy int
+
+const (
+	// Emit the first MaxLineLength bytes with Line.Truncated set, and discard the rest of the line.
+	TruncateLongLines LongLinePolicy = iota
+	// Emit the line in chunks of MaxLineLength bytes. Each chunk is emitted as a separate Line.
+	// Framed records that exceed MaxLineLength before they are complete are truncated, because they are not buffered.
+	SplitLongLines
+	// Discard the line.
+	SkipLongLines
+)
+
+func (p LongLinePolicy) String() string {
+	switch p {
+	case TruncateLongLines:
+		return "truncate"
+	case SplitLongLines:
+		return "split"
+	case SkipLongLines:
+		return "skip"
+	default:
+		return fmt.Sprintf("LongLinePolicy(%d)", int(p))
+	}
+}
+
+// ParseLongLinePolicy parses the String() representation of a LongLinePolicy.
+func ParseLongLinePolicy(s string) (LongLinePolicy, error) {
+	for _, p := range []LongLinePolicy{TruncateLongLines, SplitLongLines, SkipLongLines} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return TruncateLongLines, fmt.Errorf("%q: invalid long line policy, expected one of \"truncate\", \"split\", or \"skip\"", s)
+}
+
+// Options configures a file tailer started with Run().
+// The zero value of each field is a valid default, except for Globs, which must not be empty.
+type Options struct {
+	Globs []glob.Glob
+	// Files matching one of the Exclude patterns are not tailed, even if they match one of the Globs.
+	// Use glob.ParseMatcher() for patterns like *-debug.log
+	Exclude []glob.Matcher
+	// If PathMatcher is set, files matching one of the Globs are only tailed if PathMatcher matches as well.
+	// Use glob.ParseRegex() for patterns that cannot be expressed with globs.
+	PathMatcher glob.Matcher
+	// If Readall is true, files found on startup are read from the beginning, otherwise from the end.
+	// Files created while the tailer is running are always read from the beginning.
+	Readall bool
+	// If FailOnMissingFile is true, the tailer fails on startup if a glob doesn't match any file.
+	FailOnMissingFile bool
+	// If WaitForDirectories is true, the tailer doesn't fail if a glob's directory doesn't exist. It watches the nearest
+	// existing parent directory instead, and starts watching the directory when it is created. If the directory is
+	// removed, the tailer waits for it to be created again. FailOnMissingFile is still checked on startup.
+	WaitForDirectories bool
+	Backend            Backend
+	// PollInterval is used by PollingBackend and HybridBackend. Zero means DefaultPollInterval.
+	PollInterval time.Duration
+	// If CheckpointStore is set, the read positions are saved and files are resumed after a restart.
+	// See RunFileTailerWithCheckpoints().
+	CheckpointStore CheckpointStore
+	// CheckpointInterval is how often checkpoints are saved while running. Zero means DefaultCheckpointInterval.
+	// If saving fails while running, the error is reported on the Errors() channel and the tailer keeps running.
+	CheckpointInterval time.Duration
+	// MaxLineLength limits the length of a line in bytes, not including the line terminator. Zero means unlimited.
+	// Without limit, a file without newlines is buffered completely in memory.
+	MaxLineLength  int
+	LongLinePolicy LongLinePolicy
+	// Framer splits files into records. Nil means NewlineFramer().
+	// With MaxLineLength, incomplete records are buffered up to a little more than MaxLineLength bytes.
+	Framer Framer
+	// Framers overrides Framer for files matching specific globs. The keys should be elements of Globs.
+	// If a file matches multiple globs, the first matching glob in Globs wins.
+	Framers map[glob.Glob]Framer
+	// Encoding is the character encoding of the files. Lines are converted to UTF-8. The default is UTF8.
+	// A byte order mark at the start of a file overrides the encoding.
+	Encoding Encoding
+	// Encodings overrides Encoding for files matching specific globs, like Framers.
+	Encodings             map[glob.Glob]Encoding
+	InvalidEncodingPolicy InvalidEncodingPolicy
+	// Header defines the header lines at the start of each file, like the column names of a CSV file. Nil means no header.
+	// The header is read when a file is opened, even if reading starts at the end of the file, and when a file is truncated.
+	// Header lines are not sent as lines, instead the header is attached to each line of the file as Line.Header.
+	Header HeaderFunc
+	// Headers overrides Header for files matching specific globs, like Framers.
+	Headers map[glob.Glob]HeaderFunc
+	// RotationGracePeriod is how long files that were rotated away or deleted are still read before they are closed,
+	// because the application might still write to the old file for a while. Zero means that the remaining lines are
+	// read once when the rotation is detected. The replacement file is read in parallel.
+	RotationGracePeriod time.Duration
+	// FingerprintSize is the number of bytes at the start of each file that are hashed to detect re-used inodes,
+	// and files that were truncated and rewritten past the read position (copytruncate).
+	// Zero means DefaultFingerprintSize, a negative value disables fingerprints.
+	FingerprintSize int
+	// If MaxBatchSize is greater than zero, lines are delivered in batches of up to MaxBatchSize lines on
+	// the Batches() channel of the BatchTailer. Consumers that read the Lines() channel instead still get
+	// each line, but lines may wait for up to MaxBatchLatency before they are sent.
+	MaxBatchSize int
+	// MaxBatchLatency is how long a line may wait in an incomplete batch before the batch is sent.
+	// Zero means DefaultMaxBatchLatency.
+	MaxBatchLatency time.Duration
+	// Metrics is notified about lines read, open files, rotations, errors, etc. Nil disables metrics.
+	// See the metrics package for a Prometheus implementation.
+	Metrics TailerMetrics
+	// Log defaults to a new logrus logger.
+	Log logrus.FieldLogger
+}
+
+// The default for Options.PollInterval.
+const DefaultPollInterval = time.Second
+
+// The default for Options.MaxBatchLatency.
+const DefaultMaxBatchLatency = 100 * time.Millisecond
+
+// Run starts a file tailer. This is equivalent to RunContext(context.Background(), opts).
+func Run(opts Options) (FileTailer, error) {
+	return RunContext(context.Background(), opts)
+}
+
+// RunContext starts a file tailer that is closed when ctx is done.
+func RunContext(ctx context.Context, opts Options) (FileTailer, error) {
+	var initFunc func() (fswatcher, Error)
+	if len(opts.Globs) == 0 {
+		return nil, fmt.Errorf("invalid options: no globs")
+	}
+	if opts.PollInterval < 0 || opts.CheckpointInterval < 0 || opts.RotationGracePeriod < 0 || opts.MaxBatchLatency < 0 {
+		return nil, fmt.Errorf("invalid options: intervals must not be negative")
+	}
+	if opts.MaxLineLength < 0 {
+		return nil, fmt.Errorf("invalid options: max line length must not be negative")
+	}
+	if opts.MaxBatchSize < 0 {
+		return nil, fmt.Errorf("invalid options: max batch size must not be negative")
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.FingerprintSize == 0 {
+		opts.FingerprintSize = DefaultFingerprintSize
+	}
+	if opts.MaxBatchLatency == 0 {
+		opts.MaxBatchLatency = DefaultMaxBatchLatency
+	}
+	if opts.CheckpointInterval == 0 {
+		opts.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if opts.Log == nil {
+		opts.Log = logrus.New()
+	}
+	switch opts.Backend {
+	case FseventBackend:
+		initFunc = initWatcher
+	case PollingBackend:
+		initFunc = func() (fswatcher, Error) {
+			return initPollingWatcher(opts.PollInterval)
+		}
+	case HybridBackend:
+		initFunc = func() (fswatcher, Error) {
+			return initHybridWatcher(opts.PollInterval)
+		}
+	default:
+		return nil, fmt.Errorf("invalid options: unknown backend %v", opts.Backend)
+	}
+	return runFileTailer(ctx, initFunc, opts)
+}
@@ -17,11 +17,15 @@ package fswatcher
 import "time"
 
 type pollloop struct {
-	events chan fsevent
-	errors chan Error // unused
-	done   chan struct{}
+	events  chan fsevent
+	errors  chan Error // unused
+	done    chan struct{}
+	stopped chan struct{}
 }
 
+// The event sent by the poll loop every pollInterval.
+type pollEvent struct{}
+
 func (l *pollloop) Events() chan fsevent {
 	return l.events
 }
@@ -30,6 +34,10 @@ func (l *pollloop) Errors() chan Error {
 	return l.errors
 }
 
+func (l *pollloop) Stopped() chan struct{} {
+	return l.stopped
+}
+
 func (l *pollloop) Close() {
 	close(l.done)
 }
@@ -39,18 +47,20 @@ func runPollLoop(pollInterval time.Duration) *pollloop {
 	events := make(chan fsevent)
 	errors := make(chan Error) // unused
 	done := make(chan struct{})
+	stopped := make(chan struct{})
 
 	go func() {
 		defer func() {
 			close(events)
 			close(errors)
+			close(stopped)
 		}()
 		for {
 			tick := time.After(pollInterval)
 			select {
 			case <-tick:
 				select {
-				case events <- struct{}{}:
+				case events <- pollEvent{}:
 				case <-done:
 					return
 				}
@@ -60,8 +70,9 @@ func runPollLoop(pollInterval time.Duration) *pollloop {
 		}
 	}()
 	return &pollloop{
-		events: events,
-		errors: errors,
-		done:   done,
+		events:  events,
+		errors:  errors,
+		done:    done,
+		stopped: stopped,
 	}
 }
@@ -35,6 +35,10 @@ func (w *pollingWatcher) runFseventProducerLoop() fseventProducerLoop {
 }
 
 func (w *pollingWatcher) processEvent(t *fileTailer, fsevent fsevent, log logrus.FieldLogger) Error {
+	Err := t.syncDirs(log)
+	if Err != nil {
+		return Err
+	}
 	for _, dir := range t.watchedDirs {
 		err := t.syncFilesInDir(dir, true, log)
 		if err != nil {
@@ -42,7 +46,7 @@ func (w *pollingWatcher) processEvent(t *fileTailer, fsevent fsevent, log logrus
 		}
 	}
 	for _, file := range t.watchedFiles {
-		truncated, err := isTruncated(file.file)
+		truncated, err := t.isTruncated(file)
 		if err != nil {
 			return NewErrorf(NotSpecified, err, "%v: seek() or stat() failed", file.file.Name())
 		}
@@ -51,7 +55,7 @@ func (w *pollingWatcher) processEvent(t *fileTailer, fsevent fsevent, log logrus
 			if err != nil {
 				return NewErrorf(NotSpecified, err, "%v: seek() failed", file.file.Name())
 			}
-			file.reader.Clear()
+			t.restartTruncatedFile(file)
 		}
 		readErr := t.readNewLines(file, log)
 		if readErr != nil {
@@ -15,6 +15,10 @@
 package go_tailer
 
 import (
+	"bytes"
+	"compress/gzip"
+	ctx "context"
+	"errors"
 	"fmt"
 	"github.com/jdrews/go-tailer/fswatcher"
 	"github.com/jdrews/go-tailer/glob"
@@ -30,6 +34,7 @@ import (
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf16"
 )
 
 const tests = `
@@ -122,6 +127,38 @@ const tests = `
   - [expect, outer line 3, outer/logfile.log]
   - [expect, inner line 3, outer/inner/logfile.log]
 
+- name: wildcard directories
+  commands:
+  - [mkdir, logdir]
+  - [mkdir, logdir/app1]
+  - [log, app1 line 1, logdir/app1/logfile.log]
+  - [start file tailer, readall=true, fail_on_missing_logfile=false, logdir/*/*.log]
+  - [expect, app1 line 1, logdir/app1/logfile.log]
+  - [mkdir, logdir/app2]
+  - [log, app2 line 1, logdir/app2/logfile.log]
+  - [log, app1 line 2, logdir/app1/logfile.log]
+  - [expect, app2 line 1, logdir/app2/logfile.log]
+  - [expect, app1 line 2, logdir/app1/logfile.log]
+  - [logrotate, logdir/app1/logfile.log, logdir/app1/logfile.log.1]
+  - [log, app1 line 3, logdir/app1/logfile.log]
+  - [expect, app1 line 3, logdir/app1/logfile.log]
+  - [rmdir, logdir/app2]
+  - [log, app1 line 4, logdir/app1/logfile.log]
+  - [expect, app1 line 4, logdir/app1/logfile.log]
+
+- name: recursive wildcard directories
+  commands:
+  - [mkdir, logdir]
+  - [log, top line 1, logdir/logfile.log]
+  - [start file tailer, readall=true, fail_on_missing_logfile=false, logdir/**/*.log]
+  - [expect, top line 1, logdir/logfile.log]
+  - [mkdir, logdir/a]
+  - [mkdir, logdir/a/b]
+  - [log, nested line 1, logdir/a/b/logfile.log]
+  - [expect, nested line 1, logdir/a/b/logfile.log]
+  - [log, top line 2, logdir/logfile.log]
+  - [expect, top line 2, logdir/logfile.log]
+
 - name: watch after logrotate
   commands:
   - [mkdir, logdir]
@@ -176,7 +213,7 @@ func TestAll(t *testing.T) {
 		t.Fatal(err)
 	}
 	for _, testConfig := range testConfigs {
-		for _, tailerOpt := range []fileTailerConfig{fseventTailer, pollingTailer} {
+		for _, tailerOpt := range []fileTailerConfig{fseventTailer, pollingTailer, hybridTailer} {
 			loggerCfg := closeFileAfterEachLine
 			// All logratate configs except for copy and copytruncate can be combined with logratateMoveConfig.
 			for _, logrotateCfg := range []logrotateConfig{_create, _nocreate, _create_from_temp} {
@@ -380,6 +417,8 @@ func exec(t *testing.T, ctx *context, cmd []string) {
 	switch cmd[0] {
 	case "mkdir":
 		mkdir(t, ctx, cmd[1])
+	case "rmdir":
+		rmdirOrFail(t, ctx, cmd[1])
 	case "log":
 		writer, exists := ctx.logFileWriters[cmd[2]]
 		if !exists {
@@ -598,6 +637,23 @@ func mkdir(t *testing.T, ctx *context, dirname string) {
 	}
 }
 
+func rmdirOrFail(t *testing.T, ctx *context, dirname string) {
+	fullpath := filepath.Join(ctx.basedir, dirname)
+	remainingWriters := make(map[string]logFileWriter)
+	for path, writer := range ctx.logFileWriters {
+		if strings.HasPrefix(filepath.Join(ctx.basedir, path), fullpath+string(filepath.Separator)) {
+			writer.close(t, ctx)
+		} else {
+			remainingWriters[path] = writer
+		}
+	}
+	ctx.logFileWriters = remainingWriters
+	err := os.RemoveAll(fullpath)
+	if err != nil {
+		fatalf(t, ctx, "rmdir %v failed: %v", dirname, err)
+	}
+}
+
 func startFileTailer(t *testing.T, ctx *context, params []string) {
 	var (
 		parsedGlobs       []glob.Glob
@@ -628,10 +684,20 @@ func startFileTailer(t *testing.T, ctx *context, params []string) {
 		}
 		parsedGlobs = append(parsedGlobs, parsedGlob)
 	}
-	if ctx.tailerCfg == fseventTailer {
+	switch ctx.tailerCfg {
+	case fseventTailer:
 		tailer, err = fswatcher.RunFileTailer(parsedGlobs, readall, failOnMissingFile, ctx.log)
-	} else {
+	case pollingTailer:
 		tailer, err = fswatcher.RunPollingFileTailer(parsedGlobs, readall, failOnMissingFile, 10*time.Millisecond, ctx.log)
+	default:
+		tailer, err = fswatcher.Run(fswatcher.Options{
+			Globs:             parsedGlobs,
+			Readall:           readall,
+			FailOnMissingFile: failOnMissingFile,
+			Backend:           fswatcher.HybridBackend,
+			PollInterval:      10 * time.Millisecond,
+			Log:               ctx.log,
+		})
 	}
 	if err != nil {
 		fatalf(t, ctx, "%v", err)
@@ -684,6 +750,7 @@ const (
 const (
 	fseventTailer fileTailerConfig = iota
 	pollingTailer
+	hybridTailer
 )
 
 func (opt logrotateConfig) String() string {
@@ -735,6 +802,8 @@ func (opt fileTailerConfig) String() string {
 		return "fseventTailer"
 	case opt == pollingTailer:
 		return "pollingTailer"
+	case opt == hybridTailer:
+		return "hybridTailer"
 	default:
 		return "unknown"
 	}
@@ -852,11 +921,11 @@ func deleteRecursively(t *testing.T, ctx *context, file string) {
 		}
 	}
 	ctx.log.Debugf("tearDown: removing %q", file)
-	delete(t, ctx, file)
+	deleteFile(t, ctx, file)
 }
 
 // Verbose implementation of os.Remove() to debug a Windows "Access is denied" issue.
-func delete(t *testing.T, ctx *context, file string) {
+func deleteFile(t *testing.T, ctx *context, file string) {
 	var (
 		err, statErr error
 		timeout      = 5 * time.Second
@@ -986,6 +1055,1072 @@ func runTestShutdown(t *testing.T, mode string) {
 	assertGoroutinesTerminated(t, ctx, nGoroutinesBefore)
 }
 
+// Cancel the context while the tailer is trying to send a line, and make sure Shutdown() waits until everything is closed.
+func TestShutdownWithContext(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("The shutdown tests are flaky on Windows, see runTestShutdown().")
+		return
+	}
+
+	parent, cancel := ctx.WithCancel(ctx.Background())
+	defer cancel()
+	shutdownCtx, cancelShutdown := ctx.WithTimeout(ctx.Background(), 5*time.Second)
+	defer cancelShutdown()
+
+	nGoroutinesBefore := runtime.NumGoroutine()
+
+	ctx := setUp(t, "test shutdown with context", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	writer := newLogFileWriter(t, ctx, filepath.Join(ctx.basedir, "test.log"))
+	writer.writeLine(t, ctx, "line 1")
+
+	parsedGlob, err := glob.Parse(filepath.Join(ctx.basedir, "test.log"))
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	tailer, err := fswatcher.RunFileTailerContext(parent, []glob.Glob{parsedGlob}, true, true, ctx.log)
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	// tailer is now trying to write line 1 to the Lines channel, but we are not reading it
+	cancel()
+	err = tailer.Shutdown(shutdownCtx)
+	if err != nil {
+		fatalf(t, ctx, "shutdown failed: %v", err)
+	}
+	if _, open := <-tailer.Lines(); open {
+		fatalf(t, ctx, "lines channel not closed")
+	}
+	if _, open := <-tailer.Errors(); open {
+		fatalf(t, ctx, "errors channel not closed")
+	}
+	// Shutdown() is idempotent.
+	err = tailer.Shutdown(shutdownCtx)
+	if err != nil {
+		fatalf(t, ctx, "second shutdown failed: %v", err)
+	}
+	assertGoroutinesTerminated(t, ctx, nGoroutinesBefore)
+}
+
+// Make sure offsets, line numbers, file identity and generation are set on the lines.
+func TestLineMetadata(t *testing.T) {
+	ctx := setUp(t, "line metadata", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	writer := newLogFileWriter(t, ctx, logfile)
+	writer.writeLine(t, ctx, "line 1")
+	writer.writeLine(t, ctx, "line 2")
+
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	ctx.tailer, err = fswatcher.RunFileTailer([]glob.Glob{parsedGlob}, true, true, ctx.log)
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	defer closeTailer(t, ctx, false)
+
+	start := time.Now()
+	line1 := nextLineWithMetadata(t, ctx)
+	line2 := nextLineWithMetadata(t, ctx)
+	lineLen := int64(len("line 1" + newline()))
+	if line1.Offset != 0 || line1.EndOffset != lineLen || line1.LineNumber != 1 || line1.Generation != 0 {
+		fatalf(t, ctx, "unexpected metadata for line 1: %#v", line1)
+	}
+	if line2.Offset != lineLen || line2.EndOffset != 2*lineLen || line2.LineNumber != 2 || line2.Generation != 0 {
+		fatalf(t, ctx, "unexpected metadata for line 2: %#v", line2)
+	}
+	if line1.ReadTime.Before(start.Add(-time.Second)) || line1.ReadTime.After(time.Now()) {
+		fatalf(t, ctx, "unexpected read time for line 1: %v", line1.ReadTime)
+	}
+	if line1.Inode == 0 || line1.Inode != line2.Inode || line1.Device != line2.Device {
+		fatalf(t, ctx, "unexpected file identity for lines 1 and 2: %#v, %#v", line1, line2)
+	}
+
+	truncateOrFail(t, ctx, "test.log")
+	writer.writeLine(t, ctx, "line 3")
+	line3 := nextLineWithMetadata(t, ctx)
+	if line3.Line != "line 3" || line3.Offset != 0 || line3.LineNumber != 1 || line3.Generation != 1 || line3.Inode != line1.Inode {
+		fatalf(t, ctx, "unexpected metadata for line 3 after truncate: %#v", line3)
+	}
+}
+
+func nextLineWithMetadata(t *testing.T, ctx *context) *fswatcher.Line {
+	select {
+	case line := <-ctx.tailer.Lines():
+		return line
+	case err := <-ctx.tailer.Errors():
+		fatalf(t, ctx, "unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		fatalf(t, ctx, "timeout while waiting for line")
+	}
+	return nil
+}
+
+// Lines exceeding the max line length are truncated, split, or skipped, and reported as LineTooLongError.
+func TestLongLines(t *testing.T) {
+	for _, test := range []struct {
+		policy            fswatcher.LongLinePolicy
+		expectedLines     []string
+		expectedDiscarded int64
+	}{
+		{fswatcher.TruncateLongLines, []string{"short", "0123456789", "after"}, 15},
+		{fswatcher.SplitLongLines, []string{"short", "0123456789", "0123456789", "01234", "after"}, 0},
+		{fswatcher.SkipLongLines, []string{"short", "after"}, 25},
+	} {
+		ctx := setUp(t, "long lines "+test.policy.String(), closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+		logfile := filepath.Join(ctx.basedir, "test.log")
+		writer := newLogFileWriter(t, ctx, logfile)
+		writer.writeLine(t, ctx, "short")
+		writer.writeLine(t, ctx, "0123456789012345678901234")
+		writer.writeLine(t, ctx, "after")
+
+		parsedGlob, err := glob.Parse(logfile)
+		if err != nil {
+			fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+		}
+		ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+			Globs:          []glob.Glob{parsedGlob},
+			Readall:        true,
+			MaxLineLength:  10,
+			LongLinePolicy: test.policy,
+			Log:            ctx.log,
+		})
+		if err != nil {
+			fatalf(t, ctx, "failed to start tailer: %v", err)
+		}
+		var longLineError *fswatcher.LineTooLongError
+		for _, expectedLine := range test.expectedLines {
+			var line *fswatcher.Line
+			for line == nil {
+				select {
+				case line = <-ctx.tailer.Lines():
+				case err := <-ctx.tailer.Errors():
+					if !errors.As(err, &longLineError) || err.Type() != fswatcher.LineTooLong {
+						fatalf(t, ctx, "unexpected error: %v", err)
+					}
+				case <-time.After(2 * time.Second):
+					fatalf(t, ctx, "%v: timeout while waiting for line %q", test.policy, expectedLine)
+				}
+			}
+			if line.Line != expectedLine {
+				fatalf(t, ctx, "%v: expected line %q but got %q", test.policy, expectedLine, line.Line)
+			}
+			if line.Truncated != (test.policy == fswatcher.TruncateLongLines && expectedLine == "0123456789") {
+				fatalf(t, ctx, "%v: unexpected truncated flag for line %q", test.policy, line.Line)
+			}
+		}
+		if longLineError == nil {
+			fatalf(t, ctx, "%v: long line was not reported", test.policy)
+		}
+		if longLineError.Length != 25 || longLineError.Discarded != test.expectedDiscarded || longLineError.Offset != int64(len("short")+len(newline())) {
+			fatalf(t, ctx, "%v: unexpected error: %v", test.policy, longLineError)
+		}
+		closeTailer(t, ctx, false)
+		tearDown(t, ctx)
+	}
+}
+
+// Framed records exceeding the max line length are handled before they are complete, so that they are not buffered.
+func TestLongIncompleteRecords(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	for _, test := range []struct {
+		name              string
+		framer            fswatcher.Framer
+		policy            fswatcher.LongLinePolicy
+		content           string
+		expectedLines     []string
+		prefixLength      int // bytes of the frame before the long record
+		expectedLength    int64
+		expectedDiscarded int64
+	}{
+		{"nul", fswatcher.DelimiterFramer("\x00"), fswatcher.TruncateLongLines, "short\x00" + long + "\x00after\x00", []string{"short", "xxxxxxxxxx", "after"}, 0, 300, 290},
+		{"nul", fswatcher.DelimiterFramer("\x00"), fswatcher.SkipLongLines, "short\x00" + long + "\x00after\x00", []string{"short", "after"}, 0, 300, 300},
+		// The record separator is counted, because the framer doesn't tell where the record starts.
+		{"rfc7464", fswatcher.RFC7464Framer(), fswatcher.TruncateLongLines, "\x1eshort\n\x1e" + long + "\x1e\"after\"\n", []string{"short", "xxxxxxxxxx", `"after"`}, 1, 301, 291},
+		{"length_prefix", fswatcher.LengthPrefixFramer(2), fswatcher.TruncateLongLines, "\x00\x05short\x01\x2c" + long + "\x00\x05after", []string{"short", "xxxxxxxxxx", "after"}, 2, 300, 290},
+	} {
+		name := test.name + " " + test.policy.String()
+		ctx := setUp(t, "long incomplete records "+name, closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+		logfile := filepath.Join(ctx.basedir, "test.log")
+		// The first part ends in the middle of the long record.
+		split := strings.Index(test.content, long) + 200
+		writeFileOrFail(t, ctx, "test.log", []byte(test.content[:split]))
+		parsedGlob, err := glob.Parse(logfile)
+		if err != nil {
+			fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+		}
+		ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+			Globs:          []glob.Glob{parsedGlob},
+			Readall:        true,
+			Framer:         test.framer,
+			MaxLineLength:  10,
+			LongLinePolicy: test.policy,
+			Log:            ctx.log,
+		})
+		if err != nil {
+			fatalf(t, ctx, "failed to start tailer: %v", err)
+		}
+		var longLineError *fswatcher.LineTooLongError
+		for i, expectedLine := range test.expectedLines {
+			if i == len(test.expectedLines)-1 {
+				appendFileOrFail(t, ctx, "test.log", []byte(test.content[split:]))
+			}
+			var line *fswatcher.Line
+			for line == nil {
+				select {
+				case line = <-ctx.tailer.Lines():
+				case err := <-ctx.tailer.Errors():
+					if !errors.As(err, &longLineError) {
+						fatalf(t, ctx, "%v: unexpected error: %v", name, err)
+					}
+				case <-time.After(2 * time.Second):
+					fatalf(t, ctx, "%v: timeout while waiting for line %q", name, expectedLine)
+				}
+			}
+			if line.Line != expectedLine || line.Truncated != (expectedLine == "xxxxxxxxxx") {
+				fatalf(t, ctx, "%v: expected line %q but got %#v", name, expectedLine, line)
+			}
+		}
+		if longLineError == nil {
+			fatalf(t, ctx, "%v: long record was not reported", name)
+		}
+		if longLineError.Length != test.expectedLength || longLineError.Discarded != test.expectedDiscarded || longLineError.Offset != int64(strings.Index(test.content, long)-test.prefixLength) {
+			fatalf(t, ctx, "%v: unexpected error: %#v", name, longLineError)
+		}
+		closeTailer(t, ctx, false)
+		tearDown(t, ctx)
+	}
+}
+
+// UTF-16 lines exceeding the max line length are handled before they are complete, like framed records.
+func TestLongIncompleteUTF16Lines(t *testing.T) {
+	ctx := setUp(t, "long incomplete utf-16 lines", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	long := strings.Repeat("ä", 300)
+	writeFileOrFail(t, ctx, "test.log", encodeUTF16("\ufeffshort\r\n"+long[:400], false))
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:         []glob.Glob{parsedGlob},
+		Readall:       true,
+		MaxLineLength: 11, // rounded down to 10 bytes, so that code units are not split
+		Log:           ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	defer closeTailer(t, ctx, false)
+	var longLineError *fswatcher.LineTooLongError
+	for _, expectedLine := range []string{"short", "äääää", "after"} {
+		if expectedLine == "after" {
+			// Only the first part of the long line was written, the truncated line must be sent before the line is complete.
+			appendFileOrFail(t, ctx, "test.log", encodeUTF16(long[400:]+"\r\nafter\r\n", false))
+		}
+		var line *fswatcher.Line
+		for line == nil {
+			select {
+			case line = <-ctx.tailer.Lines():
+			case err := <-ctx.tailer.Errors():
+				if !errors.As(err, &longLineError) {
+					fatalf(t, ctx, "unexpected error: %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				fatalf(t, ctx, "timeout while waiting for line %q", expectedLine)
+			}
+		}
+		if line.Line != expectedLine || line.Truncated != (expectedLine == "äääää") {
+			fatalf(t, ctx, "expected line %q but got %#v", expectedLine, line)
+		}
+	}
+	if longLineError == nil || longLineError.Length != 600 || longLineError.Discarded != 590 {
+		fatalf(t, ctx, "unexpected long line error: %#v", longLineError)
+	}
+}
+
+func newline() string {
+	if runtime.GOOS == "windows" {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// "bz2 line 1\nbz2 line 2\n" compressed with bzip2, because the standard library has no bzip2 writer.
+var bzip2TestData = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xd7, 0xd6, 0x7d, 0x1e, 0x00, 0x00,
+	0x05, 0x59, 0x80, 0x00, 0x10, 0x40, 0x00, 0x30, 0x00, 0x12, 0x25, 0x00, 0x10, 0x20, 0x00, 0x21,
+	0x2a, 0x18, 0x27, 0xea, 0x10, 0x03, 0x08, 0x8a, 0x3c, 0x48, 0x94, 0x22, 0x48, 0x89, 0xa2, 0xee,
+	0x48, 0xa7, 0x0a, 0x12, 0x1a, 0xfa, 0xcf, 0xa3, 0xc0,
+}
+
+// Compressed files are read once on startup with readall, but never tailed.
+func TestCompressedBackfill(t *testing.T) {
+	ctx := setUp(t, "compressed backfill", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	writer := newLogFileWriter(t, ctx, filepath.Join(ctx.basedir, "test.log"))
+	writer.writeLine(t, ctx, "line 1")
+	writeGzipOrFail(t, ctx, "test.log.1.gz", "gz line 1\ngz line 2") // last line without newline
+	writeFileOrFail(t, ctx, "test.log.2.bz2", bzip2TestData)
+	writeFileOrFail(t, ctx, "test.log.4", []byte("BZh line 1\n")) // starts with the bzip2 magic, but is a plain text file
+
+	startFileTailer(t, ctx, []string{"readall=true", "fail_on_missing_logfile=true", "test.log*"})
+	expect(t, ctx, "line 1", "test.log")
+	expect(t, ctx, "BZh line 1", "test.log.4")
+	expect(t, ctx, "gz line 1", "test.log.1.gz")
+	expect(t, ctx, "gz line 2", "test.log.1.gz")
+	expect(t, ctx, "bz2 line 1", "test.log.2.bz2")
+	expect(t, ctx, "bz2 line 2", "test.log.2.bz2")
+
+	// compressed files created while the tailer is running are skipped
+	writeGzipOrFail(t, ctx, "test.log.3.gz", "gz line 3\n")
+	// logrotate creates the compressed file empty and writes the compressed data afterwards
+	writeFileOrFail(t, ctx, "test.log.5.gz", nil)
+	writer.writeLine(t, ctx, "line 2")
+	expect(t, ctx, "line 2", "test.log")
+	appendGzipOrFail(t, ctx, "test.log.5.gz", "gz line 5\n")
+	writer.writeLine(t, ctx, "line 3")
+	expect(t, ctx, "line 3", "test.log")
+	closeTailer(t, ctx, false)
+	for _, file := range []string{"test.log.3.gz", "test.log.5.gz"} {
+		if lines := ctx.linesFromTailer.buf[filepath.Join(ctx.basedir, file)]; len(lines) > 0 {
+			fatalf(t, ctx, "%v: unexpected lines from compressed file created after startup: %v", file, lines)
+		}
+	}
+}
+
+// Compressed files that were read completely are not read again after restart, even if they were renamed.
+func TestCompressedCheckpoints(t *testing.T) {
+	ctx := setUp(t, "compressed checkpoints", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	writer := newLogFileWriter(t, ctx, filepath.Join(ctx.basedir, "test.log"))
+	store := fswatcher.NewCheckpointFile(filepath.Join(ctx.basedir, "checkpoints.json"))
+	writer.writeLine(t, ctx, "line 1")
+	writeGzipOrFail(t, ctx, "test.log.1.gz", "gz line 1\n")
+
+	startFileTailerWithCheckpoints(t, ctx, filepath.Join(ctx.basedir, "test.log*"), store)
+	expect(t, ctx, "line 1", "test.log")
+	expect(t, ctx, "gz line 1", "test.log.1.gz")
+	closeTailer(t, ctx, false)
+	shutdownTailer(t, ctx) // make sure the checkpoints are saved
+
+	// rotate the compressed file while the tailer is not running
+	err := os.Rename(filepath.Join(ctx.basedir, "test.log.1.gz"), filepath.Join(ctx.basedir, "test.log.2.gz"))
+	if err != nil {
+		fatalf(t, ctx, "failed to rename test.log.1.gz: %v", err)
+	}
+	writeGzipOrFail(t, ctx, "test.log.1.gz", "gz line 2\n")
+	writer.writeLine(t, ctx, "line 2")
+
+	startFileTailerWithCheckpoints(t, ctx, filepath.Join(ctx.basedir, "test.log*"), store)
+	expect(t, ctx, "line 2", "test.log")
+	expect(t, ctx, "gz line 2", "test.log.1.gz")
+	writer.writeLine(t, ctx, "line 3") // read after initialization, i.e. after all compressed files were read
+	expect(t, ctx, "line 3", "test.log")
+	closeTailer(t, ctx, false)
+	shutdownTailer(t, ctx)
+	if lines := ctx.linesFromTailer.buf[filepath.Join(ctx.basedir, "test.log.2.gz")]; len(lines) > 0 {
+		fatalf(t, ctx, "unexpected lines from compressed file that was read before: %v", lines)
+	}
+	checkpoints, err := store.Load()
+	if err != nil {
+		fatalf(t, ctx, "failed to load checkpoints: %v", err)
+	}
+	compressed := make(map[string]bool)
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Compressed {
+			compressed[filepath.Base(checkpoint.Path)] = true
+		}
+	}
+	if len(checkpoints) != 3 || !compressed["test.log.1.gz"] || !compressed["test.log.2.gz"] {
+		fatalf(t, ctx, "unexpected checkpoints: %#v", checkpoints)
+	}
+}
+
+func writeGzipOrFail(t *testing.T, ctx *context, filename string, content string) {
+	writeFileOrFail(t, ctx, filename, gzipOrFail(t, ctx, filename, content))
+}
+
+func appendGzipOrFail(t *testing.T, ctx *context, filename string, content string) {
+	appendFileOrFail(t, ctx, filename, gzipOrFail(t, ctx, filename, content))
+}
+
+func gzipOrFail(t *testing.T, ctx *context, filename string, content string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		fatalf(t, ctx, "%v: failed to compress: %v", filename, err)
+	}
+	return buf.Bytes()
+}
+
+func writeFileOrFail(t *testing.T, ctx *context, filename string, content []byte) {
+	err := ioutil.WriteFile(filepath.Join(ctx.basedir, filename), content, 0644)
+	if err != nil {
+		fatalf(t, ctx, "%v: failed to write file: %v", filename, err)
+	}
+}
+
+// Each glob has its own framer. Records are read on startup, and when they are appended later.
+func TestFraming(t *testing.T) {
+	ctx := setUp(t, "framing", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	writeFileOrFail(t, ctx, "test.nul", []byte("nul 1\x00nul\n2\x00"))
+	writeFileOrFail(t, ctx, "test.seq", []byte("\x1e{\"seq\":1}\n\x1e{\n  \"seq\": 2\n}\n"))
+	writeFileOrFail(t, ctx, "test.bin", []byte("\x00\x05bin 1\x00\x05bin\n2"))
+	writeFileOrFail(t, ctx, "test.log", []byte("line 1\n"))
+
+	framers := make(map[glob.Glob]fswatcher.Framer)
+	for _, f := range []struct {
+		pattern string
+		framer  fswatcher.Framer
+	}{
+		{"*.nul", fswatcher.DelimiterFramer("\x00")},
+		{"*.seq", fswatcher.RFC7464Framer()},
+		{"*.bin", fswatcher.LengthPrefixFramer(2)},
+		{"*.log", nil},
+	} {
+		parsedGlob, err := glob.Parse(filepath.Join(ctx.basedir, f.pattern))
+		if err != nil {
+			fatalf(t, ctx, "%q: failed to parse glob: %q", f.pattern, err)
+		}
+		framers[parsedGlob] = f.framer
+	}
+	globs := make([]glob.Glob, 0, len(framers))
+	for g := range framers {
+		globs = append(globs, g)
+	}
+	var err error
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:   globs,
+		Readall: true,
+		Framers: framers,
+		Log:     ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	ctx.linesFromTailer = makeLinesFromTailer(ctx.tailer)
+	expect(t, ctx, "nul 1", "test.nul")
+	expect(t, ctx, "nul\n2", "test.nul")
+	expect(t, ctx, "{\"seq\":1}", "test.seq")
+	expect(t, ctx, "{\n  \"seq\": 2\n}", "test.seq")
+	expect(t, ctx, "bin 1", "test.bin")
+	expect(t, ctx, "bin\n2", "test.bin")
+	expect(t, ctx, "line 1", "test.log")
+
+	appendFileOrFail(t, ctx, "test.nul", []byte("nul 3\x00"))
+	appendFileOrFail(t, ctx, "test.seq", []byte("\x1e\"seq 3\"\n"))
+	appendFileOrFail(t, ctx, "test.bin", []byte("\x00\x05bin 3"))
+	expect(t, ctx, "nul 3", "test.nul")
+	expect(t, ctx, "\"seq 3\"", "test.seq")
+	expect(t, ctx, "bin 3", "test.bin")
+	closeTailer(t, ctx, false)
+}
+
+func appendFileOrFail(t *testing.T, ctx *context, filename string, content []byte) {
+	file, err := os.OpenFile(filepath.Join(ctx.basedir, filename), os.O_WRONLY|os.O_APPEND, 0644)
+	if err == nil {
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fatalf(t, ctx, "%v: failed to append to file: %v", filename, err)
+	}
+}
+
+// Lines are converted to UTF-8. A byte order mark overrides the configured encoding, unless it is a single byte encoding.
+// Invalid UTF-8 is passed through by default.
+func TestEncodings(t *testing.T) {
+	ctx := setUp(t, "encodings", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	// U+010A is encoded as 0x0A 0x01 in UTF-16LE, which must not be mistaken for a newline.
+	writeFileOrFail(t, ctx, "test.utf16", append([]byte{0xFF, 0xFE}, encodeUTF16("\u010Aä\r\n😀\n", false)...))
+	writeFileOrFail(t, ctx, "test.utf16be", encodeUTF16("big endian\n", true))
+	writeFileOrFail(t, ctx, "test.latin1", []byte("caf\xe9\n"))
+	writeFileOrFail(t, ctx, "bom.latin1", []byte("\xff\xfe\n")) // not a UTF-16LE byte order mark
+	writeFileOrFail(t, ctx, "test.cp1252", []byte("\x80 \x81\n"))
+	writeFileOrFail(t, ctx, "test.log", []byte("\xef\xbb\xbfbom\xff\n"))
+
+	encodings := make(map[glob.Glob]fswatcher.Encoding)
+	for pattern, encoding := range map[string]fswatcher.Encoding{
+		"*.utf16":   fswatcher.UTF8, // overridden by the byte order mark
+		"*.utf16be": fswatcher.UTF16BE,
+		"*.latin1":  fswatcher.Latin1,
+		"*.cp1252":  fswatcher.Windows1252,
+		"*.log":     fswatcher.UTF8,
+	} {
+		parsedGlob, err := glob.Parse(filepath.Join(ctx.basedir, pattern))
+		if err != nil {
+			fatalf(t, ctx, "%q: failed to parse glob: %q", pattern, err)
+		}
+		encodings[parsedGlob] = encoding
+	}
+	globs := make([]glob.Glob, 0, len(encodings))
+	for g := range encodings {
+		globs = append(globs, g)
+	}
+	var err error
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:     globs,
+		Readall:   true,
+		Encodings: encodings,
+		Log:       ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	ctx.linesFromTailer = makeLinesFromTailer(ctx.tailer)
+	expect(t, ctx, "\u010Aä", "test.utf16")
+	expect(t, ctx, "😀", "test.utf16")
+	expect(t, ctx, "big endian", "test.utf16be")
+	expect(t, ctx, "café", "test.latin1")
+	expect(t, ctx, "ÿþ", "bom.latin1")
+	expect(t, ctx, "€ \uFFFD", "test.cp1252")
+	expect(t, ctx, "bom\xff", "test.log")
+
+	appendFileOrFail(t, ctx, "test.utf16", encodeUTF16("appended\n", false))
+	expect(t, ctx, "appended", "test.utf16")
+	closeTailer(t, ctx, false)
+}
+
+func encodeUTF16(s string, bigEndian bool) []byte {
+	var result []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			result = append(result, byte(unit>>8), byte(unit))
+		} else {
+			result = append(result, byte(unit), byte(unit>>8))
+		}
+	}
+	return result
+}
+
+// Lines written to a rotated file after the rotation are read during the grace period.
+func TestRotationGracePeriod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Files are closed after each read on Windows, so rotated files cannot be read.")
+	}
+	ctx := setUp(t, "rotation grace period", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	oldFile, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fatalf(t, ctx, "failed to create %v: %v", logfile, err)
+	}
+	defer oldFile.Close()
+	writeOrFail := func(file *os.File, line string) {
+		if _, err := file.WriteString(line + "\n"); err != nil {
+			fatalf(t, ctx, "failed to write %q: %v", line, err)
+		}
+	}
+	writeOrFail(oldFile, "line 1")
+
+	parsedGlob, err := glob.Parse(logfile) // the rotated file test.log.1 doesn't match
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:               []glob.Glob{parsedGlob},
+		Readall:             true,
+		RotationGracePeriod: 5 * time.Second,
+		Log:                 ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	defer closeTailer(t, ctx, false)
+	if line := nextLineWithMetadata(t, ctx); line.Line != "line 1" || line.Rotated {
+		fatalf(t, ctx, "unexpected line: %#v", line)
+	}
+
+	mvOrFail(t, ctx, "test.log", "test.log.1")
+	newFile, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fatalf(t, ctx, "failed to create %v: %v", logfile, err)
+	}
+	defer newFile.Close()
+	writeOrFail(newFile, "new line 1")
+	if line := nextLineWithMetadata(t, ctx); line.Line != "new line 1" || line.Generation != 1 || line.Rotated {
+		fatalf(t, ctx, "unexpected line from new file: %#v", line)
+	}
+	// the application didn't notice the rotation yet
+	writeOrFail(oldFile, "line 2")
+	if line := nextLineWithMetadata(t, ctx); line.Line != "line 2" || line.File != logfile || line.Generation != 0 || !line.Rotated {
+		fatalf(t, ctx, "unexpected line from rotated file: %#v", line)
+	}
+}
+
+// Without WaitForDirectories, a missing directory is an error. With WaitForDirectories, the tailer waits for the directory
+// to be created, and waits again if the directory is removed.
+func TestWaitForDirectories(t *testing.T) {
+	for _, backend := range []fswatcher.Backend{fswatcher.FseventBackend, fswatcher.PollingBackend} {
+		ctx := setUp(t, "wait for directories "+backend.String(), closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+		parsedGlob, err := glob.Parse(filepath.Join(ctx.basedir, "app", "logs", "*.log"))
+		if err != nil {
+			fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+		}
+		opts := fswatcher.Options{
+			Globs:        []glob.Glob{parsedGlob},
+			Readall:      true,
+			Backend:      backend,
+			PollInterval: 100 * time.Millisecond,
+			Log:          ctx.log,
+		}
+
+		ctx.tailer, err = fswatcher.Run(opts)
+		if err != nil {
+			fatalf(t, ctx, "failed to start tailer: %v", err)
+		}
+		select {
+		case Err := <-ctx.tailer.Errors():
+			if Err == nil || Err.Type() != fswatcher.DirectoryNotFound {
+				fatalf(t, ctx, "expected DirectoryNotFound error, but got %v", Err)
+			}
+		case line := <-ctx.tailer.Lines():
+			fatalf(t, ctx, "unexpected line: %#v", line)
+		case <-time.After(2 * time.Second):
+			fatalf(t, ctx, "timeout while waiting for DirectoryNotFound error")
+		}
+		closeTailer(t, ctx, false)
+
+		opts.WaitForDirectories = true
+		ctx.tailer, err = fswatcher.Run(opts)
+		if err != nil {
+			fatalf(t, ctx, "failed to start tailer: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond) // make sure the tailer is waiting before the directory is created
+		mkdirOrFail := func() {
+			if err := os.MkdirAll(filepath.Join(ctx.basedir, "app", "logs"), 0755); err != nil {
+				fatalf(t, ctx, "failed to create log directory: %v", err)
+			}
+		}
+		mkdirOrFail()
+		writeFileOrFail(t, ctx, filepath.Join("app", "logs", "test.log"), []byte("line 1\n"))
+		if line := nextLineWithMetadata(t, ctx); line.Line != "line 1" {
+			fatalf(t, ctx, "unexpected line: %#v", line)
+		}
+
+		// Directories cannot be removed while they are watched on Windows.
+		if runtime.GOOS != "windows" {
+			if err := os.RemoveAll(filepath.Join(ctx.basedir, "app")); err != nil {
+				fatalf(t, ctx, "failed to remove log directory: %v", err)
+			}
+			time.Sleep(500 * time.Millisecond)
+			mkdirOrFail()
+			writeFileOrFail(t, ctx, filepath.Join("app", "logs", "test.log"), []byte("line 2\n"))
+			if line := nextLineWithMetadata(t, ctx); line.Line != "line 2" {
+				fatalf(t, ctx, "unexpected line: %#v", line)
+			}
+		}
+		closeTailer(t, ctx, false)
+		tearDown(t, ctx)
+	}
+}
+
+// Globs are added and removed while the tailer is running, without affecting the other files.
+func TestAddRemoveGlob(t *testing.T) {
+	ctx := setUp(t, "add and remove globs", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	if err := os.Mkdir(filepath.Join(ctx.basedir, "sub"), 0755); err != nil {
+		fatalf(t, ctx, "failed to create sub-directory: %v", err)
+	}
+	writeFileOrFail(t, ctx, "a.log", []byte("a 1\n"))
+	writeFileOrFail(t, ctx, filepath.Join("sub", "b.log"), []byte("b 1\n"))
+	globA, err := glob.Parse(filepath.Join(ctx.basedir, "a.log"))
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", globA, err)
+	}
+	globB, err := glob.Parse(filepath.Join(ctx.basedir, "sub", "*.log"))
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", globB, err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:   []glob.Glob{globA},
+		Readall: true,
+		Log:     ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	defer closeTailer(t, ctx, false)
+	tailer, ok := ctx.tailer.(fswatcher.GlobTailer)
+	if !ok {
+		fatalf(t, ctx, "%T does not implement GlobTailer", ctx.tailer)
+	}
+	expectLine := func(expected string) {
+		if line := nextLineWithMetadata(t, ctx); line.Line != expected {
+			fatalf(t, ctx, "expected %q, but got %#v", expected, line)
+		}
+	}
+	expectLine("a 1")
+
+	missingGlob, _ := glob.Parse(filepath.Join(ctx.basedir, "missing", "*.log"))
+	if err = tailer.AddGlob(missingGlob); err == nil {
+		fatalf(t, ctx, "expected error when adding a glob for a missing directory")
+	}
+	if err = tailer.AddGlob(globB); err != nil {
+		fatalf(t, ctx, "failed to add glob: %v", err)
+	}
+	expectLine("b 1")
+	appendFileOrFail(t, ctx, "a.log", []byte("a 2\n"))
+	expectLine("a 2")
+
+	if err = tailer.RemoveGlob(globA); err != nil {
+		fatalf(t, ctx, "failed to remove glob: %v", err)
+	}
+	if err = tailer.RemoveGlob(globB); err == nil {
+		fatalf(t, ctx, "expected error when removing the last glob")
+	}
+	time.Sleep(200 * time.Millisecond) // wait until the change is applied
+	appendFileOrFail(t, ctx, "a.log", []byte("a 3\n"))
+	appendFileOrFail(t, ctx, filepath.Join("sub", "b.log"), []byte("b 2\n"))
+	expectLine("b 2")
+}
+
+// Files matching an exclude pattern or not matching the path matcher are not tailed.
+func TestExcludeAndPathMatcher(t *testing.T) {
+	ctx := setUp(t, "exclude and path matcher", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	for _, name := range []string{"app-1.log", "app-debug.log", "other.log"} {
+		writeFileOrFail(t, ctx, name, []byte(name+"\n"))
+	}
+	parsedGlob, err := glob.Parse(filepath.Join(ctx.basedir, "*.log"))
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	exclude, err := glob.ParseMatcher("*-debug.log")
+	if err != nil {
+		fatalf(t, ctx, "failed to parse exclude pattern: %v", err)
+	}
+	pathRegex, err := glob.ParseRegex(`app-[^/\\]*\.log$`)
+	if err != nil {
+		fatalf(t, ctx, "failed to parse regex: %v", err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:       []glob.Glob{parsedGlob},
+		Exclude:     []glob.Matcher{exclude},
+		PathMatcher: pathRegex,
+		Readall:     true,
+		Log:         ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	if line := nextLineWithMetadata(t, ctx); line.Line != "app-1.log" {
+		fatalf(t, ctx, "unexpected line: %#v", line)
+	}
+	for _, name := range []string{"app-debug.log", "other.log"} {
+		appendFileOrFail(t, ctx, name, []byte(name+"\n"))
+	}
+	writeFileOrFail(t, ctx, "app-2.log", []byte("app-2.log\n"))
+	if line := nextLineWithMetadata(t, ctx); line.Line != "app-2.log" {
+		fatalf(t, ctx, "unexpected line: %#v", line)
+	}
+	closeTailer(t, ctx, false)
+
+	// With FailOnMissingFile, a glob matching only excluded files is an error.
+	debugGlob, err := glob.Parse(filepath.Join(ctx.basedir, "*-debug.log"))
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", debugGlob, err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:             []glob.Glob{debugGlob},
+		Exclude:           []glob.Matcher{exclude},
+		FailOnMissingFile: true,
+		Log:               ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	select {
+	case Err := <-ctx.tailer.Errors():
+		if Err == nil || Err.Type() != fswatcher.FileNotFound {
+			fatalf(t, ctx, "expected FileNotFound error, but got %v", Err)
+		}
+	case <-time.After(2 * time.Second):
+		fatalf(t, ctx, "timeout while waiting for FileNotFound error")
+	}
+	closeTailer(t, ctx, false)
+}
+
+// Restart the tailer with checkpoints and make sure lines are neither lost nor duplicated.
+func TestCheckpoints(t *testing.T) {
+	nGoroutinesBefore := runtime.NumGoroutine()
+
+	ctx := setUp(t, "checkpoints", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	writer := newLogFileWriter(t, ctx, logfile)
+	store := fswatcher.NewCheckpointFile(filepath.Join(ctx.basedir, "checkpoints.json"))
+
+	writer.writeLine(t, ctx, "line 1")
+	startFileTailerWithCheckpoints(t, ctx, logfile, store)
+	writer.writeLine(t, ctx, "line 2")
+	expect(t, ctx, "line 1", "test.log")
+	expect(t, ctx, "line 2", "test.log")
+	closeTailer(t, ctx, false)
+	shutdownTailer(t, ctx) // make sure the checkpoints are saved
+	assertGoroutinesTerminated(t, ctx, nGoroutinesBefore)
+
+	writer.writeLine(t, ctx, "line 3") // written while the tailer is not running
+	startFileTailerWithCheckpoints(t, ctx, logfile, store)
+	writer.writeLine(t, ctx, "line 4")
+	expect(t, ctx, "line 3", "test.log")
+	expect(t, ctx, "line 4", "test.log")
+	closeTailer(t, ctx, false)
+	shutdownTailer(t, ctx) // make sure the checkpoints are saved
+	assertGoroutinesTerminated(t, ctx, nGoroutinesBefore)
+
+	fileInfo, err := os.Stat(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%v: stat failed: %v", logfile, err)
+	}
+	checkpoints, err := store.Load()
+	if err != nil {
+		fatalf(t, ctx, "failed to load checkpoints: %v", err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Path != logfile || checkpoints[0].Offset != fileInfo.Size() || checkpoints[0].FingerprintLength != int(fileInfo.Size()) {
+		fatalf(t, ctx, "unexpected checkpoints: %#v", checkpoints)
+	}
+
+	// Same inode and size, but different content: The checkpoint must not be used.
+	content, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%v: read failed: %v", logfile, err)
+	}
+	writeFileOrFail(t, ctx, "test.log", bytes.Replace(content, []byte("line"), []byte("LINE"), -1))
+	startFileTailerWithCheckpoints(t, ctx, logfile, store)
+	expect(t, ctx, "LINE 1", "test.log")
+	closeTailer(t, ctx, true)
+	shutdownTailer(t, ctx)
+}
+
+// A line that the tailer is trying to send during shutdown is not included in the checkpoint.
+func TestCheckpointDuringSendLine(t *testing.T) {
+	ctx := setUp(t, "checkpoint during send line", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	store := fswatcher.NewCheckpointFile(filepath.Join(ctx.basedir, "checkpoints.json"))
+	writeFileOrFail(t, ctx, "test.log", []byte("line 1\nline 2\n"))
+	startFileTailerWithCheckpoints(t, ctx, logfile, store)
+	line1 := nextLineWithMetadata(t, ctx)
+	if line1.Line != "line 1" {
+		fatalf(t, ctx, "expected line 1, but got %q", line1.Line)
+	}
+	time.Sleep(100 * time.Millisecond) // let the tailer block while sending line 2
+	shutdownTailer(t, ctx)
+	checkpoints, err := store.Load()
+	if err != nil {
+		fatalf(t, ctx, "failed to load checkpoints: %v", err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Offset != line1.EndOffset {
+		fatalf(t, ctx, "expected a checkpoint at offset %v, but got %#v", line1.EndOffset, checkpoints)
+	}
+	startFileTailerWithCheckpoints(t, ctx, logfile, store)
+	expect(t, ctx, "line 2", "test.log")
+	closeTailer(t, ctx, false)
+	shutdownTailer(t, ctx) // don't remove the directory while the checkpoints are saved
+}
+
+// Lines are sent in batches when the batch is full or the max latency has passed.
+// Checkpoints don't include lines that are waiting in an incomplete batch.
+func TestBatches(t *testing.T) {
+	ctx := setUp(t, "batches", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	store := fswatcher.NewCheckpointFile(filepath.Join(ctx.basedir, "checkpoints.json"))
+	content := &bytes.Buffer{}
+	for i := 1; i <= 25; i++ {
+		fmt.Fprintf(content, "line %v\n", i)
+	}
+	writeFileOrFail(t, ctx, "test.log", content.Bytes())
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", logfile, err)
+	}
+	startBatchTailer := func(latency time.Duration) fswatcher.BatchTailer {
+		tailer, err := fswatcher.Run(fswatcher.Options{
+			Globs:           []glob.Glob{parsedGlob},
+			Readall:         true,
+			MaxBatchSize:    10,
+			MaxBatchLatency: latency,
+			CheckpointStore: store,
+			Log:             ctx.log,
+		})
+		if err != nil {
+			fatalf(t, ctx, "failed to start tailer: %v", err)
+		}
+		ctx.tailer = tailer
+		return tailer.(fswatcher.BatchTailer)
+	}
+	nextLine := 1
+	expectBatch := func(tailer fswatcher.BatchTailer, size int) {
+		select {
+		case batch := <-tailer.Batches():
+			if len(batch) != size {
+				fatalf(t, ctx, "expected a batch of %v lines, but got %v lines", size, len(batch))
+			}
+			for _, line := range batch {
+				if line.Line != fmt.Sprintf("line %v", nextLine) {
+					fatalf(t, ctx, "expected line %v, but got %q", nextLine, line.Line)
+				}
+				nextLine++
+			}
+		case err := <-tailer.Errors():
+			fatalf(t, ctx, "unexpected error: %v", err)
+		case <-time.After(2 * time.Second):
+			fatalf(t, ctx, "timeout while waiting for a batch of %v lines", size)
+		}
+	}
+
+	tailer := startBatchTailer(50 * time.Millisecond)
+	expectBatch(tailer, 10)
+	expectBatch(tailer, 10)
+	expectBatch(tailer, 5) // sent after the max latency
+	appendFileOrFail(t, ctx, "test.log", []byte("line 26\nline 27\nline 28\n"))
+	expectBatch(tailer, 3)
+	shutdownTailer(t, ctx)
+
+	// Lines 39 and 40 are waiting in an incomplete batch when the tailer is shut down, so they are read again after restart.
+	appendFileOrFail(t, ctx, "test.log", []byte("line 29\nline 30\nline 31\nline 32\nline 33\nline 34\nline 35\nline 36\nline 37\nline 38\nline 39\nline 40\n"))
+	tailer = startBatchTailer(time.Hour)
+	expectBatch(tailer, 10)
+	shutdownTailer(t, ctx)
+	nextLine = 39
+	tailer = startBatchTailer(50 * time.Millisecond)
+	expectBatch(tailer, 2)
+	shutdownTailer(t, ctx)
+}
+
+// With batching enabled, consumers of the Lines() channel still get each line.
+// Lines that were not accepted by the consumer, in a batch or line by line, are not included in the checkpoint.
+func TestBatchesAsLines(t *testing.T) {
+	ctx := setUp(t, "batches as lines", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	store := fswatcher.NewCheckpointFile(filepath.Join(ctx.basedir, "checkpoints.json"))
+	writeFileOrFail(t, ctx, "test.log", []byte("line 1\nline 2\nline 3\n"))
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", logfile, err)
+	}
+	startTailer := func() {
+		ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+			Globs:           []glob.Glob{parsedGlob},
+			Readall:         true,
+			MaxBatchSize:    10,
+			MaxBatchLatency: 10 * time.Millisecond,
+			CheckpointStore: store,
+			Log:             ctx.log,
+		})
+		if err != nil {
+			fatalf(t, ctx, "failed to start tailer: %v", err)
+		}
+	}
+	expectCheckpoint := func(offset int64) {
+		checkpoints, err := store.Load()
+		if err != nil {
+			fatalf(t, ctx, "failed to load checkpoints: %v", err)
+		}
+		if len(checkpoints) != 1 || checkpoints[0].Offset != offset {
+			fatalf(t, ctx, "expected a checkpoint at offset %v, but got %#v", offset, checkpoints)
+		}
+	}
+
+	startTailer()
+	line1 := nextLineWithMetadata(t, ctx)
+	if line1.Line != "line 1" {
+		fatalf(t, ctx, "expected line 1, but got %q", line1.Line)
+	}
+	time.Sleep(100 * time.Millisecond) // let the tailer block while sending line 2
+	shutdownTailer(t, ctx)
+	expectCheckpoint(line1.EndOffset)
+
+	startTailer()
+	time.Sleep(100 * time.Millisecond) // let the tailer block while sending the batch with lines 2 and 3
+	shutdownTailer(t, ctx)
+	expectCheckpoint(line1.EndOffset)
+
+	startTailer()
+	line2 := nextLineWithMetadata(t, ctx)
+	line3 := nextLineWithMetadata(t, ctx)
+	if line2.Line != "line 2" || line3.Line != "line 3" {
+		fatalf(t, ctx, "expected lines 2 and 3, but got %q and %q", line2.Line, line3.Line)
+	}
+	shutdownTailer(t, ctx)
+	expectCheckpoint(line3.EndOffset)
+}
+
+// A file that is truncated and rewritten past the read position between two polls is read from the start.
+func TestFingerprint(t *testing.T) {
+	ctx := setUp(t, "fingerprint", closeFileAfterEachLine, pollingTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	writeFileOrFail(t, ctx, "test.log", []byte("line 1\n"))
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:        []glob.Glob{parsedGlob},
+		Readall:      true,
+		Backend:      fswatcher.PollingBackend,
+		PollInterval: 500 * time.Millisecond,
+		Log:          ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	defer closeTailer(t, ctx, false)
+	line1 := nextLineWithMetadata(t, ctx)
+	if line1.Line != "line 1" || line1.Fingerprint == 0 {
+		fatalf(t, ctx, "unexpected line: %#v", line1)
+	}
+	writeFileOrFail(t, ctx, "test.log", []byte("new line 1\n"))
+	line2 := nextLineWithMetadata(t, ctx)
+	if line2.Line != "new line 1" || line2.Offset != 0 || line2.Generation != 1 || line2.Fingerprint == line1.Fingerprint || line2.Inode != line1.Inode {
+		fatalf(t, ctx, "unexpected line after copytruncate: %#v", line2)
+	}
+}
+
+// The test context type shadows the context package in functions with a ctx parameter.
+func newShutdownContext() (ctx.Context, ctx.CancelFunc) {
+	return ctx.WithTimeout(ctx.Background(), 5*time.Second)
+}
+
+func shutdownTailer(t *testing.T, ctx *context) {
+	shutdownCtx, cancel := newShutdownContext()
+	defer cancel()
+	err := ctx.tailer.Shutdown(shutdownCtx)
+	if err != nil {
+		fatalf(t, ctx, "failed to shut down the tailer: %v", err)
+	}
+}
+
+func startFileTailerWithCheckpoints(t *testing.T, ctx *context, logfile string, store fswatcher.CheckpointStore) {
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	ctx.tailer, err = fswatcher.RunFileTailerWithCheckpoints([]glob.Glob{parsedGlob}, true, true, store, ctx.log)
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	ctx.linesFromTailer = makeLinesFromTailer(ctx.tailer)
+}
+
 func makeLinesFromTailer(tailer fswatcher.FileTailer) *linesFromTailer {
 	return &linesFromTailer{
 		tailer: tailer,
@@ -1024,3 +2159,36 @@ func (l *linesFromTailer) nextLine(file string, timeout time.Duration) (string,
 		}
 	}
 }
+
+// The header is read from the start of the file even if the tailer starts at the end, and is read again after truncation.
+func TestHeaders(t *testing.T) {
+	ctx := setUp(t, "headers", closeFileAfterEachLine, fseventTailer, _nocreate, mv)
+	defer tearDown(t, ctx)
+	logfile := filepath.Join(ctx.basedir, "test.log")
+	writeFileOrFail(t, ctx, "test.log", []byte("a,b\n1,2\n"))
+	parsedGlob, err := glob.Parse(logfile)
+	if err != nil {
+		fatalf(t, ctx, "%q: failed to parse glob: %q", parsedGlob, err)
+	}
+	ctx.tailer, err = fswatcher.Run(fswatcher.Options{
+		Globs:  []glob.Glob{parsedGlob},
+		Header: fswatcher.HeaderLines(1),
+		Log:    ctx.log,
+	})
+	if err != nil {
+		fatalf(t, ctx, "failed to start tailer: %v", err)
+	}
+	defer closeTailer(t, ctx, false)
+	time.Sleep(200 * time.Millisecond) // wait until the tailer has seeked to the end of the file
+	appendFileOrFail(t, ctx, "test.log", []byte("3,4\n"))
+	line := nextLineWithMetadata(t, ctx)
+	if line.Line != "3,4" || len(line.Header) != 1 || line.Header[0] != "a,b" {
+		fatalf(t, ctx, "unexpected line: %#v", line)
+	}
+	truncateOrFail(t, ctx, "test.log")
+	appendFileOrFail(t, ctx, "test.log", []byte("c,d\n5,6\n"))
+	line = nextLineWithMetadata(t, ctx)
+	if line.Line != "5,6" || line.Generation != 1 || len(line.Header) != 1 || line.Header[0] != "c,d" {
+		fatalf(t, ctx, "unexpected line after truncate: %#v", line)
+	}
+}
@@ -18,8 +18,12 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
+// Glob is an absolute path pattern as understood by filepath.Match.
+// In addition to filepath.Match, wildcards may be used in the directory path, and
+// a path segment "**" matches zero or more directories, like in /srv/apps/**/logs/*.log
 type Glob string
 
 func Parse(pattern string) (Glob, error) {
@@ -36,19 +40,82 @@ func Parse(pattern string) (Glob, error) {
 		return "", fmt.Errorf("%q: failed to find absolute path for glob pattern: %v", pattern, err)
 	}
 	result = Glob(absglob)
-	if containsWildcards(result.Dir()) {
-		return "", fmt.Errorf("%q: wildcards are only allowed in the file name, but not in the directory path", pattern)
-	}
 	return result, nil
 }
 
+// Dir returns the directory part of the glob. This may contain wildcards, see HasDirWildcards().
 func (g Glob) Dir() string {
 	return filepath.Dir(string(g))
 }
 
+// BaseDir returns the longest directory path without wildcards.
+// If the directory part of the glob has no wildcards, this is the same as Dir().
+func (g Glob) BaseDir() string {
+	dir := g.Dir()
+	for containsWildcards(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// HasDirWildcards returns true if the directory part of the glob contains wildcards.
+// In that case, the directories to be watched are not known up-front but must be searched for in BaseDir().
+func (g Glob) HasDirWildcards() bool {
+	return containsWildcards(g.Dir())
+}
+
 func (g Glob) Match(path string) bool {
-	matched, _ := filepath.Match(string(g), path)
-	return matched
+	if !strings.Contains(string(g), "**") {
+		matched, _ := filepath.Match(string(g), path)
+		return matched
+	}
+	return matchSegments(split(string(g)), split(path))
+}
+
+// MayContain returns true if files matching the glob might be located in dir or in a subdirectory of dir.
+func (g Glob) MayContain(dir string) bool {
+	var (
+		pattern = split(string(g))
+		path    = split(dir)
+	)
+	for len(path) > 0 {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern[0], path[0]); !matched {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(pattern) > 0
+}
+
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern[0], path[0]); !matched {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+func split(path string) []string {
+	return strings.Split(filepath.Clean(path), string(filepath.Separator))
 }
 
 func containsWildcards(pattern string) bool {
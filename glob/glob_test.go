@@ -0,0 +1,68 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glob
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// mayContain is evaluated as if path was a directory.
+type dirWildcardTest struct {
+	glob, path   string
+	matchFile    bool
+	mayContain   bool
+	expectedBase string
+}
+
+var dirWildcardTests = []dirWildcardTest{
+	{"/var/log/*.log", "/var/log/a.log", true, false, "/var/log"},
+	{"/var/log/*.log", "/var/log", false, true, "/var/log"},
+	{"/var/log/*.log", "/var", false, true, "/var/log"},
+	{"/var/log/*.log", "/var/log/sub", false, false, "/var/log"},
+	{"/var/log/pods/*/*/*.log", "/var/log/pods/p1/c1/0.log", true, false, "/var/log/pods"},
+	{"/var/log/pods/*/*/*.log", "/var/log/pods/p1/0.log", false, true, "/var/log/pods"},
+	{"/var/log/pods/*/*/*.log", "/var/log/pods/p1", false, true, "/var/log/pods"},
+	{"/var/log/pods/*/*/*.log", "/var/log/pods/p1/c1", false, true, "/var/log/pods"},
+	{"/var/log/pods/*/*/*.log", "/var/log/pods/p1/c1/x", false, false, "/var/log/pods"},
+	{"/srv/apps/**/logs/*.log", "/srv/apps/logs/a.log", true, true, "/srv/apps"},
+	{"/srv/apps/**/logs/*.log", "/srv/apps/a/b/logs/a.log", true, true, "/srv/apps"},
+	{"/srv/apps/**/logs/*.log", "/srv/apps/a/b/logs/a.txt", false, true, "/srv/apps"},
+	{"/srv/apps/**/logs/*.log", "/srv/apps/a/b/c", false, true, "/srv/apps"},
+	{"/srv/apps/**/logs/*.log", "/srv/other", false, false, "/srv/apps"},
+	{"/srv/*/logs/**", "/srv/app/logs/x/y/z.log", true, true, "/srv"},
+}
+
+func TestDirWildcards(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test data uses unix paths")
+	}
+	for _, test := range dirWildcardTests {
+		g, err := Parse(test.glob)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.glob, err)
+		}
+		if g.Match(test.path) != test.matchFile {
+			t.Errorf("%v: Match(%q) returned %t", test.glob, test.path, !test.matchFile)
+		}
+		if g.MayContain(test.path) != test.mayContain {
+			t.Errorf("%v: MayContain(%q) returned %t", test.glob, test.path, !test.mayContain)
+		}
+		if g.BaseDir() != filepath.FromSlash(test.expectedBase) {
+			t.Errorf("%v: expected base dir %q but got %q", test.glob, test.expectedBase, g.BaseDir())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glob
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Matcher decides if a file path is selected. Glob, Name, and Regex implement Matcher.
+type Matcher interface {
+	Match(path string) bool
+}
+
+// Name is a pattern for the file name without the directory, as understood by filepath.Match, like *-debug.log
+type Name string
+
+func ParseName(pattern string) (Name, error) {
+	if !IsPatternValid(pattern) || strings.ContainsRune(filepath.FromSlash(pattern), filepath.Separator) {
+		return "", fmt.Errorf("%q: invalid file name pattern", pattern)
+	}
+	return Name(pattern), nil
+}
+
+func (n Name) Match(path string) bool {
+	matched, _ := filepath.Match(string(n), filepath.Base(path))
+	return matched
+}
+
+// Regex matches file paths with a regular expression, for patterns that cannot be expressed with globs.
+// The expression is not anchored, use ^ and $ to match the complete path.
+type Regex struct {
+	regex *regexp.Regexp
+}
+
+func ParseRegex(expr string) (*Regex, error) {
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%q: invalid regular expression: %v", expr, err)
+	}
+	return &Regex{regex: regex}, nil
+}
+
+func (r *Regex) Match(path string) bool {
+	return r.regex.MatchString(path)
+}
+
+func (r *Regex) String() string {
+	return r.regex.String()
+}
+
+// ParseMatcher parses a pattern as a Name if it doesn't contain a path separator, or as a Glob otherwise.
+func ParseMatcher(pattern string) (Matcher, error) {
+	if strings.ContainsRune(filepath.FromSlash(pattern), filepath.Separator) {
+		return Parse(pattern)
+	}
+	return ParseName(pattern)
+}
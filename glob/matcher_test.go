@@ -0,0 +1,61 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glob
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*-debug.log", "/var/log/app-debug.log", true},
+		{"*-debug.log", "/var/log/app.log", false},
+		{"*-debug.log", "/var/log/app-debug.log/x.log", false},
+		{"/var/log/*-debug.log", "/var/log/app-debug.log", true},
+		{"/var/log/*-debug.log", "/var/log/sub/app-debug.log", false},
+	} {
+		m, err := ParseMatcher(filepath.FromSlash(test.pattern))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.pattern, err)
+		}
+		path, err := filepath.Abs(filepath.FromSlash(test.path))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.path, err)
+		}
+		if m.Match(path) != test.match {
+			t.Errorf("%v: Match(%q) returned %t", test.pattern, path, !test.match)
+		}
+	}
+	regex, err := ParseRegex(`app-[0-9]+\.log$`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !regex.Match("/var/log/app-12.log") || regex.Match("/var/log/app-x.log") {
+		t.Errorf("%v: unexpected match result", regex)
+	}
+	for _, invalid := range []string{"[a-", "*[]"} {
+		if _, err = ParseMatcher(invalid); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+	if _, err = ParseRegex("app-[0-9"); err == nil {
+		t.Error("expected error for invalid regular expression")
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"fmt"
+	configuration "github.com/jdrews/go-tailer/config"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"regexp"
+	"strings"
+)
+
+// DefaultGrokPatterns are the grok patterns available in GrokConfig.Expressions, like %{IP:client}.
+// Patterns may refer to other patterns. Use GrokConfig.Patterns to add or override patterns, don't modify this map.
+var DefaultGrokPatterns = map[string]string{
+	"INT":               `[+-]?[0-9]+`,
+	"NUMBER":            `[+-]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}(?:[0-9A-Fa-f]{1,4}|%{IPV4})?`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z](?:[0-9A-Za-z-]{0,62})(?:\.[0-9A-Za-z](?:[0-9A-Za-z-]{0,62}))*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"POSINT":            `\b[1-9][0-9]*\b`,
+	"PATH":              `(?:/[^\s?#]*)+`,
+	"URIPATHPARAM":      `%{PATH}(?:\?\S*)?`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|panic|alert|emerg(?:ency)?)`,
+	"YEAR":              `[0-9]{4}`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:0[1-9]|[12][0-9]|3[01]|[1-9])`,
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"HOUR":              `(?:2[0-3]|[01]?[0-9])`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE})?)`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} [+-][0-9]{4}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+}
+
+// UnmatchedPolicy defines what happens with lines that match none of the expressions of a grok processor.
+type UnmatchedPolicy int
+
+const (
+	// Pass the line on unchanged.
+	PassUnmatched UnmatchedPolicy = iota
+	// Drop the line.
+	DropUnmatched
+	// Pass the line on with GrokConfig.UnmatchedField set to true in Line.Extra.
+	TagUnmatched
+)
+
+func (p UnmatchedPolicy) String() string {
+	switch p {
+	case PassUnmatched:
+		return "pass"
+	case DropUnmatched:
+		return "drop"
+	case TagUnmatched:
+		return "tag"
+	default:
+		return fmt.Sprintf("UnmatchedPolicy(%d)", int(p))
+	}
+}
+
+// ParseUnmatchedPolicy parses the String() representation of an UnmatchedPolicy.
+func ParseUnmatchedPolicy(s string) (UnmatchedPolicy, error) {
+	for _, p := range []UnmatchedPolicy{PassUnmatched, DropUnmatched, TagUnmatched} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return PassUnmatched, fmt.Errorf("%q: invalid unmatched policy, expected one of \"pass\", \"drop\", or \"tag\"", s)
+}
+
+// DefaultUnmatchedField is the field set for unmatched lines with TagUnmatched, like in Logstash.
+const DefaultUnmatchedField = "_grokparsefailure"
+
+// GrokConfig defines the expressions of a grok processor, see ExtractFields().
+type GrokConfig struct {
+	// Expressions are regular expressions with named captures like (?P<name>...), and grok patterns like %{IP:client}
+	// for a named capture or %{IP} for an unnamed group. The expressions are tried in order, the first match wins.
+	Expressions []string
+	// Patterns adds grok patterns, or overrides DefaultGrokPatterns.
+	Patterns map[string]string
+	// Unmatched defines what happens with lines that match none of the expressions.
+	Unmatched UnmatchedPolicy
+	// UnmatchedField is the field set for TagUnmatched. Empty means DefaultUnmatchedField.
+	UnmatchedField string
+}
+
+// ExtractFields creates a Processor that adds the named captures of the first matching expression to Line.Extra.
+// Captures that don't participate in the match are not added. Use ForFiles() to apply different expressions to different files.
+func ExtractFields(cfg GrokConfig) (Processor, error) {
+	if len(cfg.Expressions) == 0 {
+		return nil, fmt.Errorf("invalid grok config: no expressions")
+	}
+	if len(cfg.UnmatchedField) == 0 {
+		cfg.UnmatchedField = DefaultUnmatchedField
+	}
+	regexes := make([]*regexp.Regexp, 0, len(cfg.Expressions))
+	for _, expression := range cfg.Expressions {
+		regex, err := CompileGrok(expression, cfg.Patterns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grok config: %v", err)
+		}
+		regexes = append(regexes, regex)
+	}
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		for _, regex := range regexes {
+			match := regex.FindStringSubmatchIndex(line.Line)
+			if match == nil {
+				continue
+			}
+			fields, err := extraFields(line)
+			if err != nil {
+				return line, err
+			}
+			for i, name := range regex.SubexpNames() {
+				if len(name) > 0 && match[2*i] >= 0 {
+					fields[name] = line.Line[match[2*i]:match[2*i+1]]
+				}
+			}
+			return line, nil
+		}
+		switch cfg.Unmatched {
+		case DropUnmatched:
+			return nil, nil
+		case TagUnmatched:
+			fields, err := extraFields(line)
+			if err != nil {
+				return line, err
+			}
+			fields[cfg.UnmatchedField] = true
+		}
+		return line, nil
+	}), nil
+}
+
+// GrokPipeline maps the grok and groks of the input config onto a Pipeline, see ExtractFields().
+// The keys of cfg.Groks are file name patterns or globs, like the keys of cfg.Formats in FormatPipeline().
+// Lines from other files use cfg.Grok. The result is empty if no grok config is configured.
+func GrokPipeline(cfg *configuration.InputConfig) (Pipeline, error) {
+	var (
+		extractors = make(map[string]Processor, len(cfg.Groks))
+		fallback   Processor
+		err        error
+	)
+	for pattern, grokConfig := range cfg.Groks {
+		extractors[pattern], err = grokExtractor(grokConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input configuration: groks: %v: %v", pattern, err)
+		}
+	}
+	if cfg.Grok != nil {
+		fallback, err = grokExtractor(*cfg.Grok)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input configuration: grok: %v", err)
+		}
+	}
+	return filePatternPipeline(extractors, fallback)
+}
+
+func grokExtractor(cfg configuration.GrokConfig) (Processor, error) {
+	grokConfig := GrokConfig{
+		Expressions:    cfg.Expressions,
+		Patterns:       cfg.Patterns,
+		UnmatchedField: cfg.UnmatchedField,
+	}
+	if len(cfg.Unmatched) > 0 {
+		unmatched, err := ParseUnmatchedPolicy(cfg.Unmatched)
+		if err != nil {
+			return nil, err
+		}
+		grokConfig.Unmatched = unmatched
+	}
+	return ExtractFields(grokConfig)
+}
+
+var grokPatternRegex = regexp.MustCompile(`%{(\w+)(?::(\w+))?}`)
+
+// CompileGrok expands the grok patterns in expression, see GrokConfig.Expressions, and compiles the result.
+// patterns adds to, or overrides, DefaultGrokPatterns, and may be nil.
+func CompileGrok(expression string, patterns map[string]string) (*regexp.Regexp, error) {
+	expanded, err := expandGrok(expression, patterns, nil)
+	if err != nil {
+		return nil, err
+	}
+	regex, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", expression, err)
+	}
+	return regex, nil
+}
+
+// Replaces %{NAME} with the pattern NAME. parents are the patterns currently being expanded, to detect cycles.
+func expandGrok(expression string, patterns map[string]string, parents []string) (string, error) {
+	var (
+		result strings.Builder
+		last   int
+	)
+	for _, match := range grokPatternRegex.FindAllStringSubmatchIndex(expression, -1) {
+		name := expression[match[2]:match[3]]
+		for _, parent := range parents {
+			if parent == name {
+				return "", fmt.Errorf("%%{%v}: grok pattern refers to itself", name)
+			}
+		}
+		pattern, exists := patterns[name]
+		if !exists {
+			pattern, exists = DefaultGrokPatterns[name]
+		}
+		if !exists {
+			return "", fmt.Errorf("%%{%v}: undefined grok pattern", name)
+		}
+		expanded, err := expandGrok(pattern, patterns, append(parents, name))
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(expression[last:match[0]])
+		if match[4] >= 0 {
+			fmt.Fprintf(&result, "(?P<%v>%v)", expression[match[4]:match[5]], expanded)
+		} else {
+			fmt.Fprintf(&result, "(?:%v)", expanded)
+		}
+		last = match[1]
+	}
+	result.WriteString(expression[last:])
+	return result.String(), nil
+}
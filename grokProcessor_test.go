@@ -0,0 +1,157 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	configuration "github.com/jdrews/go-tailer/config"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"reflect"
+	"testing"
+)
+
+func TestExtractFields(t *testing.T) {
+	processor, err := ExtractFields(GrokConfig{
+		Expressions: []string{
+			`^%{TIMESTAMP_ISO8601:time} %{LOGLEVEL:level} %{IP:client} %{GREEDYDATA:msg}$`,
+			`^%{TIMESTAMP_ISO8601:time} (?P<msg>.*?)(?: user=%{USER:user})?$`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			line:     "2026-01-02T10:00:00.123Z INFO 10.0.0.1 GET /index.html",
+			expected: map[string]interface{}{"time": "2026-01-02T10:00:00.123Z", "level": "INFO", "client": "10.0.0.1", "msg": "GET /index.html"},
+		},
+		{
+			line:     "2026-01-02 10:00:00+01:00 login failed user=jane",
+			expected: map[string]interface{}{"time": "2026-01-02 10:00:00+01:00", "msg": "login failed", "user": "jane"},
+		},
+		{
+			// the optional user capture doesn't participate in the match
+			line:     "2026-01-02 10:00:00 started",
+			expected: map[string]interface{}{"time": "2026-01-02 10:00:00", "msg": "started"},
+		},
+		{
+			line:     "no timestamp",
+			expected: nil,
+		},
+	} {
+		line, err := processor.Process(&fswatcher.Line{Line: test.line})
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.line, err)
+		}
+		if line == nil || line.Line != test.line {
+			t.Fatalf("%q: expected the line to be passed on, but got %v", test.line, line)
+		}
+		if test.expected == nil && line.Extra != nil || test.expected != nil && !reflect.DeepEqual(line.Extra, test.expected) {
+			t.Fatalf("%q: expected %v, but got %v", test.line, test.expected, line.Extra)
+		}
+	}
+}
+
+func TestExtractFieldsUnmatched(t *testing.T) {
+	drop, err := ExtractFields(GrokConfig{Expressions: []string{`^%{INT:n}$`}, Unmatched: DropUnmatched})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, err := drop.Process(&fswatcher.Line{Line: "x"}); err != nil || line != nil {
+		t.Fatalf("expected the line to be dropped, but got %v and error %v.", line, err)
+	}
+	tag, err := ExtractFields(GrokConfig{Expressions: []string{`^%{INT:n}$`}, Unmatched: TagUnmatched})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := tag.Process(&fswatcher.Line{Line: "x"})
+	if err != nil || line == nil || !reflect.DeepEqual(line.Extra, map[string]interface{}{DefaultUnmatchedField: true}) {
+		t.Fatalf("expected the line to be tagged, but got %v and error %v.", line, err)
+	}
+	for _, s := range []string{"pass", "drop", "tag"} {
+		p, err := ParseUnmatchedPolicy(s)
+		if err != nil || p.String() != s {
+			t.Fatalf("%q: failed to parse unmatched policy: %v", s, err)
+		}
+	}
+}
+
+func TestGrokPipeline(t *testing.T) {
+	pipeline, err := GrokPipeline(&configuration.InputConfig{
+		Grok: &configuration.GrokConfig{Expressions: []string{`^%{LOGLEVEL:level} %{GREEDYDATA:message}$`}},
+		Groks: map[string]configuration.GrokConfig{
+			"access.log": {
+				Expressions: []string{`^%{CLIENT:client} %{POSINT:status}$`},
+				Patterns:    map[string]string{"CLIENT": `%{IP}`},
+				Unmatched:   "drop",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := pipeline.Process(&fswatcher.Line{File: "/var/log/nginx/access.log", Line: "10.0.0.1 200"})
+	if err != nil || !reflect.DeepEqual(line.Extra, map[string]interface{}{"client": "10.0.0.1", "status": "200"}) {
+		t.Fatalf("expected an access log line, but got %v and error %v", line, err)
+	}
+	if line, err = pipeline.Process(&fswatcher.Line{File: "/var/log/nginx/access.log", Line: "x"}); err != nil || line != nil {
+		t.Fatalf("expected the line to be dropped, but got %v and error %v", line, err)
+	}
+	// lines from other files, and from the webhook or kafka tailer, use the default grok config
+	line, err = pipeline.Process(&fswatcher.Line{Line: "INFO started"})
+	if err != nil || !reflect.DeepEqual(line.Extra, map[string]interface{}{"level": "INFO", "message": "started"}) {
+		t.Fatalf("expected a log level line, but got %v and error %v", line, err)
+	}
+	pipeline, err = GrokPipeline(&configuration.InputConfig{})
+	if err != nil || len(pipeline) != 0 {
+		t.Fatalf("expected an empty pipeline, but got %v and error %v", pipeline, err)
+	}
+	if _, err = GrokPipeline(&configuration.InputConfig{Groks: map[string]configuration.GrokConfig{"*.log": {Expressions: []string{".*"}, Unmatched: "ignore"}}}); err == nil {
+		t.Fatal("expected an error for an invalid unmatched policy")
+	}
+	if _, err = GrokPipeline(&configuration.InputConfig{Grok: &configuration.GrokConfig{}}); err == nil {
+		t.Fatal("expected an error for a config without expressions")
+	}
+}
+
+func TestCompileGrok(t *testing.T) {
+	patterns := map[string]string{
+		"REQUEST": `%{WORD:method} %{URIPATHPARAM:path}`,
+		"LOOP":    `a%{LOOP}`,
+	}
+	regex, err := CompileGrok(`^%{REQUEST} %{POSINT:status}$`, patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := regex.FindStringSubmatch("GET /a/b?c=d 200")
+	if match == nil || match[regex.SubexpIndex("method")] != "GET" || match[regex.SubexpIndex("path")] != "/a/b?c=d" || match[regex.SubexpIndex("status")] != "200" {
+		t.Fatalf("unexpected match: %q", match)
+	}
+	for name := range DefaultGrokPatterns {
+		if _, err := CompileGrok("%{"+name+"}", nil); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+	}
+	for _, expression := range []string{`%{UNDEFINED}`, `%{LOOP}`, `%{INT:n}(`} {
+		if _, err := CompileGrok(expression, patterns); err == nil {
+			t.Fatalf("%q: expected an error", expression)
+		}
+	}
+	if _, err := ExtractFields(GrokConfig{}); err == nil {
+		t.Fatal("expected an error for a config without expressions")
+	}
+}
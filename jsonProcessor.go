@@ -0,0 +1,65 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"fmt"
+	json "github.com/bitly/go-simplejson"
+	"github.com/jdrews/go-tailer/fswatcher"
+)
+
+// DecodeJSON creates a Processor for lines containing one JSON object each. The fields of the object are added to
+// Line.Extra, see SetField(). Numbers are decoded as json.Number.
+// If messageSelector is not empty, Line.Line is replaced with the selected string field. The selector uses the syntax of
+// the webhook tailer's webhook_json_selector, like .message or .log.lines[0].
+// Lines that are not JSON objects, or don't contain the selected field, are reported as ProcessorError and passed on unchanged.
+// Use ForFiles() to decode only the files that contain JSON.
+func DecodeJSON(messageSelector string) (Processor, error) {
+	if len(messageSelector) > 0 && (len(messageSelector) < 2 || messageSelector[0] != '.') {
+		return nil, fmt.Errorf("%q: invalid json selector, expected a path like .message", messageSelector)
+	}
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		j, err := json.NewJson([]byte(line.Line))
+		if err != nil {
+			return line, fmt.Errorf("invalid JSON: %v", err)
+		}
+		object, err := j.Map()
+		if err != nil {
+			return line, fmt.Errorf("expected a JSON object")
+		}
+		var message string
+		if len(messageSelector) > 0 {
+			message, err = processPath(j, messageSelector)
+			if err != nil {
+				return line, fmt.Errorf("%v: selector not found: %v", messageSelector, err)
+			}
+		}
+		if line.Extra == nil {
+			line.Extra = object
+		} else {
+			fields, err := extraFields(line)
+			if err != nil {
+				return line, err
+			}
+			for key, value := range object {
+				fields[key] = value
+			}
+		}
+		if len(messageSelector) > 0 {
+			line.Line = message
+		}
+		return line, nil
+	}), nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"encoding/json"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"testing"
+	"time"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	decoder, err := DecodeJSON(".msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := decoder.Process(&fswatcher.Line{
+		Line:  `{"level":"info","msg":"user logged in","user":{"id":42}}`,
+		Extra: map[string]interface{}{"app": "shop"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := line.Extra.(map[string]interface{})
+	if line.Line != "user logged in" || fields["level"] != "info" || fields["app"] != "shop" {
+		t.Fatalf("Unexpected result: line %q, extra %v.", line.Line, line.Extra)
+	}
+	if id := fields["user"].(map[string]interface{})["id"]; id != json.Number("42") {
+		t.Fatalf("Expected user.id 42, but got %v.", id)
+	}
+
+	nested, err := DecodeJSON(".log.lines[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err = nested.Process(&fswatcher.Line{Line: `{"log":{"lines":["first","second"]}}`})
+	if err != nil || line.Line != "second" {
+		t.Fatalf("Expected line \"second\", but got %v and error %v.", line, err)
+	}
+
+	raw, err := DecodeJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err = raw.Process(&fswatcher.Line{Line: `{"msg":"kept"}`})
+	if err != nil || line.Line != `{"msg":"kept"}` || line.Extra.(map[string]interface{})["msg"] != "kept" {
+		t.Fatalf("Expected the raw line with extra fields, but got %v and error %v.", line, err)
+	}
+
+	for _, input := range []string{`not json`, `[1, 2]`, `{"message":"no msg field"}`} {
+		line, err = decoder.Process(&fswatcher.Line{Line: input})
+		if err == nil || line == nil || line.Line != input {
+			t.Fatalf("%q: expected an error and the unchanged line, but got %v and error %v.", input, line, err)
+		}
+	}
+
+	for _, selector := range []string{"msg", "."} {
+		if _, err = DecodeJSON(selector); err == nil {
+			t.Fatalf("%q: expected an invalid selector error.", selector)
+		}
+	}
+}
+
+func TestDecodeJSONErrorLocation(t *testing.T) {
+	decoder, err := DecodeJSON(".msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	tailer := PipelineTailer(source, Pipeline{decoder})
+	defer source.Close()
+	go func() {
+		source.lines <- &fswatcher.Line{Line: "not json", File: "/var/log/app.log", Offset: 128}
+	}()
+	select {
+	case err := <-tailer.Errors():
+		processorErr, ok := err.(*ProcessorError)
+		if !ok || processorErr.File != "/var/log/app.log" || processorErr.Offset != 128 {
+			t.Fatalf("Expected a ProcessorError for /var/log/app.log at offset 128, but got %v.", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout while waiting for the processor error.")
+	}
+	select {
+	case line := <-tailer.Lines():
+		if line.Line != "not json" {
+			t.Fatalf("Expected the unchanged line, but got %q.", line.Line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout while waiting for the line.")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	ctx "context"
 	"github.com/jdrews/go-tailer/fswatcher"
 	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 	configuration "github.com/jdrews/go-tailer/config"
@@ -11,45 +12,90 @@ import (
 )
 
 type KafkaTailer struct {
-	lines  chan *fswatcher.Line
-	errors chan fswatcher.Error
+	lines    chan *fswatcher.Line
+	errors   chan fswatcher.Error
+	cancel   ctx.CancelFunc
+	stopped  chan struct{} // closed when the consumer has terminated
+	closeErr error         // error from closing the client, valid after stopped is closed
+	metrics  TailerMetrics
 }
 
 type consumer struct {
 	ready     chan bool
 	lineChan  chan *fswatcher.Line
 	errorChan chan fswatcher.Error
+	metrics   TailerMetrics
 }
 
-func (t KafkaTailer) Lines() chan *fswatcher.Line {
+func (t *KafkaTailer) Lines() chan *fswatcher.Line {
 	return t.lines
 }
 
-func (t KafkaTailer) Errors() chan fswatcher.Error {
+func (t *KafkaTailer) Errors() chan fswatcher.Error {
 	return t.errors
 }
 
-func (t KafkaTailer) Close() {
-	logrus.Info("Close method called")
+// Close stops the consumer. The Lines() and Errors() channels are closed when the client has been closed.
+func (t *KafkaTailer) Close() {
+	t.cancel()
+}
 
+// Shutdown stops the consumer and waits until the client has been closed.
+func (t *KafkaTailer) Shutdown(shutdownCtx ctx.Context) error {
+	t.Close()
+	select {
+	case <-t.stopped:
+		return t.closeErr
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
 }
 
 // RunKafkaTailer runs the kafka tailer
 func RunKafkaTailer(cfg *configuration.InputConfig) fswatcher.FileTailer {
-	lineChan := make(chan *fswatcher.Line)
-	errorChan := make(chan fswatcher.Error)
+	return RunKafkaTailerContext(ctx.Background(), cfg)
+}
 
+// RunKafkaTailerContext runs the kafka tailer until parent is done or the tailer is closed.
+func RunKafkaTailerContext(parent ctx.Context, cfg *configuration.InputConfig) fswatcher.FileTailer {
+	return RunKafkaTailerWithMetrics(parent, cfg, nil)
+}
+
+// RunKafkaTailerWithMetrics is like RunKafkaTailerContext, but reports consumed messages, rebalances, and errors to metrics.
+// If metrics is nil, no metrics are reported.
+func RunKafkaTailerWithMetrics(parent ctx.Context, cfg *configuration.InputConfig, metrics TailerMetrics) fswatcher.FileTailer {
+	if metrics == nil {
+		metrics = NoopTailerMetrics{}
+	}
+	kafkaCtx, cancel := ctx.WithCancel(parent)
 	tailer := &KafkaTailer{
-		lines:  lineChan,
-		errors: errorChan,
+		lines:   make(chan *fswatcher.Line),
+		errors:  make(chan fswatcher.Error),
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+		metrics: metrics,
 	}
 
-	go initKafkaConsumer(lineChan, errorChan, cfg)
+	go tailer.initKafkaConsumer(kafkaCtx, cfg)
 
-	return *tailer
+	return tailer
 }
 
-func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.Error, cfg *configuration.InputConfig) {
+func (t *KafkaTailer) initKafkaConsumer(kafkaCtx ctx.Context, cfg *configuration.InputConfig) {
+
+	defer func() {
+		close(t.lines)
+		close(t.errors)
+		close(t.stopped)
+	}()
+
+	sendError := func(err fswatcher.Error) {
+		t.metrics.Error(err)
+		select {
+		case t.errors <- err:
+		case <-kafkaCtx.Done():
+		}
+	}
 
 	version, err := sarama.ParseKafkaVersion(cfg.KafkaVersion)
 	if err != nil {
@@ -63,8 +109,9 @@ func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.E
 
 	consumer := consumer{
 		ready:     make(chan bool),
-		lineChan:  lineChan,
-		errorChan: errorChan,
+		lineChan:  t.lines,
+		errorChan: t.errors,
+		metrics:   t.metrics,
 	}
 
 	kafkaConfig := sarama.NewConfig()
@@ -78,7 +125,7 @@ func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.E
 	case "range":
 		kafkaConfig.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
 	default:
-		consumer.errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Unrecognized consumer group partition assignor!")
+		sendError(fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Unrecognized consumer group partition assignor!"))
 	}
 
 	if cfg.KafkaConsumeFromOldest {
@@ -89,10 +136,10 @@ func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.E
 	 * Setup a new Sarama consumer group
 	 */
 
-	ctx, cancel := ctx.WithCancel(ctx.Background())
 	client, err := sarama.NewConsumerGroup(cfg.KafkaBrokers, cfg.KafkaConsumerGroupName, kafkaConfig)
 	if err != nil {
-		consumer.errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Error creating client")
+		sendError(fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Error creating client"))
+		return
 	}
 
 	wg := &sync.WaitGroup{}
@@ -103,11 +150,11 @@ func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.E
 			// `Consume` should be called inside an infinite loop, when a
 			// server-side rebalance happens, the consumer session will need to be
 			// recreated to get the new claims
-			if err := client.Consume(ctx, cfg.KafkaTopics, &consumer); err != nil {
-				consumer.errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Error from consumer")
+			if err := client.Consume(kafkaCtx, cfg.KafkaTopics, &consumer); err != nil {
+				sendError(fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Error from consumer"))
 			}
 			// check if context was cancelled, signaling that the consumer should stop
-			if ctx.Err() != nil {
+			if kafkaCtx.Err() != nil {
 				logrus.Infof("[Kafka] Consumer %s goroutine exiting.", cfg.KafkaConsumerGroupName)
 				return
 			}
@@ -115,19 +162,19 @@ func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.E
 		}
 	}()
 
-	<-consumer.ready // Await till the consumer has been set up
-	logrus.Infof("[Kafka] Consumer %s active.", cfg.KafkaConsumerGroupName)
-
 	select {
-	case <-ctx.Done():
-		logrus.Info("[Kafka] Consumer terminating: context cancelled")
+	case <-consumer.ready: // Await till the consumer has been set up
+		logrus.Infof("[Kafka] Consumer %s active.", cfg.KafkaConsumerGroupName)
+	case <-kafkaCtx.Done():
 	}
 
-	cancel()
+	<-kafkaCtx.Done()
+	logrus.Info("[Kafka] Consumer terminating: context cancelled")
+
 	wg.Wait()
 
 	if err = client.Close(); err != nil {
-		consumer.errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Error closing client")
+		t.closeErr = fswatcher.NewError(fswatcher.NotSpecified, err, "[Kafka] Error closing client")
 		return
 	}
 
@@ -138,6 +185,7 @@ func initKafkaConsumer(lineChan chan *fswatcher.Line, errorChan chan fswatcher.E
 // Setup is run at the beginning of a new session, before ConsumeClaim
 func (consumer *consumer) Setup(sarama.ConsumerGroupSession) error {
 	// Mark the consumer as ready
+	consumer.metrics.KafkaRebalance()
 	close(consumer.ready)
 	return nil
 }
@@ -152,8 +200,19 @@ func (consumer *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, clai
 
 	for message := range claim.Messages() {
 		logrus.Debugf("[Kafka] Message content: %s", string(message.Value))
+		select {
+		case consumer.lineChan <- &fswatcher.Line{
+			Line:      string(message.Value),
+			Offset:    message.Offset,
+			Topic:     message.Topic,
+			Partition: message.Partition,
+			ReadTime:  time.Now(),
+		}:
+		case <-session.Context().Done():
+			return nil
+		}
+		consumer.metrics.KafkaMessage(message.Topic, message.Partition)
 		session.MarkMessage(message, "")
-		consumer.lineChan <- &fswatcher.Line{Line: string(message.Value)}
 	}
 
 	return nil
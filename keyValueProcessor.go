@@ -0,0 +1,158 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"strconv"
+	"strings"
+)
+
+// KeyValueConfig defines the format of key=value lines for DecodeKeyValues(). The zero value is logfmt.
+type KeyValueConfig struct {
+	// PairSeparator separates the key=value pairs. Empty means whitespace, like in logfmt.
+	// Whitespace around other separators is ignored, like in key=value, key2=value2
+	PairSeparator string
+	// KeyValueSeparator separates the key from the value. Empty means "=".
+	KeyValueSeparator string
+	// If DropRawLine is true, Line.Line is set to the empty string, so that only the fields remain.
+	DropRawLine bool
+}
+
+// DecodeLogfmt creates a Processor for logfmt lines like level=info msg="started" dur=3ms, see DecodeKeyValues().
+func DecodeLogfmt() Processor {
+	processor, _ := DecodeKeyValues(KeyValueConfig{}) // The default config is valid.
+	return processor
+}
+
+// DecodeKeyValues creates a Processor that adds the key=value pairs of each line to Line.Extra, see SetField().
+// Values are strings. Values in double quotes may contain separators and escape sequences like \" and \n.
+// A key without value, like the debug in debug level=info, is set to true.
+// Lines that cannot be parsed are reported as ProcessorError and passed on unchanged.
+func DecodeKeyValues(cfg KeyValueConfig) (Processor, error) {
+	if len(cfg.KeyValueSeparator) == 0 {
+		cfg.KeyValueSeparator = "="
+	}
+	if cfg.PairSeparator == cfg.KeyValueSeparator {
+		return nil, fmt.Errorf("invalid key value config: pair separator and key value separator must be different")
+	}
+	if strings.Contains(cfg.PairSeparator, `"`) || strings.Contains(cfg.KeyValueSeparator, `"`) {
+		return nil, fmt.Errorf("invalid key value config: separators must not contain quotes")
+	}
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		parsed, err := parseKeyValues(cfg, line.Line)
+		if err != nil {
+			return line, err
+		}
+		fields, err := extraFields(line)
+		if err != nil {
+			return line, err
+		}
+		for key, value := range parsed {
+			fields[key] = value
+		}
+		if cfg.DropRawLine {
+			line.Line = ""
+		}
+		return line, nil
+	}), nil
+}
+
+func parseKeyValues(cfg KeyValueConfig, s string) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for {
+		s = skipPairSeparators(cfg, s)
+		if len(s) == 0 {
+			return result, nil
+		}
+		pairEnd := indexPairSeparator(cfg, s)
+		if pairEnd < 0 {
+			pairEnd = len(s)
+		}
+		keyEnd := strings.Index(s, cfg.KeyValueSeparator)
+		if keyEnd < 0 || keyEnd > pairEnd {
+			result[strings.TrimSpace(s[:pairEnd])] = true
+			s = s[pairEnd:]
+			continue
+		}
+		key := strings.TrimSpace(s[:keyEnd])
+		if len(key) == 0 {
+			return nil, fmt.Errorf("missing key before %q", cfg.KeyValueSeparator)
+		}
+		s = s[keyEnd+len(cfg.KeyValueSeparator):]
+		if strings.HasPrefix(s, `"`) {
+			value, rest, err := unquoteValue(s)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", key, err)
+			}
+			if len(rest) > 0 && !startsWithPairSeparator(cfg, rest) {
+				return nil, fmt.Errorf("%v: unexpected characters after quoted value", key)
+			}
+			result[key] = value
+			s = rest
+			continue
+		}
+		pairEnd = indexPairSeparator(cfg, s)
+		if pairEnd < 0 {
+			pairEnd = len(s)
+		}
+		result[key] = strings.TrimSpace(s[:pairEnd])
+		s = s[pairEnd:]
+	}
+}
+
+// Returns the value in double quotes at the start of s, and the rest of s after the closing quote.
+func unquoteValue(s string) (string, string, error) {
+	i := 1
+	for i < len(s) && s[i] != '"' {
+		if s[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(s) {
+		return "", "", fmt.Errorf("missing closing quote")
+	}
+	value, err := strconv.Unquote(s[:i+1])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid quoted value: %v", err)
+	}
+	return value, s[i+1:], nil
+}
+
+func skipPairSeparators(cfg KeyValueConfig, s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if len(cfg.PairSeparator) == 0 || !strings.HasPrefix(s, cfg.PairSeparator) {
+			return s
+		}
+		s = s[len(cfg.PairSeparator):]
+	}
+}
+
+func indexPairSeparator(cfg KeyValueConfig, s string) int {
+	if len(cfg.PairSeparator) == 0 {
+		return strings.IndexAny(s, " \t")
+	}
+	return strings.Index(s, cfg.PairSeparator)
+}
+
+func startsWithPairSeparator(cfg KeyValueConfig, s string) bool {
+	if len(cfg.PairSeparator) == 0 {
+		return s[0] == ' ' || s[0] == '\t'
+	}
+	return strings.HasPrefix(strings.TrimLeft(s, " \t"), cfg.PairSeparator)
+}
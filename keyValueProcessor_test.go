@@ -0,0 +1,86 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"github.com/jdrews/go-tailer/fswatcher"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeKeyValues(t *testing.T) {
+	for _, test := range []struct {
+		cfg      KeyValueConfig
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			line:     `level=info msg="started \"shop\"" dur=3ms`,
+			expected: map[string]interface{}{"level": "info", "msg": `started "shop"`, "dur": "3ms"},
+		},
+		{
+			line:     "  debug\tat=router  path=\"/a b\" empty= multi=\"line 1\\nline 2\"",
+			expected: map[string]interface{}{"debug": true, "at": "router", "path": "/a b", "empty": "", "multi": "line 1\nline 2"},
+		},
+		{
+			cfg:      KeyValueConfig{PairSeparator: ",", KeyValueSeparator: ":"},
+			line:     `user: jane doe, role:"admin, ops" ,id:42`,
+			expected: map[string]interface{}{"user": "jane doe", "role": "admin, ops", "id": "42"},
+		},
+	} {
+		processor, err := DecodeKeyValues(test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := processor.Process(&fswatcher.Line{Line: test.line})
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(line.Extra, test.expected) {
+			t.Fatalf("%q: expected %v, but got %v", test.line, test.expected, line.Extra)
+		}
+		if line.Line != test.line {
+			t.Fatalf("%q: expected the raw line to be kept, but got %q", test.line, line.Line)
+		}
+	}
+}
+
+func TestDecodeKeyValuesDropRawLine(t *testing.T) {
+	processor, err := DecodeKeyValues(KeyValueConfig{DropRawLine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := processor.Process(&fswatcher.Line{Line: "a=1", Extra: map[string]interface{}{"b": "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Line != "" || !reflect.DeepEqual(line.Extra, map[string]interface{}{"a": "1", "b": "2"}) {
+		t.Fatalf("Unexpected result: line %q, extra %v.", line.Line, line.Extra)
+	}
+}
+
+func TestDecodeKeyValuesErrors(t *testing.T) {
+	for _, input := range []string{`msg="unterminated`, `=value`, `msg="a"b`, `msg="\q"`} {
+		line, err := DecodeLogfmt().Process(&fswatcher.Line{Line: input})
+		if err == nil || line == nil || line.Line != input || line.Extra != nil {
+			t.Fatalf("%q: expected an error and the unchanged line, but got %v and error %v.", input, line, err)
+		}
+	}
+	for _, cfg := range []KeyValueConfig{{PairSeparator: "="}, {PairSeparator: `"`}} {
+		if _, err := DecodeKeyValues(cfg); err == nil {
+			t.Fatalf("%#v: expected an invalid config error.", cfg)
+		}
+	}
+}
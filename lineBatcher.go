@@ -0,0 +1,147 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	ctx "context"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"sync"
+	"time"
+)
+
+// lineBatcher collects the lines of another tailer into batches, see BatchLines().
+type lineBatcher struct {
+	orig      fswatcher.FileTailer
+	lines     chan *fswatcher.Line
+	batches   chan []*fswatcher.Line
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{} // closed when the batching go-routine has terminated
+}
+
+// BatchLines wraps a tailer delivering lines on its Lines() channel, like the Kafka tailer or the webhook tailer,
+// and sends the lines in batches of up to maxBatchSize lines on the Batches() channel. A batch is sent when it is full,
+// or when its first line has waited for maxLatency. Zero means fswatcher.DefaultMaxBatchLatency.
+// Like the file tailer, the lines of a batch are sent one by one if the consumer reads the Lines() channel instead,
+// so consumers should read either Lines() or Batches(), but not both. The errors of the original tailer are passed through.
+// The file tailer can fill batches directly, see fswatcher.Options.MaxBatchSize.
+func BatchLines(orig fswatcher.FileTailer, maxBatchSize int, maxLatency time.Duration) fswatcher.BatchTailer {
+	if maxBatchSize <= 0 {
+		maxBatchSize = 1
+	}
+	if maxLatency <= 0 {
+		maxLatency = fswatcher.DefaultMaxBatchLatency
+	}
+	t := &lineBatcher{
+		orig:    orig,
+		lines:   make(chan *fswatcher.Line),
+		batches: make(chan []*fswatcher.Line),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go t.run(maxBatchSize, maxLatency)
+	return t
+}
+
+func (t *lineBatcher) run(maxBatchSize int, maxLatency time.Duration) {
+	var (
+		batch []*fswatcher.Line
+		timer = time.NewTimer(maxLatency)
+		done  = t.done // nil after Close() was called, the remaining lines of the original tailer are discarded
+	)
+	defer func() {
+		timer.Stop()
+		close(t.lines)
+		close(t.batches)
+		close(t.stopped)
+	}()
+	timer.Stop()
+	flush := func() {
+		if len(batch) > 0 && done != nil {
+			select {
+			case t.batches <- batch:
+			case t.lines <- batch[0]:
+				// The consumer reads lines.
+				for i := 1; i < len(batch) && done != nil; i++ {
+					select {
+					case t.lines <- batch[i]:
+					case <-done:
+						done = nil
+					}
+				}
+			case <-done:
+				done = nil
+			}
+		}
+		batch = nil
+		timer.Stop()
+	}
+	for {
+		select {
+		case line, ok := <-t.orig.Lines():
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				batch = make([]*fswatcher.Line, 0, maxBatchSize)
+				timer.Reset(maxLatency)
+			}
+			batch = append(batch, line)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-done:
+			done = nil
+			batch = nil
+			timer.Stop()
+		}
+	}
+}
+
+func (t *lineBatcher) Lines() chan *fswatcher.Line {
+	return t.lines
+}
+
+func (t *lineBatcher) Batches() chan []*fswatcher.Line {
+	return t.batches
+}
+
+func (t *lineBatcher) Errors() chan fswatcher.Error {
+	return t.orig.Errors()
+}
+
+// Close closes the original tailer. The channels are closed when the original tailer's Lines() channel is closed.
+func (t *lineBatcher) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	t.orig.Close()
+}
+
+func (t *lineBatcher) Shutdown(shutdownCtx ctx.Context) error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	err := t.orig.Shutdown(shutdownCtx)
+	select {
+	case <-t.stopped:
+		return err
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
+}
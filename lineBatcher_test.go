@@ -0,0 +1,95 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"testing"
+	"time"
+)
+
+func TestBatchLines(t *testing.T) {
+	source := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	batcher := BatchLines(source, 10, 50*time.Millisecond)
+	go func() {
+		for i := 1; i <= 25; i++ {
+			source.lines <- &fswatcher.Line{Line: fmt.Sprintf("line %v", i)}
+		}
+	}()
+	nextLine := 1
+	for _, size := range []int{10, 10, 5} { // the last batch is sent after the max latency
+		select {
+		case batch := <-batcher.Batches():
+			if len(batch) != size {
+				t.Fatalf("Expected a batch of %v lines, but got %v lines.", size, len(batch))
+			}
+			for _, line := range batch {
+				if line.Line != fmt.Sprintf("line %v", nextLine) {
+					t.Fatalf("Expected line %v, but got %q.", nextLine, line.Line)
+				}
+				nextLine++
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout while waiting for a batch of %v lines.", size)
+		}
+	}
+
+	// The remaining lines are sent when the source is closed.
+	go func() {
+		source.lines <- &fswatcher.Line{Line: "line 26"}
+		source.Close()
+	}()
+	batch := <-batcher.Batches()
+	if len(batch) != 1 || batch[0].Line != "line 26" {
+		t.Fatalf("Expected a batch with line 26, but got %v lines.", len(batch))
+	}
+	select {
+	case _, open := <-batcher.Batches():
+		if open {
+			t.Fatal("Expected the Batches() channel to be closed.")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout while waiting for the Batches() channel to be closed.")
+	}
+	if _, open := <-batcher.Lines(); open {
+		t.Fatal("Expected the Lines() channel to be closed.")
+	}
+}
+
+// Consumers reading the Lines() channel get all lines, like with the file tailer.
+func TestBatchLinesAsLines(t *testing.T) {
+	source := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	batcher := BatchLines(source, 10, 50*time.Millisecond)
+	go func() {
+		for i := 1; i <= 25; i++ {
+			source.lines <- &fswatcher.Line{Line: fmt.Sprintf("line %v", i)}
+		}
+		source.Close()
+	}()
+	for i := 1; i <= 25; i++ {
+		select {
+		case line := <-batcher.Lines():
+			if line == nil || line.Line != fmt.Sprintf("line %v", i) {
+				t.Fatalf("Expected line %v, but got %v.", i, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout while waiting for line %v.", i)
+		}
+	}
+	if _, open := <-batcher.Lines(); open {
+		t.Fatal("Expected the Lines() channel to be closed.")
+	}
+}
@@ -25,10 +25,14 @@ import (
 // lineBuffer is a thread safe queue for *fswatcher.Line.
 type lineBuffer interface {
 	Push(line *fswatcher.Line)
-	BlockingPop() *fswatcher.Line // can be interrupted by calling Close()
+	PushFront(line *fswatcher.Line) // puts back a line returned by BlockingPop() that could not be delivered
+	BlockingPop() *fswatcher.Line   // can be interrupted by calling Close() or Interrupt()
+	RemoveOldest() *fswatcher.Line  // returns nil if the buffer is empty
+	WaitForSpace(maxLen int) bool   // blocks until Len() < maxLen, returns false if the buffer was closed or interrupted
 	Len() int
-	io.Closer // will interrupt BlockingPop()
-	Clear()
+	Interrupt() // like Close(), BlockingPop() returns nil from now on, but lines can still be pushed until Close()
+	io.Closer   // will interrupt BlockingPop() and WaitForSpace()
+	Clear() int // returns the number of removed lines
 }
 
 func NewLineBuffer() lineBuffer {
@@ -40,9 +44,10 @@ func NewLineBuffer() lineBuffer {
 }
 
 type lineBufferImpl struct {
-	buffer *list.List
-	lock   *sync.Cond
-	closed bool
+	buffer      *list.List
+	lock        *sync.Cond
+	closed      bool
+	interrupted bool
 }
 
 func (b *lineBufferImpl) Push(line *fswatcher.Line) {
@@ -50,39 +55,81 @@ func (b *lineBufferImpl) Push(line *fswatcher.Line) {
 	defer b.lock.L.Unlock()
 	if !b.closed {
 		b.buffer.PushBack(line)
-		b.lock.Signal()
+		b.lock.Broadcast()
 	}
 }
 
-// Interrupted by Close(), returns nil when Close() is called.
-func (b *lineBufferImpl) BlockingPop() *fswatcher.Line {
+func (b *lineBufferImpl) PushFront(line *fswatcher.Line) {
 	b.lock.L.Lock()
 	defer b.lock.L.Unlock()
 	if !b.closed {
-		for b.buffer.Len() == 0 && !b.closed {
+		b.buffer.PushFront(line)
+		b.lock.Broadcast()
+	}
+}
+
+// Interrupted by Close() and Interrupt(), returns nil when one of them is called.
+func (b *lineBufferImpl) BlockingPop() *fswatcher.Line {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	if !b.closed && !b.interrupted {
+		for b.buffer.Len() == 0 && !b.closed && !b.interrupted {
 			b.lock.Wait()
 		}
-		if !b.closed {
-			first := b.buffer.Front()
-			b.buffer.Remove(first)
-			switch line := first.Value.(type) {
-			case *fswatcher.Line:
-				return line
-			default:
-				// this cannot happen
-				logFatal.Fatal("unexpected type in tailer b.buffer")
-			}
+		if !b.closed && !b.interrupted {
+			return b.removeFirst()
 		}
 	}
 	return nil
 }
 
+func (b *lineBufferImpl) RemoveOldest() *fswatcher.Line {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	if b.buffer.Len() == 0 {
+		return nil
+	}
+	return b.removeFirst()
+}
+
+// The caller must hold the lock and make sure the buffer is not empty.
+func (b *lineBufferImpl) removeFirst() *fswatcher.Line {
+	first := b.buffer.Front()
+	b.buffer.Remove(first)
+	b.lock.Broadcast() // wake up WaitForSpace()
+	switch line := first.Value.(type) {
+	case *fswatcher.Line:
+		return line
+	default:
+		// this cannot happen
+		logFatal.Fatal("unexpected type in tailer b.buffer")
+	}
+	return nil
+}
+
+// Interrupted by Close() and Interrupt(), returns false when one of them is called.
+func (b *lineBufferImpl) WaitForSpace(maxLen int) bool {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	for b.buffer.Len() >= maxLen && !b.closed && !b.interrupted {
+		b.lock.Wait()
+	}
+	return !b.closed && !b.interrupted
+}
+
+func (b *lineBufferImpl) Interrupt() {
+	b.lock.L.Lock()
+	defer b.lock.L.Unlock()
+	b.interrupted = true
+	b.lock.Broadcast()
+}
+
 func (b *lineBufferImpl) Close() error {
 	b.lock.L.Lock()
 	defer b.lock.L.Unlock()
 	if !b.closed {
 		b.closed = true
-		b.lock.Signal()
+		b.lock.Broadcast()
 	}
 	return nil
 }
@@ -93,8 +140,11 @@ func (b *lineBufferImpl) Len() int {
 	return b.buffer.Len()
 }
 
-func (b *lineBufferImpl) Clear() {
+func (b *lineBufferImpl) Clear() int {
 	b.lock.L.Lock()
 	defer b.lock.L.Unlock()
+	removed := b.buffer.Len()
 	b.buffer = list.New()
+	b.lock.Broadcast()
+	return removed
 }
@@ -0,0 +1,235 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics implements go_tailer.TailerMetrics with Prometheus collectors.
+package metrics
+
+import (
+	tailer "github.com/jdrews/go-tailer"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Namespace is the prefix of all metric names.
+const Namespace = "tailer"
+
+// Collectors implements go_tailer.TailerMetrics. Create it with New().
+type Collectors struct {
+	bufferLines     prometheus.Gauge
+	droppedLines    prometheus.Counter
+	linesRead       *prometheus.CounterVec
+	bytesRead       *prometheus.CounterVec
+	readOffset      *prometheus.GaugeVec
+	lag             *prometheus.GaugeVec
+	rotations       *prometheus.CounterVec
+	truncations     *prometheus.CounterVec
+	openFiles       prometheus.Gauge
+	events          prometheus.Counter
+	errors          *prometheus.CounterVec
+	kafkaMessages   *prometheus.CounterVec
+	kafkaRebalances prometheus.Counter
+	webhookRequests *prometheus.CounterVec
+	lock            sync.Mutex
+	openPaths       map[string]int // number of open files per path, a rotated file may still be read under the path of the new file
+}
+
+var _ tailer.TailerMetrics = (*Collectors)(nil)
+
+// New creates the collectors and registers them with registerer.
+// Serve them with Handler(), using the registry that implements registerer as gatherer.
+func New(registerer prometheus.Registerer) (*Collectors, error) {
+	c := &Collectors{
+		bufferLines: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "buffer_lines",
+			Help:      "Number of lines in the buffer of the buffered tailer.",
+		}),
+		droppedLines: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "buffer_dropped_lines_total",
+			Help:      "Number of lines dropped because the buffer was full.",
+		}),
+		linesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "lines_read_total",
+			Help:      "Number of lines read per file.",
+		}, []string{"file"}),
+		bytesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_read_total",
+			Help:      "Number of bytes read per file, including line terminators.",
+		}, []string{"file"}),
+		readOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "read_offset_bytes",
+			Help:      "Current read position per file.",
+		}, []string{"file"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "lag_bytes",
+			Help:      "File size minus read position per file, updated when the tailer has read up to the end of the file.",
+		}, []string{"file"}),
+		rotations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "rotations_total",
+			Help:      "Number of times a file was rotated away or deleted, per path.",
+		}, []string{"file"}),
+		truncations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "truncations_total",
+			Help:      "Number of times a file was truncated, per path.",
+		}, []string{"file"}),
+		openFiles: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "open_files",
+			Help:      "Number of files currently read by the file tailer.",
+		}),
+		events: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "fs_events_total",
+			Help:      "Number of file system events processed by the file tailer.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "errors_total",
+			Help:      "Number of errors and warnings reported by the tailers, by error type.",
+		}, []string{"type"}),
+		kafkaMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "kafka_messages_total",
+			Help:      "Number of messages consumed from Kafka per topic.",
+		}, []string{"topic"}),
+		kafkaRebalances: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "kafka_rebalances_total",
+			Help:      "Number of Kafka consumer group sessions started, i.e. partition assignments.",
+		}),
+		webhookRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "webhook_requests_total",
+			Help:      "Number of webhook requests by HTTP status.",
+		}, []string{"status"}),
+		openPaths: make(map[string]int),
+	}
+	for _, collector := range []prometheus.Collector{c.bufferLines, c.droppedLines, c.linesRead, c.bytesRead, c.readOffset, c.lag, c.rotations, c.truncations, c.openFiles, c.events, c.errors, c.kafkaMessages, c.kafkaRebalances, c.webhookRequests} {
+		err := registerer.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Handler serves the metrics gathered by gatherer, usually the registry passed to New().
+// The text exposition format is used unless the client requests a different format.
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+func (c *Collectors) Start() {
+	c.bufferLines.Set(0)
+}
+
+func (c *Collectors) Inc() {
+	c.bufferLines.Inc()
+}
+
+func (c *Collectors) Dec() {
+	c.bufferLines.Dec()
+}
+
+func (c *Collectors) Set(value int64) {
+	c.bufferLines.Set(float64(value))
+}
+
+func (c *Collectors) Stop() {
+	c.bufferLines.Set(0)
+}
+
+func (c *Collectors) Drop(count int64) {
+	c.droppedLines.Add(float64(count))
+}
+
+func (c *Collectors) LinesRead(path string, lines int, bytes int64) {
+	c.linesRead.WithLabelValues(path).Add(float64(lines))
+	c.bytesRead.WithLabelValues(path).Add(float64(bytes))
+}
+
+func (c *Collectors) ReadPosition(path string, offset int64, size int64) {
+	c.readOffset.WithLabelValues(path).Set(float64(offset))
+	lag := size - offset
+	if lag < 0 {
+		lag = 0 // The file was truncated, this will be detected with the next event.
+	}
+	c.lag.WithLabelValues(path).Set(float64(lag))
+}
+
+func (c *Collectors) FileOpened(path string) {
+	c.openFiles.Inc()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.openPaths[path]++
+}
+
+// FileClosed removes all time series of the file's path, so that deleted files don't leave stale time series.
+// If another file is open under the same path, like the new file after a rotation, its time series are kept.
+// Counters of a path that is opened again start from zero, which Prometheus treats as a counter reset.
+func (c *Collectors) FileClosed(path string) {
+	c.openFiles.Dec()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.openPaths[path] > 1 {
+		c.openPaths[path]--
+		return
+	}
+	delete(c.openPaths, path)
+	c.linesRead.DeleteLabelValues(path)
+	c.bytesRead.DeleteLabelValues(path)
+	c.readOffset.DeleteLabelValues(path)
+	c.lag.DeleteLabelValues(path)
+	c.rotations.DeleteLabelValues(path)
+	c.truncations.DeleteLabelValues(path)
+}
+
+func (c *Collectors) FileRotated(path string) {
+	c.rotations.WithLabelValues(path).Inc()
+}
+
+func (c *Collectors) FileTruncated(path string) {
+	c.truncations.WithLabelValues(path).Inc()
+}
+
+func (c *Collectors) EventProcessed() {
+	c.events.Inc()
+}
+
+func (c *Collectors) Error(err fswatcher.Error) {
+	c.errors.WithLabelValues(err.Type().String()).Inc()
+}
+
+func (c *Collectors) KafkaMessage(topic string, partition int32) {
+	c.kafkaMessages.WithLabelValues(topic).Inc()
+}
+
+func (c *Collectors) KafkaRebalance() {
+	c.kafkaRebalances.Inc()
+}
+
+func (c *Collectors) WebhookRequest(status int) {
+	c.webhookRequests.WithLabelValues(strconv.Itoa(status)).Inc()
+}
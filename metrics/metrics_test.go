@@ -0,0 +1,170 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/jdrews/go-tailer/fswatcher"
+	"github.com/jdrews/go-tailer/glob"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileTailerMetrics(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "test.log")
+	err := os.WriteFile(logfile, []byte("line 1\nline 2\nline 3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	collectors, err := New(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := glob.Parse(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := logrus.New()
+	log.Level = logrus.WarnLevel
+	tailer, err := fswatcher.Run(fswatcher.Options{
+		Globs:   []glob.Glob{g},
+		Readall: true,
+		Metrics: collectors,
+		Log:     log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		select {
+		case <-tailer.Lines():
+		case err := <-tailer.Errors():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for line %v", i)
+		}
+	}
+	waitFor(t, "lag", func() bool {
+		return testutil.CollectAndCount(collectors.lag) == 1
+	})
+	if v := testutil.ToFloat64(collectors.linesRead.WithLabelValues(logfile)); v != 3 {
+		t.Fatalf("expected 3 lines read, but got %v", v)
+	}
+	if v := testutil.ToFloat64(collectors.bytesRead.WithLabelValues(logfile)); v != 21 {
+		t.Fatalf("expected 21 bytes read, but got %v", v)
+	}
+	if v := testutil.ToFloat64(collectors.readOffset.WithLabelValues(logfile)); v != 21 {
+		t.Fatalf("expected read offset 21, but got %v", v)
+	}
+	if v := testutil.ToFloat64(collectors.openFiles); v != 1 {
+		t.Fatalf("expected 1 open file, but got %v", v)
+	}
+
+	server := httptest.NewServer(Handler(registry))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `tailer_lines_read_total{file="`+logfile+`"} 3`) {
+		t.Fatalf("lines_read_total not found in response:\n%s", body)
+	}
+
+	err = tailer.Shutdown(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(collectors.openFiles); v != 0 {
+		t.Fatalf("expected 0 open files after shutdown, but got %v", v)
+	}
+	if n := testutil.CollectAndCount(collectors.lag); n != 0 {
+		t.Fatalf("expected the lag to be removed after shutdown, but found %v time series", n)
+	}
+	if n := testutil.CollectAndCount(collectors.linesRead); n != 0 {
+		t.Fatalf("expected the lines read to be removed after shutdown, but found %v time series", n)
+	}
+}
+
+// A rotated file that is closed under the same path as the new file must not remove the time series of the new file.
+func TestFileClosedAfterRotation(t *testing.T) {
+	collectors, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectors.FileOpened("test.log")
+	collectors.FileOpened("test.log") // the new file, while the rotated file is still read
+	collectors.ReadPosition("test.log", 10, 15)
+	collectors.LinesRead("test.log", 2, 10)
+	collectors.FileRotated("test.log")
+	collectors.FileClosed("test.log") // the rotated file
+	if n := testutil.CollectAndCount(collectors.lag); n != 1 {
+		t.Fatalf("expected the lag of the new file to be kept, but found %v time series", n)
+	}
+	if v := testutil.ToFloat64(collectors.readOffset.WithLabelValues("test.log")); v != 10 {
+		t.Fatalf("expected read offset 10, but got %v", v)
+	}
+	if v := testutil.ToFloat64(collectors.rotations.WithLabelValues("test.log")); v != 1 {
+		t.Fatalf("expected 1 rotation, but got %v", v)
+	}
+	collectors.FileClosed("test.log")
+	for name, vec := range map[string]prometheus.Collector{"lines read": collectors.linesRead, "bytes read": collectors.bytesRead, "read offset": collectors.readOffset, "lag": collectors.lag, "rotations": collectors.rotations} {
+		if n := testutil.CollectAndCount(vec); n != 0 {
+			t.Fatalf("expected the %v to be removed, but found %v time series", name, n)
+		}
+	}
+	if v := testutil.ToFloat64(collectors.openFiles); v != 0 {
+		t.Fatalf("expected 0 open files, but got %v", v)
+	}
+}
+
+func TestErrorMetrics(t *testing.T) {
+	collectors, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectors.Error(&fswatcher.LineTooLongError{})
+	collectors.Error(fswatcher.NewError(fswatcher.NotSpecified, nil, "test"))
+	collectors.Error(&fswatcher.LineTooLongError{})
+	if v := testutil.ToFloat64(collectors.errors.WithLabelValues("line_too_long")); v != 2 {
+		t.Fatalf("expected 2 line_too_long errors, but got %v", v)
+	}
+	if v := testutil.ToFloat64(collectors.errors.WithLabelValues("not_specified")); v != 1 {
+		t.Fatalf("expected 1 not_specified error, but got %v", v)
+	}
+}
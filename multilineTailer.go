@@ -0,0 +1,230 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	ctx "context"
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default for MultilineConfig.FlushTimeout.
+const DefaultMultilineFlushTimeout = time.Second
+
+// MultilineConfig defines how lines are assembled into multiline records.
+// Exactly one of StartPattern and ContinuationPattern must be set.
+type MultilineConfig struct {
+	// A line matching StartPattern starts a new record, all other lines are appended to the current record.
+	// Example: ^\d{4}-\d{2}-\d{2} for logs where each record starts with a date.
+	StartPattern *regexp.Regexp
+	// A line matching ContinuationPattern is appended to the current record, all other lines start a new record.
+	// Example: ^\s for Java stack traces where continuation lines are indented.
+	ContinuationPattern *regexp.Regexp
+	// If a record reaches MaxLines lines or MaxBytes bytes, it is emitted and the next line starts a new record.
+	// Zero means no limit.
+	MaxLines int
+	MaxBytes int
+	// If no new line is read from a file for FlushTimeout, the pending record for that file is emitted.
+	// Zero means DefaultMultilineFlushTimeout.
+	FlushTimeout time.Duration
+}
+
+// implements fswatcher.FileTailer
+type multilineTailer struct {
+	out       chan *fswatcher.Line
+	orig      fswatcher.FileTailer
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{} // closed when run() has terminated
+}
+
+// a record that is not yet complete
+type pendingRecord struct {
+	first     *fswatcher.Line // the first line of the record, provides File, Offset and Extra for the result
+	last      *fswatcher.Line // the last line of the record, provides EndOffset and ReadTime for the result
+	truncated bool
+	lines     []string
+	nBytes    int
+	deadline  time.Time
+}
+
+func (m *multilineTailer) Lines() chan *fswatcher.Line {
+	return m.out
+}
+
+func (m *multilineTailer) Errors() chan fswatcher.Error {
+	return m.orig.Errors()
+}
+
+func (m *multilineTailer) Close() {
+	m.closeOnce.Do(func() {
+		m.orig.Close()
+		close(m.done)
+	})
+}
+
+func (m *multilineTailer) Shutdown(shutdownCtx ctx.Context) error {
+	m.Close()
+	err := m.orig.Shutdown(shutdownCtx)
+	select {
+	case <-m.stopped:
+		return err
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
+}
+
+// MultilineTailer is a wrapper around a tailer that joins consecutive lines into multiline records,
+// like stack traces following a log message. The lines of a record are joined with '\n'.
+// Records are assembled per source file, so lines from different files are never mixed.
+// The metadata of a record is taken from its first line, except for EndOffset and ReadTime, which are taken from its
+// last line. Truncated is set if any line of the record was truncated.
+func MultilineTailer(orig fswatcher.FileTailer, cfg MultilineConfig) (fswatcher.FileTailer, error) {
+	if (cfg.StartPattern == nil) == (cfg.ContinuationPattern == nil) {
+		return nil, fmt.Errorf("invalid multiline config: exactly one of start pattern and continuation pattern must be set")
+	}
+	if cfg.MaxLines < 0 || cfg.MaxBytes < 0 || cfg.FlushTimeout < 0 {
+		return nil, fmt.Errorf("invalid multiline config: limits and timeout must not be negative")
+	}
+	if cfg.FlushTimeout == 0 {
+		cfg.FlushTimeout = DefaultMultilineFlushTimeout
+	}
+	m := &multilineTailer{
+		out:     make(chan *fswatcher.Line),
+		orig:    orig,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go m.run(cfg)
+	return m, nil
+}
+
+func (m *multilineTailer) run(cfg MultilineConfig) {
+	var (
+		pending = make(map[string]*pendingRecord) // file -> record
+		timer   = time.NewTimer(cfg.FlushTimeout)
+	)
+	defer close(m.stopped)
+	defer close(m.out)
+	defer timer.Stop()
+
+	// returns false if the tailer was closed
+	emit := func(file string) bool {
+		record := pending[file]
+		delete(pending, file)
+		result := *record.first
+		result.Line = strings.Join(record.lines, "\n")
+		result.EndOffset = record.last.EndOffset
+		result.ReadTime = record.last.ReadTime
+		result.Truncated = record.truncated
+		select {
+		case m.out <- &result:
+			return true
+		case <-m.done:
+			return false
+		}
+	}
+
+	for {
+		select {
+		case line, open := <-m.orig.Lines():
+			if !open {
+				for _, file := range filesByDeadline(pending, time.Time{}) {
+					if !emit(file) {
+						return
+					}
+				}
+				return
+			}
+			record, exists := pending[line.File]
+			if exists && (startsNewRecord(cfg, line.Line) || exceedsLimits(cfg, record, line.Line)) {
+				if !emit(line.File) {
+					return
+				}
+				exists = false
+			}
+			if !exists {
+				record = &pendingRecord{first: line}
+				pending[line.File] = record
+			}
+			record.last = line
+			record.truncated = record.truncated || line.Truncated
+			record.lines = append(record.lines, line.Line)
+			record.nBytes += len(line.Line)
+			record.deadline = time.Now().Add(cfg.FlushTimeout)
+		case <-timer.C:
+			for _, file := range filesByDeadline(pending, time.Now()) {
+				if !emit(file) {
+					return
+				}
+			}
+		case <-m.done:
+			return
+		}
+		resetTimer(timer, pending, cfg.FlushTimeout)
+	}
+}
+
+func startsNewRecord(cfg MultilineConfig, line string) bool {
+	if cfg.StartPattern != nil {
+		return cfg.StartPattern.MatchString(line)
+	}
+	return !cfg.ContinuationPattern.MatchString(line)
+}
+
+func exceedsLimits(cfg MultilineConfig, record *pendingRecord, line string) bool {
+	if cfg.MaxLines > 0 && len(record.lines) >= cfg.MaxLines {
+		return true
+	}
+	// The lines of a record are joined with '\n', so adding a line adds len(line)+1 bytes.
+	return cfg.MaxBytes > 0 && record.nBytes+len(record.lines)+len(line) > cfg.MaxBytes
+}
+
+// Returns the files with pending records that expired before now, oldest first.
+// If now is zero, all files are returned.
+func filesByDeadline(pending map[string]*pendingRecord, now time.Time) []string {
+	result := make([]string, 0, len(pending))
+	for file, record := range pending {
+		if now.IsZero() || !record.deadline.After(now) {
+			result = append(result, file)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return pending[result[i]].deadline.Before(pending[result[j]].deadline)
+	})
+	return result
+}
+
+// Sets the timer to fire at the earliest deadline of the pending records.
+func resetTimer(timer *time.Timer, pending map[string]*pendingRecord, flushTimeout time.Duration) {
+	next := flushTimeout
+	for _, record := range pending {
+		if d := time.Until(record.deadline); d < next {
+			next = d
+		}
+	}
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(next)
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"github.com/jdrews/go-tailer/fswatcher"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMultilineStartPattern(t *testing.T) {
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	multiline, err := MultilineTailer(src, MultilineConfig{
+		StartPattern: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`),
+		FlushTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer multiline.Close()
+	go func() {
+		// interleave two files
+		for _, line := range []*fswatcher.Line{
+			{Line: "2026-01-01 ERROR something failed", File: "a.log"},
+			{Line: "2026-01-01 INFO hello", File: "b.log"},
+			{Line: "java.lang.NullPointerException", File: "a.log"},
+			{Line: "\tat Main.main(Main.java:3)", File: "a.log"},
+			{Line: "2026-01-01 INFO world", File: "b.log"},
+			{Line: "2026-01-02 INFO done", File: "a.log"},
+		} {
+			src.lines <- line
+		}
+	}()
+	expectRecord(t, multiline, "b.log", "2026-01-01 INFO hello")
+	expectRecord(t, multiline, "a.log", "2026-01-01 ERROR something failed\njava.lang.NullPointerException\n\tat Main.main(Main.java:3)")
+	// the last record of each file is emitted after the flush timeout
+	start := time.Now()
+	expectRecord(t, multiline, "b.log", "2026-01-01 INFO world")
+	expectRecord(t, multiline, "a.log", "2026-01-02 INFO done")
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("records were flushed before the flush timeout")
+	}
+}
+
+func TestMultilineContinuationPattern(t *testing.T) {
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	multiline, err := MultilineTailer(src, MultilineConfig{
+		ContinuationPattern: regexp.MustCompile(`^\s`),
+		MaxLines:            3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for _, line := range []string{"Traceback:", " a", " b", " c", "done"} {
+			src.lines <- &fswatcher.Line{Line: line, File: "a.log"}
+		}
+		close(src.lines) // pending records are emitted when the source is closed
+	}()
+	expectRecord(t, multiline, "a.log", "Traceback:\n a\n b")
+	expectRecord(t, multiline, "a.log", " c")
+	expectRecord(t, multiline, "a.log", "done")
+}
+
+func TestMultilineOffsets(t *testing.T) {
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	multiline, err := MultilineTailer(src, MultilineConfig{
+		ContinuationPattern: regexp.MustCompile(`^\s`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readTime := time.Now()
+	go func() {
+		for i, line := range []string{"Traceback:", " a", " b", "done"} {
+			src.lines <- &fswatcher.Line{
+				Line:       line,
+				File:       "a.log",
+				Offset:     int64(i * 10),
+				EndOffset:  int64(i*10 + 10),
+				LineNumber: int64(i + 1),
+				ReadTime:   readTime.Add(time.Duration(i) * time.Second),
+				Truncated:  i == 1,
+			}
+		}
+		close(src.lines)
+	}()
+	for _, expected := range []fswatcher.Line{
+		{Line: "Traceback:\n a\n b", Offset: 0, EndOffset: 30, LineNumber: 1, ReadTime: readTime.Add(2 * time.Second), Truncated: true},
+		{Line: "done", Offset: 30, EndOffset: 40, LineNumber: 4, ReadTime: readTime.Add(3 * time.Second)},
+	} {
+		line := <-multiline.Lines()
+		if line == nil || line.Line != expected.Line || line.Offset != expected.Offset || line.EndOffset != expected.EndOffset ||
+			line.LineNumber != expected.LineNumber || !line.ReadTime.Equal(expected.ReadTime) || line.Truncated != expected.Truncated {
+			t.Fatalf("expected %#v but got %#v", expected, line)
+		}
+	}
+}
+
+func TestMultilineInvalidConfig(t *testing.T) {
+	src := &sourceTailer{lines: make(chan *fswatcher.Line)}
+	_, err := MultilineTailer(src, MultilineConfig{})
+	if err == nil {
+		t.Fatal("expected error for config without patterns")
+	}
+}
+
+func expectRecord(t *testing.T, tailer fswatcher.FileTailer, file string, expected string) {
+	select {
+	case line := <-tailer.Lines():
+		if line == nil {
+			t.Fatalf("expected %q but the tailer was closed", expected)
+		}
+		if line.File != file || line.Line != expected {
+			t.Fatalf("expected %q from %v but got %q from %v", expected, file, line.Line, line.File)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout while waiting for %q", expected)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	ctx "context"
+	"errors"
+	"fmt"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"github.com/jdrews/go-tailer/glob"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Processor is a stage of a Pipeline. Process may modify the line in place, or return a different line.
+// If Process returns nil, the line is dropped. If Process returns an error, the error is reported on the
+// Errors() channel of the pipeline tailer, and the returned line is still emitted unless it is nil.
+type Processor interface {
+	Process(line *fswatcher.Line) (*fswatcher.Line, error)
+}
+
+// ProcessorFunc implements Processor with a function.
+type ProcessorFunc func(line *fswatcher.Line) (*fswatcher.Line, error)
+
+func (f ProcessorFunc) Process(line *fswatcher.Line) (*fswatcher.Line, error) {
+	return f(line)
+}
+
+// Pipeline runs its processors in order. A Pipeline is a Processor itself, so pipelines can be nested.
+type Pipeline []Processor
+
+// Process stops at the first processor that drops the line. All errors are returned.
+func (p Pipeline) Process(line *fswatcher.Line) (*fswatcher.Line, error) {
+	var errs []error
+	for _, processor := range p {
+		var err error
+		line, err = processor.Process(line)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if line == nil {
+			break
+		}
+	}
+	return line, errors.Join(errs...)
+}
+
+// ProcessorError is reported on the Errors() channel of the pipeline tailer when a processor fails.
+// These errors are warnings, the tailer keeps running.
+type ProcessorError struct {
+	File   string // empty for tailers that don't read files
+	Offset int64
+	Err    error
+}
+
+func (e *ProcessorError) Cause() error {
+	return e.Err
+}
+
+func (e *ProcessorError) Type() fswatcher.ErrorType {
+	return fswatcher.ProcessingFailed
+}
+
+func (e *ProcessorError) Error() string {
+	if len(e.File) == 0 {
+		return fmt.Sprintf("failed to process line: %v", e.Err)
+	}
+	return fmt.Sprintf("%v: failed to process line at offset %v: %v", e.File, e.Offset, e.Err)
+}
+
+// implements fswatcher.FileTailer
+type pipelineTailer struct {
+	out       chan *fswatcher.Line
+	errors    chan fswatcher.Error
+	orig      fswatcher.FileTailer
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{} // closed when all goroutines have terminated
+}
+
+func (p *pipelineTailer) Lines() chan *fswatcher.Line {
+	return p.out
+}
+
+func (p *pipelineTailer) Errors() chan fswatcher.Error {
+	return p.errors
+}
+
+func (p *pipelineTailer) Close() {
+	p.closeOnce.Do(func() {
+		p.orig.Close()
+		close(p.done)
+	})
+}
+
+func (p *pipelineTailer) Shutdown(shutdownCtx ctx.Context) error {
+	p.Close()
+	err := p.orig.Shutdown(shutdownCtx)
+	select {
+	case <-p.stopped:
+		return err
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
+}
+
+// PipelineTailer is a wrapper around a tailer that runs each line through the pipeline, like BufferedTailer.
+// Lines are processed before they are passed on, so lines dropped by the pipeline don't take up space in a buffered
+// tailer wrapping the pipeline tailer. The errors of the original tailer and the processors are reported on Errors().
+func PipelineTailer(orig fswatcher.FileTailer, pipeline Pipeline) fswatcher.FileTailer {
+	var (
+		p = &pipelineTailer{
+			out:     make(chan *fswatcher.Line),
+			errors:  make(chan fswatcher.Error),
+			orig:    orig,
+			done:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		linesStopped = make(chan struct{})
+		wg           sync.WaitGroup
+	)
+	wg.Add(2)
+
+	// lines
+	go func() {
+		defer wg.Done()
+		defer close(linesStopped)
+		defer close(p.out)
+		for line := range orig.Lines() {
+			result, err := pipeline.Process(line)
+			if err != nil {
+				select {
+				case p.errors <- &ProcessorError{File: line.File, Offset: line.Offset, Err: err}:
+				case <-p.done:
+					return
+				}
+			}
+			if result == nil {
+				continue
+			}
+			select {
+			case p.out <- result:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	// errors: forwards the errors of the original tailer
+	go func() {
+		defer wg.Done()
+		origErrors := orig.Errors() // nil when closed
+		origLines := linesStopped   // nil when closed
+		for origErrors != nil || origLines != nil {
+			select {
+			case err, open := <-origErrors:
+				if !open {
+					origErrors = nil
+					continue
+				}
+				select {
+				case p.errors <- err:
+				case <-p.done:
+					return
+				}
+			case <-origLines:
+				origLines = nil
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(p.errors)
+		close(p.stopped)
+	}()
+	return p
+}
+
+// IncludeLines drops all lines that don't match regex.
+func IncludeLines(regex *regexp.Regexp) Processor {
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		if !regex.MatchString(line.Line) {
+			return nil, nil
+		}
+		return line, nil
+	})
+}
+
+// ExcludeLines drops all lines matching regex.
+func ExcludeLines(regex *regexp.Regexp) Processor {
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		if regex.MatchString(line.Line) {
+			return nil, nil
+		}
+		return line, nil
+	})
+}
+
+// RewriteLines replaces all matches of regex in the line with replacement.
+// Inside replacement, $1 or ${name} refer to submatches, see regexp.Regexp.Expand().
+func RewriteLines(regex *regexp.Regexp, replacement string) Processor {
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		line.Line = regex.ReplaceAllString(line.Line, replacement)
+		return line, nil
+	})
+}
+
+// SetField sets a field in Line.Extra, which must be nil or a map[string]interface{}.
+// If Extra is nil, a new map is created.
+func SetField(name string, value interface{}) Processor {
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		fields, err := extraFields(line)
+		if err != nil {
+			return line, err
+		}
+		fields[name] = value
+		return line, nil
+	})
+}
+
+// ForFiles runs processor only for lines read from files matching matcher, like a glob.Glob.
+// Other lines, including lines from tailers that don't read files, are passed on unchanged.
+func ForFiles(matcher glob.Matcher, processor Processor) Processor {
+	return ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		if len(line.File) == 0 || !matcher.Match(line.File) {
+			return line, nil
+		}
+		return processor.Process(line)
+	})
+}
+
+// Returns a Pipeline running the processor of the first file name pattern or glob in alphabetical order that
+// matches the line's file, see FormatPipeline(). Other lines, including lines from tailers that don't read files,
+// are processed by fallback, which may be nil. The result is empty if there are no processors.
+func filePatternPipeline(processors map[string]Processor, fallback Processor) (Pipeline, error) {
+	var (
+		patterns = make([]string, 0, len(processors))
+		matchers []glob.Matcher
+	)
+	for pattern := range processors {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		matcher, err := glob.ParseMatcher(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input configuration: %v", err)
+		}
+		matchers = append(matchers, matcher)
+	}
+	if len(matchers) == 0 && fallback == nil {
+		return Pipeline{}, nil
+	}
+	return Pipeline{ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+		if len(line.File) > 0 {
+			for i, matcher := range matchers {
+				if matcher.Match(line.File) {
+					return processors[patterns[i]].Process(line)
+				}
+			}
+		}
+		if fallback == nil {
+			return line, nil
+		}
+		return fallback.Process(line)
+	})}, nil
+}
+
+// Returns Line.Extra as a map, so that processors can add fields. If Extra is nil, a new map is created.
+func extraFields(line *fswatcher.Line) (map[string]interface{}, error) {
+	switch extra := line.Extra.(type) {
+	case nil:
+		fields := make(map[string]interface{})
+		line.Extra = fields
+		return fields, nil
+	case map[string]interface{}:
+		if extra == nil {
+			extra = make(map[string]interface{})
+			line.Extra = extra
+		}
+		return extra, nil
+	default:
+		return nil, fmt.Errorf("cannot set fields, because Line.Extra is a %T", line.Extra)
+	}
+}
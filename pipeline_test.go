@@ -0,0 +1,105 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"errors"
+	"github.com/jdrews/go-tailer/fswatcher"
+	"github.com/jdrews/go-tailer/glob"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPipelineTailer(t *testing.T) {
+	appGlob, err := glob.Parse("/var/log/app/*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		source   = &sourceTailer{lines: make(chan *fswatcher.Line)}
+		pipeline = Pipeline{
+			ExcludeLines(regexp.MustCompile(`DEBUG`)),
+			ForFiles(appGlob, Pipeline{
+				IncludeLines(regexp.MustCompile(`^\w+ `)),
+				SetField("app", "shop"),
+			}),
+			RewriteLines(regexp.MustCompile(`password=\S+`), "password=***"),
+			ProcessorFunc(func(line *fswatcher.Line) (*fswatcher.Line, error) {
+				if line.Line == "fail" {
+					return line, errors.New("test error")
+				}
+				return line, nil
+			}),
+		}
+		tailer = PipelineTailer(source, pipeline)
+	)
+	go func() {
+		for _, line := range []*fswatcher.Line{
+			{Line: "INFO login password=secret", File: "/var/log/app/app.log"},
+			{Line: "DEBUG dropped", File: "/var/log/app/app.log"},
+			{Line: "  dropped, because the app files only include lines starting with a word", File: "/var/log/app/app.log"},
+			{Line: "  not an app file", File: "/var/log/other.log"},
+			{Line: "fail"},
+		} {
+			source.lines <- line
+		}
+	}()
+
+	expectLine := func(expected string, expectedExtra interface{}) {
+		select {
+		case line := <-tailer.Lines():
+			if line.Line != expected {
+				t.Fatalf("Expected line %q, but got %q.", expected, line.Line)
+			}
+			if expectedExtra == nil && line.Extra != nil {
+				t.Fatalf("%q: expected no extra fields, but got %v.", expected, line.Extra)
+			}
+			if expectedExtra != nil && line.Extra.(map[string]interface{})["app"] != expectedExtra {
+				t.Fatalf("%q: expected app=%v, but got %v.", expected, expectedExtra, line.Extra)
+			}
+		case err := <-tailer.Errors():
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout while waiting for line %q.", expected)
+		}
+	}
+	expectLine("INFO login password=***", "shop")
+	expectLine("  not an app file", nil)
+	select {
+	case err := <-tailer.Errors():
+		if err.Type() != fswatcher.ProcessingFailed || err.Cause().Error() != "test error" {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout while waiting for the processor error.")
+	}
+	expectLine("fail", nil) // the line is emitted in spite of the error
+
+	source.Close()
+	if _, open := <-tailer.Lines(); open {
+		t.Fatal("Expected the Lines() channel to be closed.")
+	}
+	if _, open := <-tailer.Errors(); open {
+		t.Fatal("Expected the Errors() channel to be closed.")
+	}
+}
+
+func TestSetFieldRequiresMap(t *testing.T) {
+	line, err := SetField("key", "value").Process(&fswatcher.Line{Line: "test", Extra: "not a map"})
+	if err == nil || line == nil {
+		t.Fatalf("Expected an error and the unchanged line, but got line %v and error %v.", line, err)
+	}
+}
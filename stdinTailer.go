@@ -16,14 +16,22 @@ package go_tailer
 
 import (
 	"bufio"
+	ctx "context"
 	"github.com/jdrews/go-tailer/fswatcher"
+	"io"
+	"math"
 	"os"
-	"strings"
+	"sync"
+	"time"
 )
 
 type stdinTailer struct {
-	lines  chan *fswatcher.Line
-	errors chan fswatcher.Error
+	in        *os.File
+	lines     chan *fswatcher.Line
+	errors    chan fswatcher.Error
+	done      chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{} // closed when the reading go-routine has terminated
 }
 
 func (t *stdinTailer) Lines() chan *fswatcher.Line {
@@ -34,27 +42,111 @@ func (t *stdinTailer) Errors() chan fswatcher.Error {
 	return t.errors
 }
 
+// Close() stops the go-routine reading on stdin.
+// If stdin is a pipe or a terminal, the pending read is interrupted by setting a read deadline.
+// Otherwise, for example if stdin is a regular file, the go-routine terminates when the next line is read.
 func (t *stdinTailer) Close() {
-	// TODO: How to stop the go-routine reading on stdin?
+	t.closeOnce.Do(func() {
+		close(t.done)
+		// If the file doesn't support deadlines this fails with os.ErrNoDeadline, which we ignore.
+		_ = t.in.SetReadDeadline(time.Now())
+	})
+}
+
+func (t *stdinTailer) Shutdown(shutdownCtx ctx.Context) error {
+	t.Close()
+	select {
+	case <-t.stopped:
+		return nil
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
 }
 
 func RunStdinTailer() fswatcher.FileTailer {
-	lineChan := make(chan *fswatcher.Line)
-	errorChan := make(chan fswatcher.Error)
+	return runStdinTailer(ctx.Background(), os.Stdin, nil)
+}
+
+// RunStdinTailerContext is like RunStdinTailer, but the tailer is closed when parent is done.
+func RunStdinTailerContext(parent ctx.Context) fswatcher.FileTailer {
+	return runStdinTailer(parent, os.Stdin, nil)
+}
+
+// RunStdinTailerWithFramer is like RunStdinTailerContext, but stdin is split into records by framer instead of lines.
+// A nil framer means fswatcher.NewlineFramer().
+func RunStdinTailerWithFramer(parent ctx.Context, framer fswatcher.Framer) fswatcher.FileTailer {
+	return runStdinTailer(parent, os.Stdin, framer)
+}
+
+func runStdinTailer(parent ctx.Context, in *os.File, framer fswatcher.Framer) *stdinTailer {
+	if framer == nil {
+		framer = fswatcher.NewlineFramer()
+	}
+	t := &stdinTailer{
+		in:      in,
+		lines:   make(chan *fswatcher.Line),
+		errors:  make(chan fswatcher.Error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if parent.Done() != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+				t.Close()
+			case <-t.stopped:
+			}
+		}()
+	}
 	go func() {
-		reader := bufio.NewReader(os.Stdin)
+		defer func() {
+			close(t.lines)
+			close(t.errors)
+			close(t.stopped)
+		}()
+		var (
+			scanner    = bufio.NewScanner(in)
+			offset     int64
+			endOffset  int64
+			lineNumber int64
+		)
+		scanner.Buffer(make([]byte, 4096), math.MaxInt)
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			advance, record, err := framer.Frame(data, atEOF)
+			endOffset += int64(advance)
+			if record == nil {
+				// skipped bytes are not part of the next record
+				offset = endOffset
+			}
+			return advance, record, err
+		})
 		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "")
+			if !scanner.Scan() {
+				err := scanner.Err()
+				if err == nil {
+					err = io.EOF
+				}
+				select {
+				case <-t.done:
+				case t.errors <- fswatcher.NewError(fswatcher.NotSpecified, err, ""):
+				}
 				return
 			}
-			line = strings.TrimRight(line, "\r\n")
-			lineChan <- &fswatcher.Line{Line: line}
+			lineNumber++
+			result := &fswatcher.Line{
+				Line:       scanner.Text(),
+				Offset:     offset,
+				EndOffset:  endOffset,
+				LineNumber: lineNumber,
+				ReadTime:   time.Now(),
+			}
+			offset = result.EndOffset
+			select {
+			case <-t.done:
+				return
+			case t.lines <- result:
+			}
 		}
 	}()
-	return &stdinTailer{
-		lines:  lineChan,
-		errors: errorChan,
-	}
+	return t
 }
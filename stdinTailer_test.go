@@ -0,0 +1,64 @@
+// Copyright 2026 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	ctx "context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Shutdown() must interrupt the go-routine hanging in read() on stdin.
+func TestStdinTailerShutdown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Pipes don't support read deadlines on Windows.")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	tailer := runStdinTailer(ctx.Background(), r, nil)
+	_, err = w.WriteString("line 1\r\n")
+	if err != nil {
+		t.Fatalf("failed to write to pipe: %v", err)
+	}
+	select {
+	case line := <-tailer.Lines():
+		if line.Line != "line 1" {
+			t.Fatalf("expected \"line 1\" but got %q", line.Line)
+		}
+		if line.Offset != 0 || line.EndOffset != 8 || line.LineNumber != 1 {
+			t.Fatalf("unexpected metadata: %#v", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout while waiting for line 1")
+	}
+	shutdownCtx, cancel := ctx.WithTimeout(ctx.Background(), 2*time.Second)
+	defer cancel()
+	err = tailer.Shutdown(shutdownCtx)
+	if err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if _, open := <-tailer.Lines(); open {
+		t.Fatal("lines channel not closed")
+	}
+	if _, open := <-tailer.Errors(); open {
+		t.Fatal("errors channel not closed")
+	}
+}
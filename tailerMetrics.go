@@ -0,0 +1,50 @@
+// Copyright 2019-2020 The grok_exporter Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_tailer
+
+import (
+	"github.com/jdrews/go-tailer/fswatcher"
+)
+
+// TailerMetrics is notified about the internals of all tailers. It generalises BufferLoadMetric:
+// Pass it as fswatcher.Options.Metrics to the file tailer, as BufferOptions.Metric to the buffered tailer,
+// and to RunKafkaTailerWithMetrics() and InitWebhookTailerWithMetrics().
+// The metrics package implements TailerMetrics with Prometheus collectors.
+// The methods are called from the tailers' goroutines, so they must be fast and must not block.
+type TailerMetrics interface {
+	fswatcher.TailerMetrics
+	DroppedLinesMetric
+	// KafkaMessage is called for each message consumed from Kafka.
+	KafkaMessage(topic string, partition int32)
+	// KafkaRebalance is called when a new consumer group session starts, i.e. after partitions were (re-)assigned.
+	KafkaRebalance()
+	// WebhookRequest is called with the HTTP status of each webhook request.
+	WebhookRequest(status int)
+}
+
+// NoopTailerMetrics implements TailerMetrics without doing anything. Embed it to implement only some of the methods.
+type NoopTailerMetrics struct {
+	fswatcher.NoopMetrics
+}
+
+func (NoopTailerMetrics) Start()                                     {}
+func (NoopTailerMetrics) Inc()                                       {}
+func (NoopTailerMetrics) Dec()                                       {}
+func (NoopTailerMetrics) Set(value int64)                            {}
+func (NoopTailerMetrics) Stop()                                      {}
+func (NoopTailerMetrics) Drop(count int64)                           {}
+func (NoopTailerMetrics) KafkaMessage(topic string, partition int32) {}
+func (NoopTailerMetrics) KafkaRebalance()                            {}
+func (NoopTailerMetrics) WebhookRequest(status int)                  {}
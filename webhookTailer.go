@@ -16,6 +16,9 @@ package go_tailer
 
 import (
 	"bytes"
+	ctx "context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	json "github.com/bitly/go-simplejson"
@@ -25,6 +28,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 type context_string struct {
@@ -35,12 +40,21 @@ type context_string struct {
 }
 
 type WebhookTailer struct {
-	lines  chan *fswatcher.Line
-	errors chan fswatcher.Error
-	config *configuration.InputConfig
+	lines    chan *fswatcher.Line
+	errors   chan fswatcher.Error
+	config   *configuration.InputConfig
+	mutex    sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup // requests currently being processed by ServeHTTP
+	done     chan struct{}
+	stopped  chan struct{} // closed when all requests are processed and the channels are closed
+	metrics  TailerMetrics
 }
 
-var webhookTailerSingleton *WebhookTailer
+var (
+	webhookTailerSingleton     *WebhookTailer
+	webhookTailerSingletonLock sync.Mutex // guards webhookTailerSingleton, acquired after WebhookTailer.mutex
+)
 
 func (t *WebhookTailer) Lines() chan *fswatcher.Line {
 	return t.lines
@@ -50,41 +64,126 @@ func (t *WebhookTailer) Errors() chan fswatcher.Error {
 	return t.errors
 }
 
+// Close stops accepting new requests, the webserver itself is handled by the metrics server.
+// Requests received after Close are rejected with 503 Service Unavailable.
+// The Lines() and Errors() channels are closed when all pending requests are processed.
 func (t *WebhookTailer) Close() {
-	// NO-OP, since the webserver thread is handled by the metrics server
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	close(t.done)
+	webhookTailerSingletonLock.Lock()
+	if webhookTailerSingleton == t {
+		webhookTailerSingleton = nil
+	}
+	webhookTailerSingletonLock.Unlock()
+	go func() {
+		t.inflight.Wait()
+		close(t.lines)
+		close(t.errors)
+		close(t.stopped)
+	}()
+}
+
+// Shutdown closes the tailer and waits until all pending requests are processed.
+func (t *WebhookTailer) Shutdown(shutdownCtx ctx.Context) error {
+	t.Close()
+	select {
+	case <-t.stopped:
+		return nil
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
 }
 
 func InitWebhookTailer(inputConfig *configuration.InputConfig) fswatcher.FileTailer {
+	return InitWebhookTailerContext(ctx.Background(), inputConfig)
+}
+
+// InitWebhookTailerContext is like InitWebhookTailer, but the tailer is closed when parent is done.
+// If the tailer is already initialized, the existing tailer is returned and parent is ignored.
+func InitWebhookTailerContext(parent ctx.Context, inputConfig *configuration.InputConfig) fswatcher.FileTailer {
+	return InitWebhookTailerWithMetrics(parent, inputConfig, nil)
+}
+
+// InitWebhookTailerWithMetrics is like InitWebhookTailerContext, but reports the status of each request and errors to metrics.
+// If metrics is nil, no metrics are reported.
+func InitWebhookTailerWithMetrics(parent ctx.Context, inputConfig *configuration.InputConfig, metrics TailerMetrics) fswatcher.FileTailer {
+	webhookTailerSingletonLock.Lock()
+	defer webhookTailerSingletonLock.Unlock()
 	if webhookTailerSingleton != nil {
 		return webhookTailerSingleton
 	}
+	if metrics == nil {
+		metrics = NoopTailerMetrics{}
+	}
 
-	lineChan := make(chan *fswatcher.Line)
-	errorChan := make(chan fswatcher.Error)
-	webhookTailerSingleton = &WebhookTailer{
-		lines:  lineChan,
-		errors: errorChan,
-		config: inputConfig,
+	t := &WebhookTailer{
+		lines:   make(chan *fswatcher.Line),
+		errors:  make(chan fswatcher.Error),
+		config:  inputConfig,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		metrics: metrics,
 	}
-	return webhookTailerSingleton
+	if parent.Done() != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+				t.Close()
+			case <-t.stopped:
+			}
+		}()
+	}
+	webhookTailerSingleton = t
+	return t
 }
 
 func WebhookHandler() http.Handler {
+	webhookTailerSingletonLock.Lock()
+	defer webhookTailerSingletonLock.Unlock()
 	return webhookTailerSingleton
 }
 
-func (t WebhookTailer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// Registers a request in t.inflight, returns false if the tailer is closed.
+func (t *WebhookTailer) beginRequest() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return false
+	}
+	t.inflight.Add(1)
+	return true
+}
+
+func (t *WebhookTailer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Implement the http handler interface
 
-	wts := webhookTailerSingleton
-	lineChan := wts.lines
-	errorChan := wts.errors
+	if !t.beginRequest() {
+		http.Error(w, "webhook tailer is closed", http.StatusServiceUnavailable)
+		t.metrics.WebhookRequest(http.StatusServiceUnavailable)
+		return
+	}
+	defer t.inflight.Done()
+
+	sendError := func(err error) {
+		Err := fswatcher.NewError(fswatcher.NotSpecified, err, "")
+		t.metrics.Error(Err)
+		select {
+		case t.errors <- Err:
+		case <-t.done:
+		}
+	}
 
 	if r.Body == nil {
 		err := errors.New("got empty request body")
 		logrus.Warn(err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "")
+		t.metrics.WebhookRequest(http.StatusBadRequest)
+		sendError(err)
 		return
 	}
 
@@ -92,22 +191,40 @@ func (t WebhookTailer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		logrus.Warn(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		errorChan <- fswatcher.NewError(fswatcher.NotSpecified, err, "")
+		t.metrics.WebhookRequest(http.StatusInternalServerError)
+		sendError(err)
 		return
 	}
 	defer r.Body.Close()
 
-	context_strings := WebhookProcessBody(wts.config, b)
+	t.metrics.WebhookRequest(http.StatusOK)
+	requestID := webhookRequestID(r)
+	readTime := time.Now()
+	context_strings := WebhookProcessBody(t.config, b)
 	for _, context_string := range context_strings {
 		logrus.WithFields(logrus.Fields{
 			"line":  context_string.line,
 			"extra": context_string.extra,
 		}).Debug("Groking line")
-		lineChan <- &fswatcher.Line{Line: context_string.line, Extra: context_string.extra}
+		select {
+		case t.lines <- &fswatcher.Line{Line: context_string.line, Extra: context_string.extra, RequestID: requestID, ReadTime: readTime}:
+		case <-t.done:
+			return
+		}
 	}
 	return
 }
 
+// The request ID is taken from the X-Request-Id header if present, otherwise a random ID is generated.
+func webhookRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); len(id) > 0 {
+		return id
+	}
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf) // never returns an error, see crypto/rand.Read()
+	return hex.EncodeToString(buf)
+}
+
 func WebhookProcessBody(c *configuration.InputConfig, b []byte) []context_string {
 
 	strs := []context_string{}
@@ -15,12 +15,90 @@
 package go_tailer
 
 import (
+	ctx "context"
 	"fmt"
 	configuration "github.com/jdrews/go-tailer/config"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
+func TestWebhookServeHTTP(t *testing.T) {
+	c := &configuration.InputConfig{
+		Type:          "webhook",
+		WebhookPath:   "/webhook",
+		WebhookFormat: "text_single",
+	}
+	tailer := InitWebhookTailer(c)
+	handler := WebhookHandler()
+	responseCodes := make(chan int)
+	post := func() {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("hello"))
+		req.Header.Set("X-Request-Id", "abc123")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		responseCodes <- rec.Code
+	}
+
+	go post()
+	select {
+	case line := <-tailer.Lines():
+		if line.Line != "hello" || line.RequestID != "abc123" || line.ReadTime.IsZero() {
+			t.Fatalf("unexpected line: %#v", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout while waiting for line")
+	}
+	if code := <-responseCodes; code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, code)
+	}
+
+	shutdownCtx, cancel := ctx.WithTimeout(ctx.Background(), 2*time.Second)
+	defer cancel()
+	err := tailer.Shutdown(shutdownCtx)
+	if err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	go post()
+	if code := <-responseCodes; code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %v after shutdown but got %v", http.StatusServiceUnavailable, code)
+	}
+}
+
+// The singleton is accessed by the HTTP server and by Close(), which may be called from another goroutine.
+// Run with -race to detect unsynchronized access.
+func TestWebhookSingletonConcurrency(t *testing.T) {
+	c := &configuration.InputConfig{
+		Type:          "webhook",
+		WebhookPath:   "/webhook",
+		WebhookFormat: "text_single",
+	}
+	parent, cancel := ctx.WithCancel(ctx.Background())
+	tailer := InitWebhookTailerContext(parent, c)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			WebhookHandler()
+		}
+	}()
+	cancel() // closes the tailer in the background
+	<-done
+	shutdownCtx, cancelShutdown := ctx.WithTimeout(ctx.Background(), 2*time.Second)
+	defer cancelShutdown()
+	err := tailer.Shutdown(shutdownCtx)
+	if err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	newTailer := InitWebhookTailer(c)
+	defer newTailer.Close()
+	if newTailer == tailer {
+		t.Fatal("expected a new tailer after the previous tailer was closed")
+	}
+}
+
 func TestWebhookTextSingle(t *testing.T) {
 	c := &configuration.InputConfig{
 		Type:                     "webhook",